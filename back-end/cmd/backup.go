@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go-jellyfin-api/cmd/blob"
+	"go-jellyfin-api/cmd/config"
+	"go-jellyfin-api/cmd/service"
+	"io"
+	"log"
+	"os"
+)
+
+// backupCommand writes everything stored, posters included, to an archive
+// that restoreCommand can read back into an empty database. Jellyfin sessions
+// hold access tokens, so they are left out unless asked for.
+func backupCommand(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CONFIG_FILE"), "configuration file to read the database and image settings from")
+	output := flags.String("o", "", "archive to write, - for stdout (default backup-<time>.tar.gz)")
+	sessions := flags.Bool("sessions", false, "include the stored Jellyfin sessions")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("usage: backup [-config file] [-o file] [-sessions]")
+	}
+
+	ctx := context.Background()
+	backups, storage, err := openBackupService(ctx, *path)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	// Posters still inline in the database are left out of backups, so they
+	// are moved to the image store first, as startup would.
+	moved, err := storage.Repositories.Movie.MigrateInlineImages(ctx)
+	if err != nil {
+		return err
+	}
+	if moved > 0 {
+		log.Printf("Moved %d posters from the database to the image store\n", moved)
+	}
+
+	backup, err := backups.Export(ctx, *sessions)
+	if err != nil {
+		return err
+	}
+	if *output == "-" {
+		return backups.WriteArchive(ctx, os.Stdout, backup)
+	}
+	if *output == "" {
+		*output = backup.Filename()
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+	if err := backups.WriteArchive(ctx, file, backup); err != nil {
+		file.Close()
+		os.Remove(*output)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	// Progress goes to stderr so the archive can be piped with -o -.
+	fmt.Fprintf(os.Stderr, "Backed up %d movies and %d watchlist entries to %s\n", len(backup.Movies), len(backup.Watchlist), *output)
+	return nil
+}
+
+// restoreCommand imports an archive written by backupCommand into an empty
+// database, or with -force merges it into the rows already there. Restoring
+// the same archive twice changes nothing; merging into rows that clash with
+// it fails without writing any of it.
+func restoreCommand(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CONFIG_FILE"), "configuration file to read the database and image settings from")
+	force := flags.Bool("force", false, "restore into a database that already holds movies or watchlist entries")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: restore [-config file] [-force] file|-")
+	}
+
+	var input io.Reader = os.Stdin
+	if name := flags.Arg(0); name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("failed to open backup: %w", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	ctx := context.Background()
+	backups, storage, err := openBackupService(ctx, *path)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	backup, err := backups.Restore(ctx, input, *force)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %d movies, %d movie changes, %d watchlist entries, %d pairs and %d sessions from %s\n",
+		len(backup.Movies), len(backup.MovieChanges), len(backup.Watchlist), len(backup.MovieWatchlist), len(backup.Sessions),
+		backup.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	return nil
+}
+
+// openBackupService opens the configured database and image store, leaving
+// out Jellyfin, which backups don't need.
+func openBackupService(ctx context.Context, path string) (service.BackupService, *Storage, error) {
+	settings, err := config.LoadStorage(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	images, err := blob.New(ctx, settings.Images)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open image store: %w", err)
+	}
+	storage, err := openStorage(ctx, settings.Database, images)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	return service.NewBackupService(storage.Backups, images), storage, nil
+}
@@ -0,0 +1,53 @@
+// Package blob stores poster images by the hash of their content, so an image
+// shared by several movies is only kept once.
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-jellyfin-api/cmd/config"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs under keys made by Key. Putting a key that already exists
+// is a no-op, since the content is the same.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Key returns the content address of data, its hex SHA-256.
+func Key(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// New opens the store the settings choose.
+func New(ctx context.Context, settings config.ImageSettings) (Store, error) {
+	switch settings.Store {
+	case config.ImageStoreFilesystem:
+		return NewFilesystemStore(settings.Path)
+	case config.ImageStoreS3:
+		return NewS3Store(ctx, settings.S3)
+	default:
+		return nil, fmt.Errorf("unknown image store %q", settings.Store)
+	}
+}
+
+// validKey keeps keys to the hex digests Key makes, so a key can't reach
+// outside the store.
+func validKey(key string) error {
+	if len(key) != sha256.Size*2 {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	if _, err := hex.DecodeString(key); err != nil {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
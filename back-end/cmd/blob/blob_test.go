@@ -0,0 +1,107 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go-jellyfin-api/cmd/config"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFilesystemStore(t *testing.T) {
+	store, err := NewFilesystemStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
+
+// TestS3Store runs against the bucket TEST_S3_BUCKET at TEST_S3_ENDPOINT,
+// with the keys in TEST_S3_ACCESS_KEY and TEST_S3_SECRET_KEY. Blobs are
+// written under a prefix of their own and deleted again.
+func TestS3Store(t *testing.T) {
+	endpoint := os.Getenv("TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("TEST_S3_ENDPOINT is not set")
+	}
+	useSSL, _ := strconv.ParseBool(os.Getenv("TEST_S3_USE_SSL"))
+	store, err := NewS3Store(context.Background(), config.S3Settings{
+		Endpoint:  endpoint,
+		Bucket:    os.Getenv("TEST_S3_BUCKET"),
+		Region:    os.Getenv("TEST_S3_REGION"),
+		AccessKey: os.Getenv("TEST_S3_ACCESS_KEY"),
+		SecretKey: config.Secret(os.Getenv("TEST_S3_SECRET_KEY")),
+		UseSSL:    useSSL,
+		Prefix:    fmt.Sprintf("blob-test-%d", time.Now().UnixNano()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
+
+// testStore checks the contract every Store keeps.
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	data := []byte("poster")
+	key := Key(data)
+	t.Cleanup(func() {
+		_ = store.Delete(ctx, key)
+	})
+
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get before Put returned %v, want ErrNotFound", err)
+	}
+	if exists, err := store.Exists(ctx, key); err != nil || exists {
+		t.Fatalf("Exists before Put = %v, %v, want false", exists, err)
+	}
+
+	if err := store.Put(ctx, key, data, "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	// The content is the same, so putting it again changes nothing.
+	if err := store.Put(ctx, key, data, "image/png"); err != nil {
+		t.Fatalf("Put again: %v", err)
+	}
+	got, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Get = %q, want %q", got, data)
+	}
+	got[0] = 'P'
+	if again, _ := store.Get(ctx, key); !bytes.Equal(again, data) {
+		t.Fatalf("changing what Get returned changed the blob to %q", again)
+	}
+	if exists, err := store.Exists(ctx, key); err != nil || !exists {
+		t.Fatalf("Exists after Put = %v, %v, want true", exists, err)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete returned %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("deleting a missing blob: %v", err)
+	}
+
+	for _, bad := range []string{"", "../../etc/passwd", key[:10], "zz" + key[2:]} {
+		if err := store.Put(ctx, bad, data, "image/png"); err == nil {
+			t.Errorf("Put accepted key %q", bad)
+		}
+		if _, err := store.Get(ctx, bad); err == nil {
+			t.Errorf("Get accepted key %q", bad)
+		}
+	}
+}
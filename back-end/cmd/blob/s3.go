@@ -0,0 +1,100 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go-jellyfin-api/cmd/config"
+	"io"
+	"path"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+type s3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Store keeps blobs as objects in an S3 compatible bucket. The bucket
+// has to exist already.
+func NewS3Store(ctx context.Context, settings config.S3Settings) (Store, error) {
+	creds := credentials.NewIAM("")
+	if settings.AccessKey != "" {
+		creds = credentials.NewStaticV4(settings.AccessKey, settings.SecretKey.Value(), "")
+	}
+	client, err := minio.New(settings.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: settings.UseSSL,
+		Region: settings.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create S3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, settings.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("check S3 bucket %s: %w", settings.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("S3 bucket %s does not exist", settings.Bucket)
+	}
+	return &s3Store{client: client, bucket: settings.Bucket, prefix: settings.Prefix}, nil
+}
+
+func (s *s3Store) object(key string) string {
+	return path.Join(s.prefix, key[:2], key)
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	exists, err := s.Exists(ctx, key)
+	if err != nil || exists {
+		return err
+	}
+	_, err = s.client.PutObject(ctx, s.bucket, s.object(key), bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := validKey(key); err != nil {
+		return nil, err
+	}
+	object, err := s.client.GetObject(ctx, s.bucket, s.object(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	data, err := io.ReadAll(object)
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *s3Store) Exists(ctx context.Context, key string) (bool, error) {
+	if err := validKey(key); err != nil {
+		return false, err
+	}
+	_, err := s.client.StatObject(ctx, s.bucket, s.object(key), minio.StatObjectOptions{})
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	return s.client.RemoveObject(ctx, s.bucket, s.object(key), minio.RemoveObjectOptions{})
+}
+
+func isNotFound(err error) bool {
+	return err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey"
+}
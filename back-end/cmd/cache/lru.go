@@ -0,0 +1,93 @@
+// Package cache keeps recently used values in memory within a fixed budget.
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU holds values up to a total size, dropping the least recently used ones
+// to make room for new ones. It is safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int64
+	size     func(V) int64
+	used     int64
+	entries  map[K]*list.Element
+	order    *list.List
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+	size  int64
+}
+
+// NewLRU makes a cache holding values whose sizes add up to at most
+// capacity. A nil size counts every value as 1, so capacity is then the
+// number of values.
+func NewLRU[K comparable, V any](capacity int64, size func(V) int64) *LRU[K, V] {
+	if size == nil {
+		size = func(V) int64 { return 1 }
+	}
+	return &LRU[K, V]{
+		capacity: capacity,
+		size:     size,
+		entries:  make(map[K]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns the value stored under key, if any, and marks it as used.
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*entry[K, V]).value, true
+}
+
+// Add stores value under key, replacing what was there. A value larger than
+// the whole capacity is not kept.
+func (c *LRU[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	size := c.size(value)
+	if size > c.capacity {
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, size: size})
+	c.used += size
+	for c.used > c.capacity {
+		c.remove(c.order.Back())
+	}
+}
+
+// Remove drops the value stored under key, if any.
+func (c *LRU[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+// Len returns how many values are stored.
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *LRU[K, V]) remove(element *list.Element) {
+	e := c.order.Remove(element).(*entry[K, V])
+	delete(c.entries, e.key)
+	c.used -= e.size
+}
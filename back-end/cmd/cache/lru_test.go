@@ -0,0 +1,51 @@
+package cache
+
+import "testing"
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU[string, int](2, nil)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a is missing")
+	}
+	c.Add("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Error("b was kept, though a was used after it")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+}
+
+func TestLRUSize(t *testing.T) {
+	c := NewLRU[string, []byte](10, func(b []byte) int64 { return int64(len(b)) })
+	c.Add("a", make([]byte, 4))
+	c.Add("b", make([]byte, 4))
+	c.Add("c", make([]byte, 4))
+	if _, ok := c.Get("a"); ok {
+		t.Error("a was kept past the capacity")
+	}
+	if c.Len() != 2 {
+		t.Errorf("holds %d values, want 2", c.Len())
+	}
+	c.Add("huge", make([]byte, 11))
+	if _, ok := c.Get("huge"); ok {
+		t.Error("a value larger than the capacity was kept")
+	}
+	if c.Len() != 2 {
+		t.Errorf("adding a value larger than the capacity left %d values, want 2", c.Len())
+	}
+
+	// Replacing a value frees the size of the old one.
+	c.Add("b", make([]byte, 6))
+	if _, ok := c.Get("c"); !ok {
+		t.Error("c was evicted to make room for b's replacement")
+	}
+	c.Remove("b")
+	if _, ok := c.Get("b"); ok || c.Len() != 1 {
+		t.Errorf("b is still there after Remove")
+	}
+}
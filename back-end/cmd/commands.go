@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go-jellyfin-api/cmd/config"
+	"go-jellyfin-api/cmd/discovery"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runCommand runs the subcommand named on the command line. Starting the
+// binary without one runs the server.
+func runCommand(name string, args []string) error {
+	switch name {
+	case "discover":
+		return discoverCommand(args)
+	case "config":
+		if len(args) == 0 || args[0] != "check" {
+			return errors.New("usage: config check [-config file] [-offline]")
+		}
+		return configCheckCommand(args[1:])
+	case "migrate":
+		return migrateCommand(args)
+	case "backup":
+		return backupCommand(args)
+	case "restore":
+		return restoreCommand(args)
+	case "demo", "--demo":
+		return demoCommand(args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// discoverCommand lists the Jellyfin servers on the local network so one can
+// be picked with JELLYFIN_HOST or JELLYFIN_SERVER_ID.
+func discoverCommand(args []string) error {
+	flags := flag.NewFlagSet("discover", flag.ContinueOnError)
+	timeout := flags.Duration("timeout", discovery.DefaultTimeout, "how long to wait for servers to answer")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	servers, err := discovery.Discover(context.Background(), *timeout)
+	if err != nil {
+		return err
+	}
+	if len(servers) == 0 {
+		fmt.Println("No Jellyfin servers found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tADDRESS")
+	for _, server := range servers {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", server.Id, server.Name, server.Address)
+	}
+	return w.Flush()
+}
+
+// configCheckCommand prints the effective configuration with secrets redacted
+// followed by every problem with it, and fails if there are any.
+func configCheckCommand(args []string) error {
+	flags := flag.NewFlagSet("config check", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CONFIG_FILE"), "configuration file to check")
+	offline := flags.Bool("offline", false, "skip checking that the database and Jellyfin can be reached")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, problems := config.Read(*path)
+	if !*offline {
+		problems = append(problems, cfg.CheckReachability(context.Background(), 3*time.Second)...)
+	}
+
+	rendered, err := cfg.RedactedYAML()
+	if err != nil {
+		return err
+	}
+	fmt.Println("# Effective configuration")
+	fmt.Print(string(rendered))
+
+	if len(problems) == 0 {
+		fmt.Println("\nConfiguration is valid")
+		return nil
+	}
+	fmt.Printf("\n%d problem(s) found:\n", len(problems))
+	for _, problem := range problems {
+		fmt.Println("  -", problem)
+	}
+	return errors.New("configuration is invalid")
+}
@@ -0,0 +1,556 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultListenAddress     = ":8080"
+	DefaultResourceLocation  = "/app/resources/"
+	DefaultWatchlistFilename = "watchlist.csv"
+	DefaultIdMappingFilename = "letterboxd_ids.csv"
+	DefaultImagePath         = "/app/images/"
+	DefaultSQLitePath        = "/app/data/movies.db"
+)
+
+// Database drivers.
+const (
+	DatabaseDriverPostgres = "postgres"
+	DatabaseDriverSQLite   = "sqlite"
+)
+
+// Image stores.
+const (
+	ImageStoreFilesystem = "filesystem"
+	ImageStoreS3         = "s3"
+)
+
+// Config is the backend's whole configuration. It is read from the YAML file
+// named by CONFIG_FILE, if any, on top of the defaults, and environment
+// variables override both.
+type Config struct {
+	Server    ServerSettings   `yaml:"server"`
+	Database  DatabaseSettings `yaml:"database"`
+	Jellyfin  JellyfinSettings `yaml:"jellyfin"`
+	Resources ResourceSettings `yaml:"resources"`
+	Images    ImageSettings    `yaml:"images"`
+	Access    AccessSettings   `yaml:"access"`
+	Random    RandomSettings   `yaml:"random"`
+	Sync      SyncSettings     `yaml:"sync"`
+	Log       LogSettings      `yaml:"log"`
+}
+
+type ServerSettings struct {
+	ListenAddress string         `yaml:"listen_address"`
+	CORSOrigins   []string       `yaml:"cors_origins"`
+	TLS           TLSSettings    `yaml:"tls"`
+	Timeouts      ServerTimeouts `yaml:"timeouts"`
+	// AdminListenAddress serves health checks and admin endpoints on a
+	// separate listener. Empty disables it.
+	AdminListenAddress string `yaml:"admin_listen_address"`
+	// AdminToken is the bearer token the admin endpoints require. Without it
+	// they are refused, leaving only the health check.
+	AdminToken Secret `yaml:"admin_token"`
+}
+
+// TLSSettings turn on HTTPS when CertFile and KeyFile are set. The files are
+// read again whenever they change on disk.
+type TLSSettings struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+	// ClientAuth is one of "none", "request" or "require".
+	ClientAuth string `yaml:"client_auth"`
+}
+
+func (t TLSSettings) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+type ServerTimeouts struct {
+	Read       time.Duration `yaml:"read"`
+	ReadHeader time.Duration `yaml:"read_header"`
+	Write      time.Duration `yaml:"write"`
+	Idle       time.Duration `yaml:"idle"`
+}
+
+type DatabaseSettings struct {
+	// Driver picks Postgres or SQLite. SQLite keeps everything in the one
+	// file at Path and ignores the connection settings.
+	Driver string `yaml:"driver"`
+	Path   string `yaml:"path"`
+	// URL is a complete connection string. When it is set the other
+	// connection settings are ignored.
+	URL      Secret `yaml:"url"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password Secret `yaml:"password"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"ssl_mode"`
+	MaxConns int32  `yaml:"max_conns"`
+	MinConns int32  `yaml:"min_conns"`
+	// AutoMigrate brings the schema up to date at startup. Without it the
+	// backend refuses to start on an outdated schema, which is then migrated
+	// with the migrate command.
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+type JellyfinSettings struct {
+	// Host is the server's base URL. Leave it empty or set it to "discover"
+	// to find the server on the local network.
+	Host        string                  `yaml:"host"`
+	ServerId    string                  `yaml:"server_id"`
+	Username    string                  `yaml:"username"`
+	Password    Secret                  `yaml:"password"`
+	DeviceId    string                  `yaml:"device_id"`
+	DeviceToken Secret                  `yaml:"device_token"`
+	Client      string                  `yaml:"client"`
+	Device      string                  `yaml:"device"`
+	Version     string                  `yaml:"version"`
+	TLS         JellyfinTLSSettings     `yaml:"tls"`
+	Session     JellyfinSessionSettings `yaml:"session"`
+}
+
+// JellyfinSessionSettings control whether the Jellyfin login outlives a
+// restart. The access token is only stored when a key is configured.
+type JellyfinSessionSettings struct {
+	// Key is a base64 encoded 32 byte AES key the stored token is encrypted
+	// with.
+	Key Secret `yaml:"key"`
+	// LogoutOnShutdown revokes the token when the backend stops, so the
+	// next start logs in again.
+	LogoutOnShutdown bool `yaml:"logout_on_shutdown"`
+}
+
+// SessionKey decodes the session key. It returns nil when none is set.
+func (s JellyfinSessionSettings) SessionKey() ([]byte, error) {
+	if s.Key == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(s.Key.Value())
+	if err != nil {
+		return nil, errors.New("key is not valid base64")
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// JellyfinTLSSettings control how the Jellyfin server's certificate is
+// checked, for servers behind a self-signed or private CA certificate.
+type JellyfinTLSSettings struct {
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile         string `yaml:"ca_file"`
+	ClientCertFile string `yaml:"client_cert_file"`
+	ClientKeyFile  string `yaml:"client_key_file"`
+	// PinnedSHA256 is the hex SHA-256 fingerprint the server's certificate
+	// has to have. Colons between the bytes are allowed. A pinned
+	// certificate is trusted on its fingerprint alone, so it may be
+	// self-signed.
+	PinnedSHA256 string `yaml:"pinned_sha256"`
+	// InsecureSkipVerify turns off certificate verification. It changes
+	// nothing when a fingerprint is pinned.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+type ResourceSettings struct {
+	Location          string `yaml:"location"`
+	WatchlistFilename string `yaml:"watchlist_filename"`
+	IdMappingFilename string `yaml:"id_mapping_filename"`
+}
+
+// ImageSettings choose where poster images are kept. The database only holds
+// their hashes.
+type ImageSettings struct {
+	// Store is "filesystem" or "s3".
+	Store string     `yaml:"store"`
+	Path  string     `yaml:"path"`
+	S3    S3Settings `yaml:"s3"`
+}
+
+// S3Settings point at an S3 compatible bucket, such as AWS S3 or MinIO.
+// Without keys the credentials come from the environment or instance role.
+type S3Settings struct {
+	// Endpoint is host[:port] without a scheme, e.g. s3.amazonaws.com.
+	Endpoint  string `yaml:"endpoint"`
+	Bucket    string `yaml:"bucket"`
+	Region    string `yaml:"region"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey Secret `yaml:"secret_key"`
+	UseSSL    bool   `yaml:"use_ssl"`
+	// Prefix is prepended to every object key.
+	Prefix string `yaml:"prefix"`
+}
+
+type AccessSettings struct {
+	// RequireUser rejects requests that don't carry a Jellyfin access token.
+	// Turning it off answers them as the backend's own account, which sees
+	// every movie.
+	RequireUser bool `yaml:"require_user"`
+}
+
+type RandomSettings struct {
+	// Count is how many movies the random endpoints pick.
+	Count int `yaml:"count"`
+}
+
+type SyncSettings struct {
+	// Interval between library syncs after the one at startup. Zero only
+	// syncs at startup.
+	Interval time.Duration `yaml:"interval"`
+}
+
+type LogSettings struct {
+	Level string `yaml:"level"`
+}
+
+func Default() *Config {
+	return &Config{
+		Server: ServerSettings{
+			ListenAddress: DefaultListenAddress,
+			CORSOrigins:   []string{"*"},
+			TLS: TLSSettings{
+				ClientAuth: "none",
+			},
+			Timeouts: ServerTimeouts{
+				Read:       30 * time.Second,
+				ReadHeader: 10 * time.Second,
+				Write:      60 * time.Second,
+				Idle:       120 * time.Second,
+			},
+		},
+		Database: DatabaseSettings{
+			Driver:      DatabaseDriverPostgres,
+			Path:        DefaultSQLitePath,
+			Host:        "localhost",
+			Port:        5432,
+			User:        "user",
+			Password:    "password",
+			Name:        "movies",
+			SSLMode:     "disable",
+			MaxConns:    25,
+			MinConns:    5,
+			AutoMigrate: true,
+		},
+		Jellyfin: JellyfinSettings{
+			Client:  "JFin Launcher",
+			Device:  "Laptop",
+			Version: "10.8.8",
+		},
+		Resources: ResourceSettings{
+			Location:          DefaultResourceLocation,
+			WatchlistFilename: DefaultWatchlistFilename,
+			IdMappingFilename: DefaultIdMappingFilename,
+		},
+		Images: ImageSettings{
+			Store: ImageStoreFilesystem,
+			Path:  DefaultImagePath,
+			S3: S3Settings{
+				UseSSL: true,
+			},
+		},
+		Access: AccessSettings{
+			RequireUser: true,
+		},
+		Random: RandomSettings{
+			Count: 3,
+		},
+		Log: LogSettings{
+			Level: "info",
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file at path (an
+// empty path skips the file) and the environment, in that order. Every
+// problem found along the way is reported together in a *ValidationError.
+func Load(path string) (*Config, error) {
+	cfg, problems := Read(path)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// LoadDemo is Load for demo mode, which runs without Jellyfin, a database or
+// an image store and so only checks the settings for serving the API.
+func LoadDemo(path string) (*Config, error) {
+	cfg, problems := read(path)
+	problems = append(problems, cfg.serverProblems()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// LoadDatabase is Load for the commands that only work on the database, such
+// as migrate, reading and checking just the database settings.
+func LoadDatabase(path string) (DatabaseSettings, error) {
+	cfg, problems := read(path)
+	problems = append(problems, cfg.Database.problems()...)
+	if len(problems) > 0 {
+		return DatabaseSettings{}, &ValidationError{Problems: problems}
+	}
+	return cfg.Database, nil
+}
+
+// LoadStorage is Load for the commands that work on the stored data, such as
+// backup and restore, checking just the database and image store settings.
+func LoadStorage(path string) (*Config, error) {
+	cfg, problems := read(path)
+	problems = append(problems, cfg.Database.problems()...)
+	problems = append(problems, cfg.Images.problems()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// Read is Load without giving up on problems: it returns the effective
+// configuration alongside everything wrong with it.
+func Read(path string) (*Config, []error) {
+	cfg, problems := read(path)
+	problems = append(problems, cfg.problems()...)
+	return cfg, problems
+}
+
+// read layers the file and the environment over the defaults without
+// validating the result.
+func read(path string) (*Config, []error) {
+	cfg := Default()
+	var problems []error
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	problems = append(problems, cfg.applyEnv(os.Getenv)...)
+	return cfg, problems
+}
+
+func (c *Config) readFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// ConnectionString returns the Postgres URL to connect with.
+func (d DatabaseSettings) ConnectionString() string {
+	if d.URL != "" {
+		return d.URL.Value()
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.User, d.Password.Value()),
+		Host:     fmt.Sprintf("%s:%d", d.Host, d.Port),
+		Path:     "/" + d.Name,
+		RawQuery: url.Values{"sslmode": []string{d.SSLMode}}.Encode(),
+	}
+	return u.String()
+}
+
+// envVar maps one environment variable onto a setting. Secret settings can
+// also be read from the file named by the variable with a _FILE suffix.
+type envVar struct {
+	name   string
+	secret bool
+	apply  func(cfg *Config, value string) error
+}
+
+var envVars = []envVar{
+	stringEnv("LISTEN_ADDRESS", func(c *Config) *string { return &c.Server.ListenAddress }),
+	listEnv("CORS_ORIGINS", func(c *Config) *[]string { return &c.Server.CORSOrigins }),
+	stringEnv("TLS_CERT_FILE", func(c *Config) *string { return &c.Server.TLS.CertFile }),
+	stringEnv("TLS_KEY_FILE", func(c *Config) *string { return &c.Server.TLS.KeyFile }),
+	stringEnv("TLS_CLIENT_CA_FILE", func(c *Config) *string { return &c.Server.TLS.ClientCAFile }),
+	stringEnv("TLS_CLIENT_AUTH", func(c *Config) *string { return &c.Server.TLS.ClientAuth }),
+	durationEnv("SERVER_READ_TIMEOUT", func(c *Config) *time.Duration { return &c.Server.Timeouts.Read }),
+	durationEnv("SERVER_READ_HEADER_TIMEOUT", func(c *Config) *time.Duration { return &c.Server.Timeouts.ReadHeader }),
+	durationEnv("SERVER_WRITE_TIMEOUT", func(c *Config) *time.Duration { return &c.Server.Timeouts.Write }),
+	durationEnv("SERVER_IDLE_TIMEOUT", func(c *Config) *time.Duration { return &c.Server.Timeouts.Idle }),
+	stringEnv("ADMIN_LISTEN_ADDRESS", func(c *Config) *string { return &c.Server.AdminListenAddress }),
+	secretEnv("ADMIN_TOKEN", func(c *Config) *Secret { return &c.Server.AdminToken }),
+
+	stringEnv("DATABASE_DRIVER", func(c *Config) *string { return &c.Database.Driver }),
+	stringEnv("DATABASE_PATH", func(c *Config) *string { return &c.Database.Path }),
+	secretEnv("DATABASE_URL", func(c *Config) *Secret { return &c.Database.URL }),
+	stringEnv("DATABASE_HOST", func(c *Config) *string { return &c.Database.Host }),
+	intEnv("DATABASE_PORT", func(c *Config) *int { return &c.Database.Port }),
+	stringEnv("DATABASE_USER", func(c *Config) *string { return &c.Database.User }),
+	secretEnv("DATABASE_PASSWORD", func(c *Config) *Secret { return &c.Database.Password }),
+	stringEnv("DATABASE_NAME", func(c *Config) *string { return &c.Database.Name }),
+	stringEnv("DATABASE_SSLMODE", func(c *Config) *string { return &c.Database.SSLMode }),
+	int32Env("DATABASE_MAX_CONNS", func(c *Config) *int32 { return &c.Database.MaxConns }),
+	int32Env("DATABASE_MIN_CONNS", func(c *Config) *int32 { return &c.Database.MinConns }),
+	boolEnv("DATABASE_AUTO_MIGRATE", func(c *Config) *bool { return &c.Database.AutoMigrate }),
+
+	stringEnv("JELLYFIN_HOST", func(c *Config) *string { return &c.Jellyfin.Host }),
+	stringEnv("JELLYFIN_SERVER_ID", func(c *Config) *string { return &c.Jellyfin.ServerId }),
+	stringEnv("USERNAME", func(c *Config) *string { return &c.Jellyfin.Username }),
+	secretEnv("PASSWORD", func(c *Config) *Secret { return &c.Jellyfin.Password }),
+	stringEnv("DEVICE_ID", func(c *Config) *string { return &c.Jellyfin.DeviceId }),
+	secretEnv("DEVICE_TOKEN", func(c *Config) *Secret { return &c.Jellyfin.DeviceToken }),
+	stringEnv("JELLYFIN_CLIENT", func(c *Config) *string { return &c.Jellyfin.Client }),
+	stringEnv("JELLYFIN_DEVICE", func(c *Config) *string { return &c.Jellyfin.Device }),
+	stringEnv("JELLYFIN_VERSION", func(c *Config) *string { return &c.Jellyfin.Version }),
+	stringEnv("JELLYFIN_CA_FILE", func(c *Config) *string { return &c.Jellyfin.TLS.CAFile }),
+	stringEnv("JELLYFIN_CLIENT_CERT_FILE", func(c *Config) *string { return &c.Jellyfin.TLS.ClientCertFile }),
+	stringEnv("JELLYFIN_CLIENT_KEY_FILE", func(c *Config) *string { return &c.Jellyfin.TLS.ClientKeyFile }),
+	stringEnv("JELLYFIN_PINNED_SHA256", func(c *Config) *string { return &c.Jellyfin.TLS.PinnedSHA256 }),
+	boolEnv("JELLYFIN_INSECURE_SKIP_VERIFY", func(c *Config) *bool { return &c.Jellyfin.TLS.InsecureSkipVerify }),
+	secretEnv("JELLYFIN_SESSION_KEY", func(c *Config) *Secret { return &c.Jellyfin.Session.Key }),
+	boolEnv("JELLYFIN_LOGOUT_ON_SHUTDOWN", func(c *Config) *bool { return &c.Jellyfin.Session.LogoutOnShutdown }),
+
+	stringEnv("RESOURCE_LOCATION", func(c *Config) *string { return &c.Resources.Location }),
+	stringEnv("WATCHLIST_FILENAME", func(c *Config) *string { return &c.Resources.WatchlistFilename }),
+	stringEnv("ID_MAPPING_FILENAME", func(c *Config) *string { return &c.Resources.IdMappingFilename }),
+
+	stringEnv("IMAGE_STORE", func(c *Config) *string { return &c.Images.Store }),
+	stringEnv("IMAGE_STORE_PATH", func(c *Config) *string { return &c.Images.Path }),
+	stringEnv("S3_ENDPOINT", func(c *Config) *string { return &c.Images.S3.Endpoint }),
+	stringEnv("S3_BUCKET", func(c *Config) *string { return &c.Images.S3.Bucket }),
+	stringEnv("S3_REGION", func(c *Config) *string { return &c.Images.S3.Region }),
+	stringEnv("S3_ACCESS_KEY", func(c *Config) *string { return &c.Images.S3.AccessKey }),
+	secretEnv("S3_SECRET_KEY", func(c *Config) *Secret { return &c.Images.S3.SecretKey }),
+	boolEnv("S3_USE_SSL", func(c *Config) *bool { return &c.Images.S3.UseSSL }),
+	stringEnv("S3_PREFIX", func(c *Config) *string { return &c.Images.S3.Prefix }),
+
+	boolEnv("REQUIRE_JELLYFIN_USER", func(c *Config) *bool { return &c.Access.RequireUser }),
+
+	intEnv("RANDOM_COUNT", func(c *Config) *int { return &c.Random.Count }),
+	durationEnv("SYNC_INTERVAL", func(c *Config) *time.Duration { return &c.Sync.Interval }),
+	stringEnv("LOG_LEVEL", func(c *Config) *string { return &c.Log.Level }),
+}
+
+func (c *Config) applyEnv(getenv func(string) string) []error {
+	var problems []error
+	for _, v := range envVars {
+		value, err := v.lookup(getenv)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		if value == "" {
+			continue
+		}
+		if err := v.apply(c, value); err != nil {
+			if v.secret {
+				problems = append(problems, fmt.Errorf("invalid %s value: %w", v.name, err))
+				continue
+			}
+			problems = append(problems, fmt.Errorf("invalid %s value %q: %w", v.name, value, err))
+		}
+	}
+	return problems
+}
+
+func (v envVar) lookup(getenv func(string) string) (string, error) {
+	value := getenv(v.name)
+	if !v.secret {
+		return value, nil
+	}
+	path := getenv(v.name + "_FILE")
+	if path == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", fmt.Errorf("both %s and %s_FILE are set", v.name, v.name)
+	}
+	value, err := readSecretFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE: %w", v.name, err)
+	}
+	return value, nil
+}
+
+func stringEnv(name string, field func(*Config) *string) envVar {
+	return envVar{name: name, apply: func(cfg *Config, value string) error {
+		*field(cfg) = value
+		return nil
+	}}
+}
+
+func secretEnv(name string, field func(*Config) *Secret) envVar {
+	return envVar{name: name, secret: true, apply: func(cfg *Config, value string) error {
+		*field(cfg) = Secret(value)
+		return nil
+	}}
+}
+
+func intEnv(name string, field func(*Config) *int) envVar {
+	return envVar{name: name, apply: func(cfg *Config, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(cfg) = parsed
+		return nil
+	}}
+}
+
+func int32Env(name string, field func(*Config) *int32) envVar {
+	return envVar{name: name, apply: func(cfg *Config, value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		*field(cfg) = int32(parsed)
+		return nil
+	}}
+}
+
+func boolEnv(name string, field func(*Config) *bool) envVar {
+	return envVar{name: name, apply: func(cfg *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(cfg) = parsed
+		return nil
+	}}
+}
+
+func durationEnv(name string, field func(*Config) *time.Duration) envVar {
+	return envVar{name: name, apply: func(cfg *Config, value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field(cfg) = parsed
+		return nil
+	}}
+}
+
+// listEnv reads a comma separated list.
+func listEnv(name string, field func(*Config) *[]string) envVar {
+	return envVar{name: name, apply: func(cfg *Config, value string) error {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(cfg) = items
+		return nil
+	}}
+}
@@ -1,15 +1,26 @@
 package config
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"go-jellyfin-api/cmd/discovery"
 	"go-jellyfin-api/cmd/model"
-	"os"
+	"log"
 )
 
+// DISCOVER_HOST as the Jellyfin host (or leaving it unset) finds the server
+// with a discovery broadcast instead.
+const DISCOVER_HOST = "discover"
+
 type JellyfinConfiguration interface {
 	BuildMediaBrowserIdentifier() string
+	BuildMediaBrowserIdentifierWithToken(token string) string
 	GetHost() string
 	BuildAuthenticationRequest() model.AuthRequest
+	// GetTLSConfig returns the TLS configuration for connections to
+	// Jellyfin, or nil to use Go's defaults.
+	GetTLSConfig() *tls.Config
 }
 
 type jellyfinConfiguration struct {
@@ -19,76 +30,71 @@ type jellyfinConfiguration struct {
 	deviceId string
 	version  string
 	token    string
-	hostEnvs hostEnvs
-}
-
-type hostEnvs struct {
-	deviceToken  string
-	deviceId     string
-	jellyfinHost string
-	username     string
-	password     string
+	username string
+	password string
+	tls      *tls.Config
 }
 
-func NewJellyfinConfiguration() (JellyfinConfiguration, error) {
-	envs, err := validateEnv()
+func NewJellyfinConfiguration(settings JellyfinSettings) (JellyfinConfiguration, error) {
+	host := settings.Host
+	if host == "" || host == DISCOVER_HOST {
+		discovered, err := discoverHost(settings.ServerId)
+		if err != nil {
+			return nil, err
+		}
+		host = discovered
+	}
+	tlsConfig, err := settings.TLS.buildTLSConfig()
 	if err != nil {
 		return nil, err
 	}
 	return &jellyfinConfiguration{
-		host:     envs.jellyfinHost,
-		client:   "JFin Launcher",
-		device:   "Laptop",
-		deviceId: envs.deviceId,
-		version:  "10.8.8",
-		token:    envs.deviceToken,
-		hostEnvs: *envs,
-	}, err
+		host:     host,
+		client:   settings.Client,
+		device:   settings.Device,
+		deviceId: settings.DeviceId,
+		version:  settings.Version,
+		token:    settings.DeviceToken.Value(),
+		username: settings.Username,
+		password: settings.Password.Value(),
+		tls:      tlsConfig,
+	}, nil
 }
 
 func (j *jellyfinConfiguration) BuildMediaBrowserIdentifier() string {
-	return fmt.Sprintf("MediaBrowser client=\"%s\", Device=\"%s\", DeviceId=\"%s\", Version=\"%s\", Token=\"%s\"", j.client, j.device, j.deviceId, j.version, j.token)
+	return j.BuildMediaBrowserIdentifierWithToken(j.token)
+}
+
+func (j *jellyfinConfiguration) BuildMediaBrowserIdentifierWithToken(token string) string {
+	return fmt.Sprintf("MediaBrowser client=\"%s\", Device=\"%s\", DeviceId=\"%s\", Version=\"%s\", Token=\"%s\"", j.client, j.device, j.deviceId, j.version, token)
 }
 
 func (j *jellyfinConfiguration) GetHost() string {
 	return j.host
 }
 
+func (j *jellyfinConfiguration) GetTLSConfig() *tls.Config {
+	return j.tls
+}
+
 func (j *jellyfinConfiguration) BuildAuthenticationRequest() model.AuthRequest {
 	return model.AuthRequest{
-		Username: j.hostEnvs.username,
-		Pw:       j.hostEnvs.password,
+		Username: j.username,
+		Pw:       j.password,
 	}
 }
 
-var requiredEnvs = []string{
-	"DEVICE_ID",
-	"DEVICE_TOKEN",
-	"JELLYFIN_HOST",
-	"USERNAME",
-	"PASSWORD",
-}
-
-func validateEnv() (*hostEnvs, error) {
-	envs := &hostEnvs{}
-	for _, key := range requiredEnvs {
-		value := os.Getenv(key)
-		if value == "" {
-			return nil, fmt.Errorf("value of key %s does not exist", key)
-		}
-
-		switch key {
-		case "DEVICE_ID":
-			envs.deviceId = value
-		case "DEVICE_TOKEN":
-			envs.deviceToken = value
-		case "JELLYFIN_HOST":
-			envs.jellyfinHost = value
-		case "USERNAME":
-			envs.username = value
-		case "PASSWORD":
-			envs.password = value
-		}
+// discoverHost finds the Jellyfin server on the local network, picking the
+// one named by serverId when more than one answers.
+func discoverHost(serverId string) (string, error) {
+	servers, err := discovery.Discover(context.Background(), discovery.DefaultTimeout)
+	if err != nil {
+		return "", fmt.Errorf("discover Jellyfin servers: %w", err)
+	}
+	server, err := discovery.Select(servers, serverId)
+	if err != nil {
+		return "", err
 	}
-	return envs, nil
+	log.Printf("Using discovered Jellyfin server %s at %s\n", server.Name, server.Address)
+	return server.Address, nil
 }
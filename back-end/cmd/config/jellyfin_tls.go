@@ -0,0 +1,86 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// ParseFingerprint decodes a hex SHA-256 fingerprint, with or without colons
+// between the bytes.
+func ParseFingerprint(fingerprint string) ([]byte, error) {
+	decoded, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", ""))
+	if err != nil {
+		return nil, errors.New("fingerprint is not hex")
+	}
+	if len(decoded) != sha256.Size {
+		return nil, fmt.Errorf("fingerprint must be %d bytes, got %d", sha256.Size, len(decoded))
+	}
+	return decoded, nil
+}
+
+// buildTLSConfig turns the settings into the TLS configuration used to talk
+// to Jellyfin. It returns nil when nothing differs from the defaults.
+func (t JellyfinTLSSettings) buildTLSConfig() (*tls.Config, error) {
+	if t == (JellyfinTLSSettings{}) {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if t.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read Jellyfin CA file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Jellyfin CA file %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if t.ClientCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(t.ClientCertFile, t.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load Jellyfin client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if t.PinnedSHA256 != "" {
+		pinned, err := ParseFingerprint(t.PinnedSHA256)
+		if err != nil {
+			return nil, err
+		}
+		// The pin replaces the chain and hostname checks, so a self-signed
+		// certificate works without insecure_skip_verify. The client keeps no
+		// session cache, so every handshake gets here.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("jellyfin presented no certificate")
+			}
+			fingerprint := sha256.Sum256(rawCerts[0])
+			if !bytes.Equal(fingerprint[:], pinned) {
+				return fmt.Errorf("jellyfin certificate fingerprint %s does not match the pinned one", hex.EncodeToString(fingerprint[:]))
+			}
+			return nil
+		}
+	} else if t.InsecureSkipVerify {
+		log.Println("WARNING: Jellyfin TLS certificate verification is DISABLED (jellyfin.tls.insecure_skip_verify). " +
+			"Anyone on the network path can impersonate the server and read the Jellyfin credentials.")
+		log.Println("WARNING: set jellyfin.tls.pinned_sha256 or jellyfin.tls.ca_file instead of skipping verification.")
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return tlsConfig, nil
+}
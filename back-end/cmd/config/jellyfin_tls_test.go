@@ -0,0 +1,49 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPinnedCertificate(t *testing.T) {
+	// The test server's certificate is self-signed.
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	fingerprint := sha256.Sum256(server.Certificate().Raw)
+	pin := strings.ToUpper(hex.EncodeToString(fingerprint[:]))
+	wrongPin := strings.Repeat("00", sha256.Size)
+
+	for _, test := range []struct {
+		name     string
+		settings JellyfinTLSSettings
+		ok       bool
+	}{
+		{"pinned", JellyfinTLSSettings{PinnedSHA256: pin}, true},
+		{"pinned and insecure", JellyfinTLSSettings{PinnedSHA256: pin, InsecureSkipVerify: true}, true},
+		{"wrong pin", JellyfinTLSSettings{PinnedSHA256: wrongPin}, false},
+		{"wrong pin and insecure", JellyfinTLSSettings{PinnedSHA256: wrongPin, InsecureSkipVerify: true}, false},
+		{"not pinned", JellyfinTLSSettings{}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tlsConfig, err := test.settings.buildTLSConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+			resp, err := client.Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if test.ok && err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if !test.ok && err == nil {
+				t.Fatal("request succeeded, want a certificate error")
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// ReloadHook applies a new configuration to a running component. Hooks run in
+// registration order before the new configuration is published, and an error
+// rejects the reload. Hooks that can fail should therefore be registered
+// first and apply their change all at once.
+type ReloadHook func(previous, next *Config) error
+
+// Store holds the running configuration and swaps it for a freshly loaded
+// one on Reload. Readers always see either the old or the new configuration
+// as a whole.
+type Store struct {
+	path    string
+	load    func(path string) (*Config, error)
+	current atomic.Pointer[Config]
+
+	mu    sync.Mutex
+	hooks []ReloadHook
+}
+
+func NewStore(path string) (*Store, error) {
+	return newStore(path, Load)
+}
+
+// NewDemoStore is NewStore for demo mode, loading with LoadDemo now and on
+// every reload.
+func NewDemoStore(path string) (*Store, error) {
+	return newStore(path, LoadDemo)
+}
+
+func newStore(path string, load func(path string) (*Config, error)) (*Store, error) {
+	cfg, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{path: path, load: load}
+	s.current.Store(cfg)
+	return s, nil
+}
+
+func (s *Store) Current() *Config {
+	return s.current.Load()
+}
+
+func (s *Store) OnReload(hook ReloadHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// Reload reads the configuration again. Settings that can't change while
+// running keep their current value and are logged, and a configuration that
+// fails to load, validate or apply is rejected as a whole.
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next, err := s.load(s.path)
+	if err != nil {
+		return fmt.Errorf("config reload rejected: %w", err)
+	}
+
+	previous := s.Current()
+	for _, key := range next.keepRestartOnly(previous) {
+		log.Printf("Config reload: %s changed but only takes effect after a restart\n", key)
+	}
+
+	for _, hook := range s.hooks {
+		if err := hook(previous, next); err != nil {
+			return fmt.Errorf("config reload rejected: %w", err)
+		}
+	}
+	s.current.Store(next)
+	return nil
+}
+
+// keepRestartOnly copies the settings that are only read at startup from
+// previous into c and returns the keys that had changed.
+func (c *Config) keepRestartOnly(previous *Config) []string {
+	var changed []string
+	if c.Server.ListenAddress != previous.Server.ListenAddress {
+		changed = append(changed, "server.listen_address")
+		c.Server.ListenAddress = previous.Server.ListenAddress
+	}
+	if c.Server.AdminListenAddress != previous.Server.AdminListenAddress {
+		changed = append(changed, "server.admin_listen_address")
+		c.Server.AdminListenAddress = previous.Server.AdminListenAddress
+	}
+	if c.Server.TLS != previous.Server.TLS {
+		changed = append(changed, "server.tls")
+		c.Server.TLS = previous.Server.TLS
+	}
+	if c.Server.Timeouts != previous.Server.Timeouts {
+		changed = append(changed, "server.timeouts")
+		c.Server.Timeouts = previous.Server.Timeouts
+	}
+	if c.Database != previous.Database {
+		changed = append(changed, "database")
+		c.Database = previous.Database
+	}
+	if c.Jellyfin.Host != previous.Jellyfin.Host || c.Jellyfin.ServerId != previous.Jellyfin.ServerId {
+		changed = append(changed, "jellyfin.host")
+		c.Jellyfin.Host = previous.Jellyfin.Host
+		c.Jellyfin.ServerId = previous.Jellyfin.ServerId
+	}
+	if c.Images != previous.Images {
+		changed = append(changed, "images")
+		c.Images = previous.Images
+	}
+	if c.Jellyfin.Session.Key != previous.Jellyfin.Session.Key {
+		changed = append(changed, "jellyfin.session.key")
+		c.Jellyfin.Session.Key = previous.Jellyfin.Session.Key
+	}
+	if c.Resources != previous.Resources {
+		changed = append(changed, "resources")
+		c.Resources = previous.Resources
+	}
+	return changed
+}
@@ -0,0 +1,379 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		messages = append(messages, problem.Error())
+	}
+	return fmt.Sprintf("%d configuration problem(s): %s", len(e.Problems), strings.Join(messages, "; "))
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return e.Problems
+}
+
+type requiredSetting struct {
+	key   string
+	value string
+}
+
+// Validate checks the settings without touching the network and reports
+// every problem at once.
+func (c *Config) Validate() error {
+	if problems := c.problems(); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func (c *Config) problems() []error {
+	return append(c.serverProblems(), c.backendProblems()...)
+}
+
+// serverProblems checks what serving the API needs, which is all demo mode
+// reads.
+func (c *Config) serverProblems() []error {
+	var problems []error
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if c.Server.ListenAddress == "" {
+		add("value of key %s does not exist", "server.listen_address")
+	} else if err := checkListenAddress(c.Server.ListenAddress); err != nil {
+		add("server.listen_address %q: %w", c.Server.ListenAddress, err)
+	}
+	if c.Server.AdminListenAddress != "" {
+		if err := checkListenAddress(c.Server.AdminListenAddress); err != nil {
+			add("server.admin_listen_address %q: %w", c.Server.AdminListenAddress, err)
+		} else if c.Server.AdminListenAddress == c.Server.ListenAddress {
+			add("server.admin_listen_address must differ from server.listen_address")
+		}
+	}
+	problems = append(problems, c.Server.TLS.problems()...)
+	for _, timeout := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"server.timeouts.read", c.Server.Timeouts.Read},
+		{"server.timeouts.read_header", c.Server.Timeouts.ReadHeader},
+		{"server.timeouts.write", c.Server.Timeouts.Write},
+		{"server.timeouts.idle", c.Server.Timeouts.Idle},
+	} {
+		if timeout.value < 0 {
+			add("%s must not be negative, got %s", timeout.key, timeout.value)
+		}
+	}
+	for _, origin := range c.Server.CORSOrigins {
+		if origin == "*" {
+			continue
+		}
+		if err := checkURL(origin, "http", "https"); err != nil {
+			add("server.cors_origins %q: %w", origin, err)
+		}
+	}
+
+	if c.Random.Count <= 0 {
+		add("random.count must be positive, got %d", c.Random.Count)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		add("log.level: %w", err)
+	}
+	return problems
+}
+
+// backendProblems checks the settings for Jellyfin, the database and the
+// stores the library is synced into.
+func (c *Config) backendProblems() []error {
+	var problems []error
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	required := []requiredSetting{
+		{"jellyfin.username", c.Jellyfin.Username},
+		{"jellyfin.password", c.Jellyfin.Password.Value()},
+		{"jellyfin.device_id", c.Jellyfin.DeviceId},
+		{"jellyfin.device_token", c.Jellyfin.DeviceToken.Value()},
+		{"resources.location", c.Resources.Location},
+		{"resources.watchlist_filename", c.Resources.WatchlistFilename},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			add("value of key %s does not exist", r.key)
+		}
+	}
+	problems = append(problems, c.Database.problems()...)
+
+	if !c.Jellyfin.discovers() {
+		if err := checkURL(c.Jellyfin.Host, "http", "https"); err != nil {
+			add("jellyfin.host %q: %w", c.Jellyfin.Host, err)
+		}
+	}
+	problems = append(problems, c.Jellyfin.TLS.problems()...)
+	if _, err := c.Jellyfin.Session.SessionKey(); err != nil {
+		add("jellyfin.session.key: %w", err)
+	}
+
+	problems = append(problems, c.Images.problems()...)
+
+	if c.Sync.Interval < 0 {
+		add("sync.interval must not be negative, got %s", c.Sync.Interval)
+	}
+	return problems
+}
+
+func (d DatabaseSettings) problems() []error {
+	var problems []error
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	var required []requiredSetting
+	if d.Driver == DatabaseDriverSQLite {
+		required = append(required, requiredSetting{"database.path", d.Path})
+	} else if d.URL == "" {
+		required = append(required, []requiredSetting{
+			{"database.host", d.Host},
+			{"database.user", d.User},
+			{"database.name", d.Name},
+		}...)
+	}
+	for _, r := range required {
+		if r.value == "" {
+			add("value of key %s does not exist", r.key)
+		}
+	}
+
+	switch d.Driver {
+	case DatabaseDriverSQLite:
+		// Everything is in the file at database.path.
+	case DatabaseDriverPostgres:
+		if d.URL != "" {
+			// The URL holds the password, so it is never echoed back.
+			if err := checkURL(d.URL.Value(), "postgres", "postgresql"); err != nil {
+				add("database.url: %w", err)
+			}
+		} else if d.Port < 1 || d.Port > 65535 {
+			add("database.port must be between 1 and 65535, got %d", d.Port)
+		}
+		if d.MaxConns < 1 {
+			add("database.max_conns must be positive, got %d", d.MaxConns)
+		}
+		if d.MinConns < 0 || d.MinConns > d.MaxConns {
+			add("database.min_conns must be between 0 and database.max_conns, got %d", d.MinConns)
+		}
+	default:
+		add("database.driver must be postgres or sqlite, got %q", d.Driver)
+	}
+	return problems
+}
+
+func (i ImageSettings) problems() []error {
+	var problems []error
+	switch i.Store {
+	case ImageStoreFilesystem:
+		if i.Path == "" {
+			problems = append(problems, errors.New("value of key images.path does not exist"))
+		}
+	case ImageStoreS3:
+		if i.S3.Endpoint == "" {
+			problems = append(problems, errors.New("value of key images.s3.endpoint does not exist"))
+		} else if strings.Contains(i.S3.Endpoint, "://") {
+			problems = append(problems, fmt.Errorf("images.s3.endpoint %q must not include a scheme, use images.s3.use_ssl", i.S3.Endpoint))
+		}
+		if i.S3.Bucket == "" {
+			problems = append(problems, errors.New("value of key images.s3.bucket does not exist"))
+		}
+		if (i.S3.AccessKey == "") != (i.S3.SecretKey == "") {
+			problems = append(problems, errors.New("images.s3.access_key and secret_key must be set together"))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("images.store must be %q or %q, got %q", ImageStoreFilesystem, ImageStoreS3, i.Store))
+	}
+	return problems
+}
+
+func (t TLSSettings) problems() []error {
+	var problems []error
+	if !t.Enabled() {
+		if t.ClientCAFile != "" {
+			problems = append(problems, errors.New("server.tls.client_ca_file needs server.tls.cert_file and key_file"))
+		}
+		return problems
+	}
+	if t.CertFile == "" || t.KeyFile == "" {
+		problems = append(problems, errors.New("server.tls.cert_file and server.tls.key_file must be set together"))
+	}
+	for _, file := range []requiredSetting{
+		{"server.tls.cert_file", t.CertFile},
+		{"server.tls.key_file", t.KeyFile},
+		{"server.tls.client_ca_file", t.ClientCAFile},
+	} {
+		if file.value == "" {
+			continue
+		}
+		if _, err := os.Stat(file.value); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", file.key, err))
+		}
+	}
+	switch t.ClientAuth {
+	case "none", "request":
+	case "require":
+		if t.ClientCAFile == "" {
+			problems = append(problems, errors.New("server.tls.client_auth require needs server.tls.client_ca_file"))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("server.tls.client_auth must be none, request or require, got %q", t.ClientAuth))
+	}
+	return problems
+}
+
+func (t JellyfinTLSSettings) problems() []error {
+	var problems []error
+	if (t.ClientCertFile == "") != (t.ClientKeyFile == "") {
+		problems = append(problems, errors.New("jellyfin.tls.client_cert_file and client_key_file must be set together"))
+	}
+	for _, file := range []requiredSetting{
+		{"jellyfin.tls.ca_file", t.CAFile},
+		{"jellyfin.tls.client_cert_file", t.ClientCertFile},
+		{"jellyfin.tls.client_key_file", t.ClientKeyFile},
+	} {
+		if file.value == "" {
+			continue
+		}
+		if _, err := os.Stat(file.value); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", file.key, err))
+		}
+	}
+	if t.PinnedSHA256 != "" {
+		if _, err := ParseFingerprint(t.PinnedSHA256); err != nil {
+			problems = append(problems, fmt.Errorf("jellyfin.tls.pinned_sha256: %w", err))
+		}
+	}
+	return problems
+}
+
+// CheckReachability tries to open a TCP connection to the database and the
+// Jellyfin server and reports each one that can't be reached. Addresses that
+// already fail validation are skipped.
+func (c *Config) CheckReachability(ctx context.Context, timeout time.Duration) []error {
+	var problems []error
+	dialer := net.Dialer{Timeout: timeout}
+	check := func(key, address string) {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s %s is unreachable: %w", key, address, err))
+			return
+		}
+		conn.Close()
+	}
+
+	if c.Database.Driver != DatabaseDriverSQLite {
+		if address, err := c.Database.address(); err == nil {
+			check("database", address)
+		}
+	}
+	if !c.Jellyfin.discovers() && checkURL(c.Jellyfin.Host, "http", "https") == nil {
+		if address, err := hostPort(c.Jellyfin.Host); err == nil {
+			check("jellyfin.host", address)
+		}
+	}
+	return problems
+}
+
+func (j JellyfinSettings) discovers() bool {
+	return j.Host == "" || j.Host == DISCOVER_HOST
+}
+
+func (d DatabaseSettings) address() (string, error) {
+	if d.URL != "" {
+		if err := checkURL(d.URL.Value(), "postgres", "postgresql"); err != nil {
+			return "", err
+		}
+		return hostPort(d.URL.Value())
+	}
+	if d.Host == "" || d.Port < 1 || d.Port > 65535 {
+		return "", errors.New("invalid database address")
+	}
+	return net.JoinHostPort(d.Host, strconv.Itoa(d.Port)), nil
+}
+
+// hostPort returns the host:port a URL points at, filling in the scheme's
+// default port.
+func hostPort(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https":
+			port = "443"
+		case "http":
+			port = "80"
+		default:
+			port = "5432"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+func checkURL(raw string, schemes ...string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return errors.New("not a valid URL")
+	}
+	schemeAllowed := false
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			schemeAllowed = true
+		}
+	}
+	if !schemeAllowed {
+		return fmt.Errorf("scheme must be one of %s", strings.Join(schemes, ", "))
+	}
+	if u.Hostname() == "" {
+		return errors.New("missing host")
+	}
+	if port := u.Port(); port != "" && !validPort(port) {
+		return errors.New("invalid port")
+	}
+	return nil
+}
+
+func checkListenAddress(address string) error {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !validPort(port) {
+		return errors.New("invalid port")
+	}
+	return nil
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 0 && n <= 65535
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go-jellyfin-api/cmd/blob"
+	"go-jellyfin-api/cmd/config"
+	"go-jellyfin-api/cmd/demo"
+	jellyfinHttp "go-jellyfin-api/cmd/http"
+	"go-jellyfin-api/cmd/logging"
+	"go-jellyfin-api/cmd/repository/memory"
+	"go-jellyfin-api/cmd/service"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// demoCommand serves the API on the demo library, kept in memory, without a
+// database or a Jellyfin server. Only the server, random and log settings
+// are read.
+func demoCommand(args []string) error {
+	flags := flag.NewFlagSet("demo", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CONFIG_FILE"), "configuration file to read the server settings from")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := config.NewDemoStore(*path)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err := logging.Setup(store.Current().Log.Level); err != nil {
+		return fmt.Errorf("failed to set up logging: %w", err)
+	}
+
+	db := memory.NewDatabase()
+	images := blob.NewMemoryStore()
+	repos := &Repositories{
+		UnitOfWork:     memory.NewUnitOfWork(db),
+		Movie:          memory.NewMovieRepository(db, images),
+		Watchlist:      memory.NewWatchlistRepository(db),
+		MovieWatchlist: memory.NewMovieWatchlistRepository(db),
+	}
+	client := demo.NewClient()
+	services := &Services{
+		Jellyfin:   service.NewJellyfinService(nil, client, demo.ParentId, repos.Movie),
+		UserAccess: service.NewUserAccessService(client),
+		Movie:      service.NewMovieService(repos.Movie),
+		Poster:     service.NewPosterService(repos.Movie, images),
+		Watchlist:  service.NewWatchlistService(repos.Watchlist, store.Current().Resources),
+		Backup:     service.NewBackupService(memory.NewBackupRepository(db), images),
+	}
+	services.MovieWatchlist = service.NewMovieWatchlistService(services.Movie, services.Watchlist, repos.MovieWatchlist)
+
+	ctx := context.Background()
+	log.Println("Seeding demo data...")
+	if err := seedDemo(ctx, client, repos, services); err != nil {
+		return fmt.Errorf("failed to seed demo data: %w", err)
+	}
+
+	runCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go watchReloadSignal(store)
+
+	log.Println("Starting HTTP server in demo mode...")
+	return createHttpMux(
+		runCtx,
+		store,
+		services.Jellyfin,
+		nil,
+		client,
+		services.MovieWatchlist,
+		services.Movie,
+		services.Poster,
+		services.UserAccess,
+		services.Backup,
+	)
+}
+
+// seedDemo syncs the demo library and watchlist the way a real sync would.
+func seedDemo(ctx context.Context, client jellyfinHttp.Client, repos *Repositories, services *Services) error {
+	items, err := client.GetAllMoviesRequest(demo.ParentId)
+	if err != nil {
+		return err
+	}
+	movies, err := client.PopulateMovieImageData(items)
+	if err != nil {
+		return err
+	}
+	if err := storeMovieImages(ctx, movies, repos); err != nil {
+		return err
+	}
+	return repos.UnitOfWork.Do(ctx, func(ctx context.Context) error {
+		if err := syncMovieData(ctx, movies, repos); err != nil {
+			return err
+		}
+		if err := repos.Watchlist.PopulateDatabase(ctx, demo.Watchlist()); err != nil {
+			return fmt.Errorf("failed to populate watchlist: %w", err)
+		}
+		pairs, err := services.MovieWatchlist.PopulateDatabase(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to populate movie-watchlist database: %w", err)
+		}
+		log.Printf("Demo watchlist has %d movies in the library\n", len(pairs))
+		return nil
+	})
+}
@@ -0,0 +1,118 @@
+package demo
+
+import (
+	"errors"
+	"go-jellyfin-api/cmd/config"
+	jellyfinHttp "go-jellyfin-api/cmd/http"
+	"go-jellyfin-api/cmd/model"
+	"net/http"
+)
+
+// ParentId is the id the demo client gives its movie folder.
+const ParentId = "demo-movies"
+
+var errNoJellyfin = errors.New("there is no Jellyfin server in demo mode")
+
+// client stands in for Jellyfin in demo mode. It serves the demo library to
+// everyone and treats any token as the demo user.
+type client struct {
+	library model.Items
+	user    model.JellyfinUser
+}
+
+func NewClient() jellyfinHttp.Client {
+	return &client{
+		library: Library(),
+		user:    model.JellyfinUser{Id: "demo-user", Name: "Demo"},
+	}
+}
+
+func (c *client) GetMovieFolderParentId() (string, error) {
+	return ParentId, nil
+}
+
+func (c *client) GetRequest(url string) (*http.Request, error) {
+	return nil, errNoJellyfin
+}
+
+func (c *client) MakeHttpClientRequest(request *http.Request) ([]byte, error) {
+	return nil, errNoJellyfin
+}
+
+func (c *client) GetAllMoviesRequest(parentId string) (model.Items, error) {
+	return c.items(func(model.ItemsElement) bool { return true }), nil
+}
+
+func (c *client) GetResumeMoviesRequest(user model.JellyfinUser, parentId string) (model.Items, error) {
+	return c.items(model.ItemsElement.IsInProgress), nil
+}
+
+func (c *client) GetUserMoviesRequest(user model.JellyfinUser) (model.Items, error) {
+	return c.items(func(model.ItemsElement) bool { return true }), nil
+}
+
+func (c *client) GetCurrentUser(token string) (model.JellyfinUser, error) {
+	if token == "" {
+		return model.JellyfinUser{}, errors.New("no token given")
+	}
+	user := c.user
+	user.Token = token
+	return user, nil
+}
+
+func (c *client) ServiceUser() model.JellyfinUser {
+	return c.user
+}
+
+func (c *client) AuthenticateByName() error {
+	return nil
+}
+
+func (c *client) Session() model.AuthResponse {
+	return model.AuthResponse{}
+}
+
+func (c *client) RestoreSession(session model.AuthResponse) error {
+	return nil
+}
+
+func (c *client) Logout() error {
+	return nil
+}
+
+func (c *client) Reconfigure(cfg config.JellyfinConfiguration) error {
+	return nil
+}
+
+// PopulateMovieImageData gives each demo movie its generated poster.
+func (c *client) PopulateMovieImageData(items model.Items) (*model.Items, error) {
+	posters := make(map[string]int, len(c.library.ItemElements))
+	for i, item := range c.library.ItemElements {
+		posters[item.Id] = i
+	}
+	for i := range items.ItemElements {
+		item := &items.ItemElements[i]
+		index, ok := posters[item.Id]
+		if !ok {
+			return nil, errNoJellyfin
+		}
+		data, err := poster(index)
+		if err != nil {
+			return nil, err
+		}
+		item.Image = model.MovieImage{ImageData: data}
+	}
+	return &items, nil
+}
+
+// items copies the library items that match keep, so callers can't change
+// the library.
+func (c *client) items(keep func(model.ItemsElement) bool) model.Items {
+	var items []model.ItemsElement
+	for _, item := range c.library.ItemElements {
+		if keep(item) {
+			items = append(items, item)
+		}
+	}
+	return model.Items{ItemElements: items}
+}
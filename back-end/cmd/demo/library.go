@@ -0,0 +1,159 @@
+package demo
+
+import (
+	"bytes"
+	"fmt"
+	"go-jellyfin-api/cmd/model"
+	"image"
+	"image/color"
+	"image/png"
+	"time"
+)
+
+// LibraryId is the library every demo movie belongs to.
+const LibraryId = "demo-library"
+
+// ticksPerMinute converts runtimes to Jellyfin's 100ns ticks.
+const ticksPerMinute = int64(time.Minute / 100)
+
+type demoMovie struct {
+	name     string
+	original string
+	year     int
+	rating   float32
+	minutes  int64
+	imdbId   string
+	genres   []string
+	people   []string
+	overview string
+}
+
+var movies = []demoMovie{
+	{"Casablanca", "", 1942, 8.5, 102, "tt0034583", []string{"Drama", "Romance", "War"}, []string{"Michael Curtiz", "Humphrey Bogart", "Ingrid Bergman"}, "A nightclub owner in wartime Morocco has to choose between his old love and helping her husband escape."},
+	{"Rear Window", "", 1954, 8.5, 112, "tt0047396", []string{"Mystery", "Thriller"}, []string{"Alfred Hitchcock", "James Stewart", "Grace Kelly"}, "A photographer stuck in his apartment with a broken leg becomes convinced a neighbour committed murder."},
+	{"Seven Samurai", "七人の侍", 1954, 8.6, 207, "tt0047478", []string{"Action", "Drama"}, []string{"Akira Kurosawa", "Toshiro Mifune", "Takashi Shimura"}, "A village of farmers hires seven masterless samurai to defend it against bandits."},
+	{"The Godfather", "", 1972, 8.7, 175, "tt0068646", []string{"Crime", "Drama"}, []string{"Francis Ford Coppola", "Marlon Brando", "Al Pacino"}, "The ageing head of a crime family hands his empire over to his reluctant youngest son."},
+	{"Alien", "", 1979, 8.2, 117, "tt0078748", []string{"Horror", "Science Fiction"}, []string{"Ridley Scott", "Sigourney Weaver", "Tom Skerritt"}, "The crew of a commercial towing ship answers a distress call and brings something back on board."},
+	{"Blade Runner", "", 1982, 7.9, 117, "tt0083658", []string{"Science Fiction", "Thriller"}, []string{"Ridley Scott", "Harrison Ford", "Rutger Hauer"}, "A retired cop is pulled back in to hunt down four artificial humans hiding in Los Angeles."},
+	{"The Thing", "", 1982, 8.0, 109, "tt0084787", []string{"Horror", "Mystery", "Science Fiction"}, []string{"John Carpenter", "Kurt Russell", "Keith David"}, "An Antarctic research team is picked off by a creature that can imitate anything it kills."},
+	{"Heat", "", 1995, 8.2, 170, "tt0113277", []string{"Action", "Crime", "Drama"}, []string{"Michael Mann", "Al Pacino", "Robert De Niro"}, "A detective and the professional thief he is chasing turn out to have more in common than either admits."},
+	{"In the Mood for Love", "花樣年華", 2000, 8.1, 98, "tt0118694", []string{"Drama", "Romance"}, []string{"Wong Kar-wai", "Tony Leung Chiu-wai", "Maggie Cheung"}, "Two neighbours in 1960s Hong Kong discover their spouses are having an affair and grow close themselves."},
+	{"Amélie", "Le Fabuleux Destin d'Amélie Poulain", 2001, 7.9, 122, "tt0211915", []string{"Comedy", "Romance"}, []string{"Jean-Pierre Jeunet", "Audrey Tautou", "Mathieu Kassovitz"}, "A shy waitress in Montmartre decides to quietly improve the lives of the people around her."},
+	{"Spirited Away", "千と千尋の神隠し", 2001, 8.5, 125, "tt0245429", []string{"Animation", "Family", "Fantasy"}, []string{"Hayao Miyazaki", "Rumi Hiiragi", "Miyu Irino"}, "A girl wanders into a world of spirits and has to work in a bathhouse to free her parents."},
+	{"Mad Max: Fury Road", "", 2015, 7.6, 120, "tt1392190", []string{"Action", "Adventure", "Science Fiction"}, []string{"George Miller", "Tom Hardy", "Charlize Theron"}, "A drifter and a rebel driver flee across the desert from a warlord and his army."},
+	{"Arrival", "", 2016, 7.6, 116, "tt2543164", []string{"Drama", "Science Fiction"}, []string{"Denis Villeneuve", "Amy Adams", "Jeremy Renner"}, "A linguist is asked to find out why twelve alien ships have appeared around the world."},
+	{"Paddington 2", "", 2017, 7.8, 104, "tt4468740", []string{"Adventure", "Comedy", "Family"}, []string{"Paul King", "Ben Whishaw", "Hugh Grant"}, "A bear is framed for stealing a pop-up book and has to clear his name from prison."},
+	{"Portrait of a Lady on Fire", "Portrait de la jeune fille en feu", 2019, 8.1, 122, "tt8613070", []string{"Drama", "Romance"}, []string{"Céline Sciamma", "Noémie Merlant", "Adèle Haenel"}, "A painter is commissioned to paint a bride-to-be who refuses to sit for her portrait."},
+	{"Parasite", "기생충", 2019, 8.5, 132, "tt6751668", []string{"Comedy", "Drama", "Thriller"}, []string{"Bong Joon-ho", "Song Kang-ho", "Cho Yeo-jeong"}, "A poor family schemes its way into working for a wealthy one, until a secret in the house comes out."},
+}
+
+// Library is the demo Jellyfin library: a fixed set of movies with generated
+// posters. Every third movie has been watched and two are half-way through.
+func Library() model.Items {
+	items := make([]model.ItemsElement, 0, len(movies))
+	for i, m := range movies {
+		people := make([]model.ItemPerson, 0, len(m.people))
+		for j, name := range m.people {
+			kind := "Actor"
+			if j == 0 {
+				kind = "Director"
+			}
+			people = append(people, model.ItemPerson{Name: name, Type: kind})
+		}
+		item := model.ItemsElement{
+			Name:            m.name,
+			OriginalTitle:   m.original,
+			SortName:        m.name,
+			Id:              itemId(i),
+			ProviderIds:     map[string]string{"Imdb": m.imdbId},
+			Type:            "Movie",
+			ProductionYear:  int16(m.year),
+			CommunityRating: m.rating,
+			RunTimeTicks:    m.minutes * ticksPerMinute,
+			Overview:        m.overview,
+			Genres:          m.genres,
+			People:          people,
+			LibraryId:       LibraryId,
+		}
+		switch {
+		case i%3 == 0:
+			item.UserData.Played = true
+		case i == 4 || i == 10:
+			item.UserData.PlaybackPositionTicks = item.RunTimeTicks / 2
+		}
+		items = append(items, item)
+	}
+	return model.Items{ItemElements: items}
+}
+
+// Watchlist is a Letterboxd watchlist for the demo library. Some entries are
+// found by IMDb id, some by title alone and some aren't in the library.
+func Watchlist() model.Watchlist {
+	added := time.Date(2024, time.January, 6, 18, 0, 0, 0, time.UTC)
+	entry := func(days int, title string, year int, slug, imdbId string) model.WatchlistItem {
+		return model.WatchlistItem{
+			Title:         title,
+			DateAdded:     added.AddDate(0, 0, days),
+			DateReleased:  time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC),
+			LetterboxdUri: "https://boxd.it/demo-" + slug,
+			ProviderIds:   model.ProviderIds{ImdbId: imdbId},
+		}
+	}
+	return model.Watchlist{WatchlistItems: []model.WatchlistItem{
+		entry(0, "Seven Samurai", 1954, "seven-samurai", "tt0047478"),
+		entry(3, "Alien", 1979, "alien", ""),
+		entry(9, "In the Mood for Love", 2000, "in-the-mood-for-love", "tt0118694"),
+		entry(14, "Arrival", 2016, "arrival", ""),
+		entry(21, "Paddington 2", 2017, "paddington-2", "tt4468740"),
+		entry(30, "Portrait of a Lady on Fire", 2019, "portrait-of-a-lady-on-fire", ""),
+		entry(42, "Stalker", 1979, "stalker", "tt0079944"),
+		entry(50, "Tokyo Story", 1953, "tokyo-story", "tt0046438"),
+	}}
+}
+
+func itemId(index int) string {
+	return fmt.Sprintf("%032x", index+1)
+}
+
+// poster draws a plain two-tone poster, coloured after the movie's index so
+// each one looks and hashes differently.
+func poster(index int) ([]byte, error) {
+	const width, height = 200, 300
+	hue := float64(index) / float64(len(movies))
+	top := shade(hue, 0.85)
+	bottom := shade(hue, 0.35)
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		c := bottom
+		if y < height*2/3 {
+			c = top
+		}
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode demo poster: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// shade picks a colour around the colour wheel at hue (0 to 1) with the given
+// brightness.
+func shade(hue, brightness float64) color.RGBA {
+	channel := func(offset float64) uint8 {
+		h := hue + offset
+		h -= float64(int(h))
+		v := 1 - 2*abs(h-0.5)
+		return uint8(255 * brightness * (0.3 + 0.7*v))
+	}
+	return color.RGBA{R: channel(0), G: channel(1.0 / 3), B: channel(2.0 / 3), A: 255}
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
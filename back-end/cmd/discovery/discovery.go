@@ -0,0 +1,96 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-jellyfin-api/cmd/model"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	DiscoveryPort    = 7359
+	DefaultTimeout   = 3 * time.Second
+	discoveryMessage = "who is JellyfinServer?"
+)
+
+// Discover broadcasts Jellyfin's discovery message on the local network and
+// collects every server that answers before the timeout runs out.
+func Discover(ctx context.Context, timeout time.Duration) ([]model.JellyfinServer, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, fmt.Errorf("open discovery socket: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	broadcast := &net.UDPAddr{IP: net.IPv4bcast, Port: DiscoveryPort}
+	if _, err := conn.WriteToUDP([]byte(discoveryMessage), broadcast); err != nil {
+		return nil, fmt.Errorf("send discovery broadcast: %w", err)
+	}
+
+	var servers []model.JellyfinServer
+	seen := make(map[string]bool)
+	buf := make([]byte, 4096)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return servers, nil
+		}
+		if err != nil {
+			return servers, fmt.Errorf("read discovery response: %w", err)
+		}
+
+		var server model.JellyfinServer
+		if err := json.Unmarshal(buf[:n], &server); err != nil || server.Address == "" {
+			// Something else listening on the port; not a Jellyfin reply.
+			continue
+		}
+		if seen[server.Id] {
+			continue
+		}
+		seen[server.Id] = true
+		servers = append(servers, server)
+	}
+}
+
+// Select picks a server from the discovered ones. With an empty want the only
+// server is chosen, and more than one is an error; otherwise want has to equal
+// a server's id or name.
+func Select(servers []model.JellyfinServer, want string) (model.JellyfinServer, error) {
+	if len(servers) == 0 {
+		return model.JellyfinServer{}, errors.New("no Jellyfin servers answered the discovery broadcast")
+	}
+	if want == "" {
+		if len(servers) == 1 {
+			return servers[0], nil
+		}
+		return model.JellyfinServer{}, fmt.Errorf("found %d Jellyfin servers, set JELLYFIN_SERVER_ID to one of: %s",
+			len(servers), Describe(servers))
+	}
+	for _, server := range servers {
+		if server.Id == want || strings.EqualFold(server.Name, want) {
+			return server, nil
+		}
+	}
+	return model.JellyfinServer{}, fmt.Errorf("no discovered Jellyfin server matches %q, found: %s", want, Describe(servers))
+}
+
+func Describe(servers []model.JellyfinServer) string {
+	descriptions := make([]string, 0, len(servers))
+	for _, server := range servers {
+		descriptions = append(descriptions, fmt.Sprintf("%s (%s, %s)", server.Name, server.Id, server.Address))
+	}
+	return strings.Join(descriptions, ", ")
+}
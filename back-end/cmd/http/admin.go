@@ -0,0 +1,92 @@
+package http
+
+import (
+	"crypto/subtle"
+	"go-jellyfin-api/cmd/config"
+	"go-jellyfin-api/cmd/service"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewAdminMux serves the endpoints meant for operators rather than API
+// clients. It belongs on the admin listener, which shouldn't be exposed
+// publicly. Everything but the health check needs the configured admin token.
+func NewAdminMux(settings *config.Store, backups service.BackupService) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/admin/reload", requireAdminToken(settings, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if err := settings.Reload(); err != nil {
+			slog.Error("Error reloading configuration", "error", err)
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	// /admin/backup?sessions=true includes the stored Jellyfin sessions.
+	mux.HandleFunc("/admin/backup", requireAdminToken(settings, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		sessions := false
+		if value := r.URL.Query().Get("sessions"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				http.Error(w, "sessions must be true or false", http.StatusBadRequest)
+				return
+			}
+			sessions = parsed
+		}
+		backup, err := backups.Export(r.Context(), sessions)
+		if err != nil {
+			slog.Error("Error exporting backup", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// The archive holds every poster, which can take longer to send than
+		// the server's write timeout allows.
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			log.Println("Failed to lift the write deadline for the backup:", err)
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+backup.Filename()+`"`)
+		// Once the archive has started there is no way left to report an
+		// error but cutting it short.
+		if err := backups.WriteArchive(r.Context(), w, backup); err != nil {
+			log.Println("Failed to send backup:", err)
+		}
+	}))
+	return mux
+}
+
+// requireAdminToken lets a request through to next only if it carries the
+// admin token as a bearer token. The token is read on every request, so a
+// reload can change it. Without one configured, every request is refused.
+func requireAdminToken(settings *config.Store, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := settings.Current().Server.AdminToken.Value()
+		if token == "" {
+			http.Error(w, "admin endpoints are disabled, set server.admin_token to enable them", http.StatusForbidden)
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -1,11 +1,18 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go-jellyfin-api/cmd/config"
+	"go-jellyfin-api/cmd/model"
+	"go-jellyfin-api/cmd/poster"
 	"go-jellyfin-api/cmd/service"
+	"log/slog"
 	"net/http"
+	"regexp"
+	"strconv"
 )
 
 type Controller interface {
@@ -20,6 +27,10 @@ type restController struct {
 	httpClient            Client
 	jellyfinConfiguration config.JellyfinConfiguration
 	movieWatchlistService service.MovieWatchlistService
+	movieService          service.MovieService
+	posterService         service.PosterService
+	userAccessService     service.UserAccessService
+	settings              *config.Store
 }
 
 type Config struct {
@@ -27,8 +38,29 @@ type Config struct {
 	JellyfinService       service.JellyfinService
 	HttpClient            Client
 	MovieWatchlistService service.MovieWatchlistService
+	MovieService          service.MovieService
+	PosterService         service.PosterService
+	UserAccessService     service.UserAccessService
+	// Settings is read on every request so reloaded CORS origins, random
+	// counts and access rules apply straight away.
+	Settings *config.Store
 }
 
+type userContextKey struct{}
+
+// errBadRequest marks errors caused by the caller's input.
+var errBadRequest = errors.New("bad request")
+
+// errBadGateway marks errors caused by Jellyfin failing to answer.
+var errBadGateway = errors.New("bad gateway")
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+var mediaBrowserTokenPattern = regexp.MustCompile(`Token="([^"]*)"`)
+
 func NewController(cfg Config) Controller {
 	c := &restController{
 		mux:                   http.NewServeMux(),
@@ -36,82 +68,594 @@ func NewController(cfg Config) Controller {
 		httpClient:            cfg.HttpClient,
 		jellyfinConfiguration: cfg.JellyfinConfiguration,
 		movieWatchlistService: cfg.MovieWatchlistService,
+		movieService:          cfg.MovieService,
+		posterService:         cfg.PosterService,
+		userAccessService:     cfg.UserAccessService,
+		settings:              cfg.Settings,
 	}
 	c.DefineRoutes()
 	return c
 }
 
 func (c restController) DefineRoutes() {
+	c.mux.HandleFunc(
+		"/movies",
+		c.ListMovies(),
+	)
 	c.mux.HandleFunc(
 		"/movies/random",
-		c.GetRandomMovies(3),
+		c.GetRandomMovies(),
 	)
 	c.mux.HandleFunc(
 		"/movies/watchlist/random",
-		c.GetRandomMoviesFromWatchlist(3),
+		c.GetRandomMoviesFromWatchlist(),
+	)
+	c.mux.HandleFunc(
+		"/movies/continue-watching",
+		c.GetContinueWatching(),
+	)
+	c.mux.HandleFunc(
+		"/movies/recently-updated",
+		c.GetRecentlyUpdatedMovies(),
+	)
+	c.mux.HandleFunc(
+		"/movies/search",
+		c.SearchMovies(),
+	)
+	c.mux.HandleFunc(
+		"/movies/suggest",
+		c.SuggestMovies(),
+	)
+	c.mux.HandleFunc(
+		"/movies/{id}/poster",
+		c.GetPoster(),
 	)
 }
 
 func (c restController) DefineMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		settings := c.settings.Current()
+		setAllowedOrigin(w, r, settings.Server.CORSOrigins)
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Emby-Token")
+
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-		next.ServeHTTP(w, r)
+		token := requestToken(r)
+		if token == "" {
+			if settings.Access.RequireUser {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := c.userAccessService.ResolveUser(r.Context(), token)
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			slog.Error("Error resolving Jellyfin user", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
 	})
 }
 
+// setAllowedOrigin allows any origin when origins contains "*", and otherwise
+// echoes the request's origin back only if it is listed.
+func setAllowedOrigin(w http.ResponseWriter, r *http.Request, origins []string) {
+	origin := r.Header.Get("Origin")
+	for _, allowed := range origins {
+		if allowed == "*" {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			return
+		}
+		if origin != "" && allowed == origin {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+			return
+		}
+	}
+}
+
+// requestToken reads the caller's Jellyfin access token from either the
+// X-Emby-Token header or a MediaBrowser Authorization header.
+func requestToken(r *http.Request) string {
+	if token := r.Header.Get("X-Emby-Token"); token != "" {
+		return token
+	}
+	if match := mediaBrowserTokenPattern.FindStringSubmatch(r.Header.Get("Authorization")); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// requestUser returns the Jellyfin user making the request and whether one
+// was supplied. Anonymous requests, which only get this far with
+// access.require_user turned off, act as the backend's own account.
+func (c restController) requestUser(r *http.Request) (model.JellyfinUser, bool) {
+	if user, ok := r.Context().Value(userContextKey{}).(model.JellyfinUser); ok {
+		return user, true
+	}
+	return c.httpClient.ServiceUser(), false
+}
+
 func (c restController) GetMux() *http.ServeMux {
 	return c.mux
 }
 
-func (c restController) GetRandomMovies(count int) http.HandlerFunc {
+func (c restController) GetRandomMovies() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
 		}
 		ctx := r.Context()
-		movies, err := c.jellyfinService.GetRandomMovies(ctx, count)
+		filter, err := c.randomMovieFilter(r)
 		if err != nil {
-			fmt.Printf("Error getting random movies", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			writeRequestError(w, err)
 			return
 		}
-		jsonBody, err := json.Marshal(movies)
+		count := c.settings.Current().Random.Count
+		movies, err := c.jellyfinService.GetRandomMovies(ctx, count, filter)
 		if err != nil {
-			fmt.Printf("Error marshalling movies to JSON", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			writeError(w, "Error getting random movies", err)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		_, err = w.Write(jsonBody)
+		writeJSON(w, movies)
+	}
+}
+
+func (c restController) GetRandomMoviesFromWatchlist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		ctx := r.Context()
+		filter, err := c.randomMovieFilter(r)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		count := c.settings.Current().Random.Count
+		movies, err := c.movieWatchlistService.GetRandomMovieWatchlist(ctx, count, filter)
 		if err != nil {
-			fmt.Printf("Error writing response body", "error", err)
+			writeError(w, "Error getting random watchlist movies", err)
+			return
 		}
+		writeJSON(w, movies)
 	}
 }
 
-func (c restController) GetRandomMoviesFromWatchlist(count int) http.HandlerFunc {
+func (c restController) GetContinueWatching() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
 		}
 		ctx := r.Context()
-		movies, err := c.movieWatchlistService.GetRandomMovieWatchlist(ctx, count)
+		user, _ := c.requestUser(r)
+		movies, err := c.jellyfinService.GetContinueWatching(ctx, user)
 		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			writeError(w, "Error getting continue watching movies", err)
+			return
 		}
-		jsonBody, err := json.Marshal(movies)
+		writeJSON(w, movies)
+	}
+}
+
+func (c restController) GetRecentlyUpdatedMovies() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		ctx := r.Context()
+		limit, err := queryLimit(r)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		filter, err := c.accessFilter(r)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		movies, err := c.movieService.GetRecentlyUpdatedMovies(ctx, limit, filter)
+		if err != nil {
+			writeError(w, "Error getting recently updated movies", err)
+			return
+		}
+		writeJSON(w, movies)
+	}
+}
+
+func (c restController) SearchMovies() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		ctx := r.Context()
+		limit, err := queryLimit(r)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		offset, err := queryOffset(r)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		filter, err := c.accessFilter(r)
 		if err != nil {
-			fmt.Printf("Error marshalling movies to JSON", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			writeRequestError(w, err)
+			return
+		}
+		page, err := c.movieService.SearchMovies(ctx, r.URL.Query().Get("q"), limit, offset, filter)
+		if errors.Is(err, service.ErrEmptySearchQuery) {
+			writeRequestError(w, fmt.Errorf("%w: %w", errBadRequest, err))
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		_, err = w.Write(jsonBody)
 		if err != nil {
-			fmt.Printf("Error writing response body", "error", err)
+			writeError(w, "Error searching movies", err)
+			return
 		}
+		writeJSON(w, page)
+	}
+}
+
+func (c restController) SuggestMovies() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		ctx := r.Context()
+		limit, err := queryLimit(r)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		filter, err := c.accessFilter(r)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		suggestions, err := c.movieService.SuggestMovies(ctx, r.URL.Query().Get("q"), limit, filter)
+		if errors.Is(err, service.ErrEmptySearchQuery) {
+			writeRequestError(w, fmt.Errorf("%w: %w", errBadRequest, err))
+			return
+		}
+		if err != nil {
+			writeError(w, "Error suggesting movies", err)
+			return
+		}
+		writeJSON(w, suggestions)
+	}
+}
+
+func (c restController) ListMovies() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		ctx := r.Context()
+		query, err := c.movieListQuery(r)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		page, err := c.movieService.ListMovies(ctx, query)
+		if errors.Is(err, model.ErrInvalidCursor) {
+			writeRequestError(w, fmt.Errorf("%w: %w", errBadRequest, err))
+			return
+		}
+		if err != nil {
+			writeError(w, "Error listing movies", err)
+			return
+		}
+		writeJSON(w, page)
+	}
+}
+
+// posterCacheControl lets clients keep posters for a day. It is private
+// because what a caller may see depends on their token. Posters are addressed
+// by content hash, so the ETag changes whenever the poster does.
+const posterCacheControl = "private, max-age=86400"
+
+func (c restController) GetPoster() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		ctx := r.Context()
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeRequestError(w, fmt.Errorf("%w: invalid movie id %q", errBadRequest, r.PathValue("id")))
+			return
+		}
+		filter, err := c.accessFilter(r)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		variant, err := posterVariant(r)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		image, err := c.posterService.GetPoster(ctx, id, filter, variant)
+		if err != nil {
+			writeError(w, "Error getting poster", err)
+			return
+		}
+		if image == nil {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		etag := `"` + image.Hash + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", posterCacheControl)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", image.ContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(image.ImageData)))
+		if r.Method == http.MethodHead {
+			return
+		}
+		if _, err := w.Write(image.ImageData); err != nil {
+			slog.Warn("Error writing response body", "error", err)
+		}
+	}
+}
+
+// posterVariant reads the poster endpoint's size (thumbnail, card or full) and
+// format (jpeg or png) parameters. Without either, the poster is served as
+// stored; otherwise size defaults to full and format to jpeg.
+func posterVariant(r *http.Request) (*poster.Variant, error) {
+	params := r.URL.Query()
+	size, format := poster.Size(params.Get("size")), poster.Format(params.Get("format"))
+	if size == "" && format == "" {
+		return nil, nil
+	}
+	if size == "" {
+		size = poster.SizeFull
+	}
+	if format == "" {
+		format = poster.FormatJPEG
+	}
+	if !size.IsValid() {
+		return nil, fmt.Errorf("%w: size must be thumbnail, card or full", errBadRequest)
+	}
+	if !format.IsValid() {
+		return nil, fmt.Errorf("%w: format must be jpeg or png", errBadRequest)
+	}
+	return &poster.Variant{Size: size, Format: format}, nil
+}
+
+// movieListQuery reads the listing's parameters: yearFrom, yearTo, ratingFrom,
+// ratingTo, genre (repeatable), library, watched, onWatchlist, sort, order,
+// limit and cursor. Titles sort ascending by default and everything else
+// descending, so the newest and best rated come first.
+func (c restController) movieListQuery(r *http.Request) (model.MovieListQuery, error) {
+	params := r.URL.Query()
+	query := model.MovieListQuery{Sort: model.SortByTitle}
+	var err error
+
+	if raw := params.Get("sort"); raw != "" {
+		query.Sort = model.MovieSort(raw)
+		if !query.Sort.IsValid() {
+			return model.MovieListQuery{}, fmt.Errorf("%w: sort must be title, year, rating or added", errBadRequest)
+		}
+	}
+	query.Descending = query.Sort != model.SortByTitle
+	switch params.Get("order") {
+	case "":
+	case "asc":
+		query.Descending = false
+	case "desc":
+		query.Descending = true
+	default:
+		return model.MovieListQuery{}, fmt.Errorf("%w: order must be asc or desc", errBadRequest)
+	}
+	if query.Limit, err = queryLimit(r); err != nil {
+		return model.MovieListQuery{}, err
+	}
+	if raw := params.Get("cursor"); raw != "" {
+		cursor, err := model.DecodeMovieCursor(raw)
+		if err != nil {
+			return model.MovieListQuery{}, fmt.Errorf("%w: %w", errBadRequest, err)
+		}
+		query.After = &cursor
+	}
+
+	if query.Filter, err = c.accessFilter(r); err != nil {
+		return model.MovieListQuery{}, err
+	}
+	filter := &query.Filter
+	if filter.YearFrom, err = optionalInt(params.Get("yearFrom"), "yearFrom"); err != nil {
+		return model.MovieListQuery{}, err
+	}
+	if filter.YearTo, err = optionalInt(params.Get("yearTo"), "yearTo"); err != nil {
+		return model.MovieListQuery{}, err
+	}
+	if filter.RatingFrom, err = optionalFloat(params.Get("ratingFrom"), "ratingFrom"); err != nil {
+		return model.MovieListQuery{}, err
+	}
+	if filter.RatingTo, err = optionalFloat(params.Get("ratingTo"), "ratingTo"); err != nil {
+		return model.MovieListQuery{}, err
+	}
+	filter.Genres = params["genre"]
+	filter.LibraryId = params.Get("library")
+	if filter.OnWatchlist, err = optionalBool(params.Get("onWatchlist"), "onWatchlist"); err != nil {
+		return model.MovieListQuery{}, err
+	}
+	if filter.Watched, err = optionalBool(params.Get("watched"), "watched"); err != nil {
+		return model.MovieListQuery{}, err
+	}
+	if filter.Watched != nil {
+		user, _ := c.requestUser(r)
+		played, err := c.userAccessService.GetPlayedJellyfinIds(r.Context(), user)
+		if err != nil {
+			return model.MovieListQuery{}, fmt.Errorf("failed to get watched movies: %w", err)
+		}
+		filter.PlayedJellyfinIds = played
+	}
+	return query, nil
+}
+
+func optionalInt(raw, name string) (*int, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %s value %q", errBadRequest, name, raw)
+	}
+	return &value, nil
+}
+
+func optionalFloat(raw, name string) (*float32, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(raw, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %s value %q", errBadRequest, name, raw)
+	}
+	rating := float32(value)
+	return &rating, nil
+}
+
+func optionalBool(raw, name string) (*bool, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %s value %q", errBadRequest, name, raw)
+	}
+	return &value, nil
+}
+
+// accessFilter limits results to the movies the calling user may see.
+// Anonymous requests, allowed only with access.require_user turned off, see
+// everything the backend's own account can.
+func (c restController) accessFilter(r *http.Request) (model.MovieFilter, error) {
+	var filter model.MovieFilter
+	user, authenticated := c.requestUser(r)
+	if authenticated {
+		ids, err := c.userAccessService.GetAccessibleJellyfinIds(r.Context(), user)
+		if err != nil {
+			return model.MovieFilter{}, fmt.Errorf("failed to get accessible movies: %w", err)
+		}
+		filter.RestrictAccess = true
+		filter.AllowedJellyfinIds = ids
+	}
+	return filter, nil
+}
+
+// queryLimit reads the optional limit parameter of the list endpoints.
+func queryLimit(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return defaultListLimit, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 || limit > maxListLimit {
+		return 0, fmt.Errorf("%w: limit must be between 1 and %d", errBadRequest, maxListLimit)
+	}
+	return limit, nil
+}
+
+// queryOffset reads the optional offset parameter of the paginated endpoints.
+func queryOffset(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("offset")
+	if raw == "" {
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(raw)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("%w: offset must be a non-negative number", errBadRequest)
+	}
+	return offset, nil
+}
+
+// randomMovieFilter limits random picks to what the calling user may see and
+// reads the random endpoints' query parameters. In-progress movies are
+// included unless the caller passes includeInProgress=false, which fails with
+// errBadGateway if Jellyfin can't say which movies those are.
+func (c restController) randomMovieFilter(r *http.Request) (model.MovieFilter, error) {
+	filter, err := c.accessFilter(r)
+	if err != nil {
+		return model.MovieFilter{}, err
+	}
+	user, _ := c.requestUser(r)
+
+	includeInProgress := true
+	if raw := r.URL.Query().Get("includeInProgress"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return model.MovieFilter{}, fmt.Errorf("%w: invalid includeInProgress value %q", errBadRequest, raw)
+		}
+		includeInProgress = parsed
+	}
+
+	if !includeInProgress {
+		ids, err := c.jellyfinService.GetInProgressJellyfinIds(r.Context(), user)
+		if err != nil {
+			return model.MovieFilter{}, fmt.Errorf("%w: failed to get in-progress movies: %w", errBadGateway, err)
+		}
+		filter.ExcludedJellyfinIds = ids
+	}
+	return filter, nil
+}
+
+// writeRequestError answers 400 for errors caused by the caller's input and
+// 500 for everything else.
+func writeRequestError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errBadRequest) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errBadGateway) {
+		slog.Warn("Error reaching Jellyfin", "error", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeError(w, "Error handling request", err)
+}
+
+// writeError logs err with msg and answers with a 500, keeping the details
+// out of the response.
+func writeError(w http.ResponseWriter, msg string, err error) {
+	slog.Error(msg, "error", err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// writeJSON answers with value encoded as JSON.
+func writeJSON(w http.ResponseWriter, value any) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		writeError(w, "Error encoding response", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(body); err != nil {
+		slog.Warn("Error writing response body", "error", err)
 	}
 }
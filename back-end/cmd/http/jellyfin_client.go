@@ -8,8 +8,10 @@ import (
 	"go-jellyfin-api/cmd/config"
 	"go-jellyfin-api/cmd/model"
 	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"sync"
 )
 
 const (
@@ -17,35 +19,59 @@ const (
 	ImageMaxHeight = 400
 )
 
+// movieItemFields are the optional fields requested when syncing movies.
+const movieItemFields = "OriginalTitle,SortName,ProviderIds,Overview,Genres,People"
+
+var ErrUnauthorized = errors.New("jellyfin rejected the access token")
+
 type Client interface {
 	GetMovieFolderParentId() (string, error)
 	GetRequest(url string) (*http.Request, error)
 	MakeHttpClientRequest(request *http.Request) ([]byte, error)
 	GetAllMoviesRequest(parentId string) (model.Items, error)
+	GetResumeMoviesRequest(user model.JellyfinUser, parentId string) (model.Items, error)
+	GetUserMoviesRequest(user model.JellyfinUser) (model.Items, error)
+	GetCurrentUser(token string) (model.JellyfinUser, error)
+	ServiceUser() model.JellyfinUser
 	AuthenticateByName() error
+	Session() model.AuthResponse
+	RestoreSession(session model.AuthResponse) error
+	Logout() error
+	Reconfigure(cfg config.JellyfinConfiguration) error
 	PopulateMovieImageData(items model.Items) (*model.Items, error)
 }
 
 type jellyfinHttpClient struct {
+	mu                    sync.RWMutex
 	authResponse          model.AuthResponse
 	jellyfinConfiguration config.JellyfinConfiguration
+	httpClient            *http.Client
 }
 
 func NewClient(cfg config.JellyfinConfiguration) (Client, error) {
 	return &jellyfinHttpClient{
 		authResponse:          model.AuthResponse{},
 		jellyfinConfiguration: cfg,
+		httpClient:            newHttpClient(cfg),
 	}, nil
 }
 
+// newHttpClient builds the client every Jellyfin request goes through, so
+// connections are reused and the configured TLS settings always apply.
+func newHttpClient(cfg config.JellyfinConfiguration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg.GetTLSConfig()
+	return &http.Client{Transport: transport}
+}
+
 func (h *jellyfinHttpClient) AuthenticateByName() error {
-	requestBody, err := json.Marshal(h.jellyfinConfiguration.BuildAuthenticationRequest())
+	requestBody, err := json.Marshal(h.configuration().BuildAuthenticationRequest())
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", h.jellyfinConfiguration.GetHost()+"/Users/AuthenticateByName", bytes.NewBuffer(requestBody))
-	req.Header.Set("Authorization", h.jellyfinConfiguration.BuildMediaBrowserIdentifier())
+	req, err := http.NewRequest("POST", h.configuration().GetHost()+"/Users/AuthenticateByName", bytes.NewBuffer(requestBody))
+	req.Header.Set("Authorization", h.configuration().BuildMediaBrowserIdentifier())
 	req.Header.Set("content-type", "application/json")
 
 	if err != nil {
@@ -56,13 +82,125 @@ func (h *jellyfinHttpClient) AuthenticateByName() error {
 	if err != nil {
 		return err
 	}
-	if err := json.Unmarshal(resp, &h.authResponse); err != nil {
-		fmt.Println("can't unmarshal authResponse")
+	var authResponse model.AuthResponse
+	if err := json.Unmarshal(resp, &authResponse); err != nil {
+		slog.Error("Failed to unmarshal auth response", "error", err)
 		return err
 	}
+
+	h.mu.Lock()
+	h.authResponse = authResponse
+	h.mu.Unlock()
+	return nil
+}
+
+// Reconfigure logs in with the new configuration and only switches over to it
+// once that has worked, so a bad reload leaves the client as it was. The
+// previous login is logged out after the switch.
+func (h *jellyfinHttpClient) Reconfigure(cfg config.JellyfinConfiguration) error {
+	next := &jellyfinHttpClient{jellyfinConfiguration: cfg, httpClient: newHttpClient(cfg)}
+	if err := next.AuthenticateByName(); err != nil {
+		return err
+	}
+	if next.auth().User.Id == "" {
+		return errors.New("jellyfin did not accept the new credentials")
+	}
+
+	h.mu.Lock()
+	previousConfig, previousToken := h.jellyfinConfiguration, h.authResponse.Token
+	h.jellyfinConfiguration = cfg
+	h.authResponse = next.authResponse
+	previous := h.httpClient
+	h.httpClient = next.httpClient
+	h.mu.Unlock()
+	previous.CloseIdleConnections()
+
+	// The new login works, so failing to revoke the old one is only logged.
+	if previousToken != "" && previousToken != next.authResponse.Token {
+		if err := h.revoke(previousConfig, previousToken); err != nil {
+			slog.Warn("Failed to log out the previous Jellyfin login", "error", err)
+		}
+	}
 	return nil
 }
 
+// Session returns the current login, including its access token.
+func (h *jellyfinHttpClient) Session() model.AuthResponse {
+	return h.auth()
+}
+
+// RestoreSession switches to a previously stored login after checking with
+// Jellyfin that its token is still valid. A revoked or expired token comes
+// back as ErrUnauthorized.
+func (h *jellyfinHttpClient) RestoreSession(session model.AuthResponse) error {
+	if session.Token == "" {
+		return ErrUnauthorized
+	}
+	user, err := h.GetCurrentUser(session.Token)
+	if err != nil {
+		return err
+	}
+	if user.Id != session.User.Id {
+		return errors.New("stored Jellyfin session belongs to a different user")
+	}
+
+	h.mu.Lock()
+	h.authResponse = model.AuthResponse{
+		User:  model.AuthUser{Id: user.Id, Name: user.Name},
+		Token: session.Token,
+	}
+	h.mu.Unlock()
+	return nil
+}
+
+// Logout ends the current login on the server, which revokes its token.
+func (h *jellyfinHttpClient) Logout() error {
+	token := h.auth().Token
+	if token == "" {
+		return nil
+	}
+	if err := h.revoke(h.configuration(), token); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.authResponse.Token = ""
+	h.mu.Unlock()
+	return nil
+}
+
+// revoke logs token out on the server it was issued by. A token the server
+// no longer accepts counts as revoked.
+func (h *jellyfinHttpClient) revoke(cfg config.JellyfinConfiguration, token string) error {
+	req, err := http.NewRequest("POST", cfg.GetHost()+"/Sessions/Logout", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", cfg.BuildMediaBrowserIdentifierWithToken(token))
+	if _, err := h.doRequest(req); err != nil && !errors.Is(err, ErrUnauthorized) {
+		return err
+	}
+	return nil
+}
+
+func (h *jellyfinHttpClient) configuration() config.JellyfinConfiguration {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.jellyfinConfiguration
+}
+
+func (h *jellyfinHttpClient) client() *http.Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.httpClient
+}
+
+func (h *jellyfinHttpClient) auth() model.AuthResponse {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.authResponse
+}
+
 func (h *jellyfinHttpClient) GetMovieFolderParentId() (string, error) {
 	httpRequest, err := h.GetRequest(h.getMovieParentIdRequestUrl())
 	if err != nil {
@@ -98,15 +236,20 @@ func (h *jellyfinHttpClient) GetRequest(url string) (*http.Request, error) {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", h.jellyfinConfiguration.BuildMediaBrowserIdentifier())
+	// Once logged in, requests carry the login's token instead of the
+	// configured device token.
+	authorization := h.configuration().BuildMediaBrowserIdentifier()
+	if token := h.auth().Token; token != "" {
+		authorization = h.configuration().BuildMediaBrowserIdentifierWithToken(token)
+	}
+	req.Header.Set("Authorization", authorization)
 	req.Header.Set("content-type", "application/json")
 
 	return req, nil
 }
 
 func (h *jellyfinHttpClient) MakeHttpClientRequest(request *http.Request) ([]byte, error) {
-	client := &http.Client{}
-	resp, err := client.Do(request)
+	resp, err := h.client().Do(request)
 	if err != nil {
 		fmt.Println("Error sending request:", err)
 		return nil, err
@@ -122,11 +265,12 @@ func (h *jellyfinHttpClient) MakeHttpClientRequest(request *http.Request) ([]byt
 }
 
 func (h *jellyfinHttpClient) getMovieParentIdRequestUrl() string {
-	return fmt.Sprintf("%s/Users/%s/Items", h.jellyfinConfiguration.GetHost(), h.authResponse.User.Id)
+	return fmt.Sprintf("%s/Users/%s/Items", h.configuration().GetHost(), h.auth().User.Id)
 }
 
 func (h *jellyfinHttpClient) GetAllMoviesRequest(parentId string) (model.Items, error) {
-	url := fmt.Sprintf("%s/Users/%s/Items?ParentId=%s", h.jellyfinConfiguration.GetHost(), h.authResponse.User.Id, parentId)
+	url := fmt.Sprintf("%s/Users/%s/Items?ParentId=%s&Fields=%s",
+		h.configuration().GetHost(), h.auth().User.Id, parentId, movieItemFields)
 	req, err := h.GetRequest(url)
 	if err != nil {
 		return model.Items{}, err
@@ -141,9 +285,109 @@ func (h *jellyfinHttpClient) GetAllMoviesRequest(parentId string) (model.Items,
 		fmt.Println("failed to unmarshal")
 		return model.Items{}, err
 	}
+	for i := range items.ItemElements {
+		items.ItemElements[i].LibraryId = parentId
+	}
 	return items, nil
 }
 
+func (h *jellyfinHttpClient) GetResumeMoviesRequest(user model.JellyfinUser, parentId string) (model.Items, error) {
+	url := fmt.Sprintf("%s/Users/%s/Items/Resume?ParentId=%s&IncludeItemTypes=Movie",
+		h.configuration().GetHost(), user.Id, parentId)
+	return h.getUserItems(user, url)
+}
+
+// GetUserMoviesRequest lists every movie the user can see. Jellyfin applies the
+// user's library permissions and parental rating limit to the result.
+func (h *jellyfinHttpClient) GetUserMoviesRequest(user model.JellyfinUser) (model.Items, error) {
+	url := fmt.Sprintf("%s/Users/%s/Items?IncludeItemTypes=Movie&Recursive=true&Fields=UserData",
+		h.configuration().GetHost(), user.Id)
+	return h.getUserItems(user, url)
+}
+
+func (h *jellyfinHttpClient) GetCurrentUser(token string) (model.JellyfinUser, error) {
+	user := model.JellyfinUser{Token: token}
+	req, err := h.getUserRequest(user, h.configuration().GetHost()+"/Users/Me")
+	if err != nil {
+		return model.JellyfinUser{}, err
+	}
+	resp, err := h.doRequest(req)
+	if err != nil {
+		return model.JellyfinUser{}, err
+	}
+
+	var authUser model.AuthUser
+	if err := json.Unmarshal(resp, &authUser); err != nil {
+		slog.Error("Failed to unmarshal current user", "error", err)
+		return model.JellyfinUser{}, err
+	}
+	if authUser.Id == "" {
+		return model.JellyfinUser{}, errors.New("jellyfin did not return a user for the token")
+	}
+	user.Id = authUser.Id
+	user.Name = authUser.Name
+	return user, nil
+}
+
+func (h *jellyfinHttpClient) ServiceUser() model.JellyfinUser {
+	auth := h.auth()
+	return model.JellyfinUser{
+		Id:   auth.User.Id,
+		Name: auth.User.Name,
+	}
+}
+
+func (h *jellyfinHttpClient) getUserItems(user model.JellyfinUser, url string) (model.Items, error) {
+	req, err := h.getUserRequest(user, url)
+	if err != nil {
+		return model.Items{}, err
+	}
+	resp, err := h.doRequest(req)
+	if err != nil {
+		return model.Items{}, err
+	}
+
+	var items model.Items
+	if err := json.Unmarshal(resp, &items); err != nil {
+		slog.Error("Failed to unmarshal user items", "error", err)
+		return model.Items{}, err
+	}
+	return items, nil
+}
+
+func (h *jellyfinHttpClient) getUserRequest(user model.JellyfinUser, url string) (*http.Request, error) {
+	if user.Token == "" {
+		return h.GetRequest(url)
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", h.configuration().BuildMediaBrowserIdentifierWithToken(user.Token))
+	req.Header.Set("content-type", "application/json")
+
+	return req, nil
+}
+
+// doRequest is MakeHttpClientRequest for calls made with a caller's token,
+// where a rejected token has to surface as an error instead of a body.
+func (h *jellyfinHttpClient) doRequest(request *http.Request) ([]byte, error) {
+	resp, err := h.client().Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, ErrUnauthorized
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("jellyfin returned %s for %s", resp.Status, request.URL.Path)
+	}
+	return io.ReadAll(resp.Body)
+}
+
 // TODO: skip this if db is full
 func (h *jellyfinHttpClient) PopulateMovieImageData(items model.Items) (*model.Items, error) {
 	for i := range items.ItemElements {
@@ -164,7 +408,7 @@ func (h *jellyfinHttpClient) PopulateMovieImageData(items model.Items) (*model.I
 
 func (h *jellyfinHttpClient) getMovieImageData(item *model.ItemsElement) ([]byte, error) {
 	getImageUrl := fmt.Sprintf("%s/Items/%s/Images/Primary?MaxWidth=%d&MaxHeight=%d",
-		h.jellyfinConfiguration.GetHost(), item.Id, ImageMaxWidth, ImageMaxHeight)
+		h.configuration().GetHost(), item.Id, ImageMaxWidth, ImageMaxHeight)
 	req, err := h.GetRequest(getImageUrl)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request url=%s: %w", getImageUrl, err)
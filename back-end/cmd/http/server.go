@@ -0,0 +1,161 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"go-jellyfin-api/cmd/config"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// NewServer builds an HTTP server for handler with the configured timeouts,
+// and with TLS when a certificate is configured.
+func NewServer(address string, handler http.Handler, settings config.ServerSettings) (*http.Server, error) {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadTimeout:       settings.Timeouts.Read,
+		ReadHeaderTimeout: settings.Timeouts.ReadHeader,
+		WriteTimeout:      settings.Timeouts.Write,
+		IdleTimeout:       settings.Timeouts.Idle,
+	}
+	if !settings.TLS.Enabled() {
+		return server, nil
+	}
+
+	tlsConfig, err := newTLSConfig(settings.TLS)
+	if err != nil {
+		return nil, err
+	}
+	server.TLSConfig = tlsConfig
+	return server, nil
+}
+
+// Serve runs the server until it is shut down, over TLS when it has a TLS
+// configuration. A clean shutdown is not reported as an error.
+func Serve(server *http.Server) error {
+	var err error
+	if server.TLSConfig != nil {
+		// The certificate comes from TLSConfig.GetCertificate.
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func newTLSConfig(settings config.TLSSettings) (*tls.Config, error) {
+	certificates, err := newCertificateReloader(settings.CertFile, settings.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certificates.GetCertificate,
+	}
+
+	if settings.ClientCAFile != "" {
+		pem, err := os.ReadFile(settings.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", settings.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+	}
+	switch settings.ClientAuth {
+	case "request":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		tlsConfig.ClientAuth = tls.NoClientCert
+	}
+	return tlsConfig, nil
+}
+
+// certificateCheckInterval limits how often the certificate files are checked
+// for changes.
+const certificateCheckInterval = 10 * time.Second
+
+// certificateReloader serves a certificate from disk and loads it again when
+// the certificate or key file's modification time changes, so renewed
+// certificates are picked up without a restart.
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	modTime     time.Time
+	checkedAt   time.Time
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	r := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) >= certificateCheckInterval {
+		r.checkedAt = time.Now()
+		if modTime, err := r.latestModTime(); err == nil && !modTime.Equal(r.modTime) {
+			if err := r.reloadLocked(); err != nil {
+				// Keep serving the certificate we have until the files are fixed.
+				slog.Error("Failed to reload TLS certificate", "error", err)
+			}
+		}
+	}
+	return r.certificate, nil
+}
+
+func (r *certificateReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reloadLocked()
+}
+
+func (r *certificateReloader) reloadLocked() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+	r.certificate = &certificate
+	r.modTime = modTime
+	r.checkedAt = time.Now()
+	return nil
+}
+
+func (r *certificateReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
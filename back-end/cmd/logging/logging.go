@@ -0,0 +1,28 @@
+package logging
+
+import (
+	"log/slog"
+	"os"
+)
+
+var level = new(slog.LevelVar)
+
+// Setup routes the standard logger through slog at the given level. Messages
+// written with the log package are logged at info level.
+func Setup(name string) error {
+	if err := SetLevel(name); err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+	return nil
+}
+
+// SetLevel changes the level of the running logger.
+func SetLevel(name string) error {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(name)); err != nil {
+		return err
+	}
+	level.Set(parsed)
+	return nil
+}
@@ -2,55 +2,79 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"go-jellyfin-api/cmd/blob"
 	"go-jellyfin-api/cmd/config"
 	jellyfinHttp "go-jellyfin-api/cmd/http"
+	"go-jellyfin-api/cmd/logging"
+	"go-jellyfin-api/cmd/model"
 	"go-jellyfin-api/cmd/repository"
 	"go-jellyfin-api/cmd/service"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const shutdownTimeout = 15 * time.Second
+
 type AppConfig struct {
-	DBPool              *pgxpool.Pool
+	Settings            *config.Store
+	Storage             *Storage
+	Images              blob.Store
 	JellyfinConfig      config.JellyfinConfiguration
 	JellyfinClient      jellyfinHttp.Client
+	JellyfinSessions    service.SessionService
 	MovieFolderParentID string
 }
 
 type Services struct {
 	Jellyfin       service.JellyfinService
+	UserAccess     service.UserAccessService
 	Movie          service.MovieService
+	Poster         service.PosterService
 	Watchlist      service.WatchlistService
 	MovieWatchlist service.MovieWatchlistService
+	Backup         service.BackupService
 }
 
 type Repositories struct {
+	UnitOfWork     repository.UnitOfWork
 	Movie          repository.MovieRepository
 	Watchlist      repository.WatchlistRepository
 	MovieWatchlist repository.MovieWatchlistRepository
 }
 
 func initializeConfig(ctx context.Context) (*AppConfig, error) {
-	pool, err := initDatabase()
+	store, err := config.NewStore(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	settings := store.Current()
+	if err := logging.Setup(settings.Log.Level); err != nil {
+		return nil, fmt.Errorf("failed to set up logging: %w", err)
+	}
+
+	images, err := blob.New(ctx, settings.Images)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image store: %w", err)
+	}
+
+	storage, err := openStorage(ctx, settings.Database, images)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 
-	jellyfinConfig, err := config.NewJellyfinConfiguration()
+	jellyfinConfig, err := config.NewJellyfinConfiguration(settings.Jellyfin)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Jellyfin configuration: %w", err)
 	}
 
-	jellyfinClient, err := createJellyfinClient(jellyfinConfig)
+	jellyfinClient, sessions, err := createJellyfinClient(ctx, jellyfinConfig, settings.Jellyfin.Session, storage.Sessions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Jellyfin client: %w", err)
 	}
@@ -61,49 +85,61 @@ func initializeConfig(ctx context.Context) (*AppConfig, error) {
 	}
 
 	return &AppConfig{
-		DBPool:              pool,
+		Settings:            store,
+		Storage:             storage,
+		Images:              images,
 		JellyfinConfig:      jellyfinConfig,
 		JellyfinClient:      jellyfinClient,
+		JellyfinSessions:    sessions,
 		MovieFolderParentID: movieFolderParentID,
 	}, nil
 }
 
-func initializeRepositories(pool *pgxpool.Pool) *Repositories {
-	return &Repositories{
-		Movie:          repository.NewMovieRepository(pool),
-		Watchlist:      repository.NewWatchlistRepository(pool),
-		MovieWatchlist: repository.NewMovieWatchlistRepository(pool),
-	}
-}
-
 func initializeServices(config *AppConfig, repos *Repositories) *Services {
 	return &Services{
-		Jellyfin:  service.NewJellyfinService(config.JellyfinConfig, repos.Movie),
-		Movie:     service.NewMovieService(repos.Movie),
-		Watchlist: service.NewWatchlistService(repos.Watchlist),
+		Jellyfin:   service.NewJellyfinService(config.JellyfinConfig, config.JellyfinClient, config.MovieFolderParentID, repos.Movie),
+		UserAccess: service.NewUserAccessService(config.JellyfinClient),
+		Movie:      service.NewMovieService(repos.Movie),
+		Poster:     service.NewPosterService(repos.Movie, config.Images),
+		Watchlist:  service.NewWatchlistService(repos.Watchlist, config.Settings.Current().Resources),
 		MovieWatchlist: service.NewMovieWatchlistService(
 			service.NewMovieService(repos.Movie),
-			service.NewWatchlistService(repos.Watchlist),
+			service.NewWatchlistService(repos.Watchlist, config.Settings.Current().Resources),
 			repos.MovieWatchlist,
 		),
+		Backup: service.NewBackupService(config.Storage.Backups, config.Images),
 	}
 }
 
-func syncMovieData(ctx context.Context, config *AppConfig, repos *Repositories) error {
+// fetchMovieData reads the library and its posters from Jellyfin.
+func fetchMovieData(config *AppConfig) (*model.Items, error) {
 	log.Println("Fetching movies from Jellyfin...")
 	movies, err := config.JellyfinClient.GetAllMoviesRequest(config.MovieFolderParentID)
 	if err != nil {
-		return fmt.Errorf("failed to get movies: %w", err)
+		return nil, fmt.Errorf("failed to get movies: %w", err)
 	}
 
 	log.Println("Updating movie images...")
 	moviesWithImages, err := config.JellyfinClient.PopulateMovieImageData(movies)
 	if err != nil {
-		return fmt.Errorf("failed to update movie images: %w", err)
+		return nil, fmt.Errorf("failed to update movie images: %w", err)
 	}
+	return moviesWithImages, nil
+}
 
+// storeMovieImages puts the fetched posters in the image store. It runs before
+// the sync's unit of work, so the transaction only covers database writes.
+func storeMovieImages(ctx context.Context, movies *model.Items, repos *Repositories) error {
+	log.Println("Storing movie posters...")
+	if err := repos.Movie.StoreImages(ctx, movies); err != nil {
+		return fmt.Errorf("failed to store movie posters: %w", err)
+	}
+	return nil
+}
+
+func syncMovieData(ctx context.Context, movies *model.Items, repos *Repositories) error {
 	log.Println("Populating movie database...")
-	if err := repos.Movie.PopulateMovieDatabase(ctx, moviesWithImages); err != nil {
+	if err := repos.Movie.PopulateMovieDatabase(ctx, movies); err != nil {
 		return fmt.Errorf("failed to populate movie database: %w", err)
 	}
 
@@ -127,90 +163,186 @@ func syncWatchlistData(ctx context.Context, services *Services) error {
 }
 
 func main() {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
 	defer cancel()
 
 	config, err := initializeConfig(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer config.DBPool.Close()
-
-	repos := initializeRepositories(config.DBPool)
-	services := initializeServices(config, repos)
+	defer config.Storage.Close()
 
-	if err := syncMovieData(ctx, config, repos); err != nil {
+	repos := config.Storage.Repositories
+	moved, err := repos.Movie.MigrateInlineImages(ctx)
+	if err != nil {
 		log.Fatal(err)
 	}
+	if moved > 0 {
+		log.Printf("Moved %d posters from the database to the image store\n", moved)
+	}
+	services := initializeServices(config, repos)
 
-	if err := syncWatchlistData(ctx, services); err != nil {
+	// Jellyfin is read before the transaction starts, so it is only held
+	// open for the writes. Either the whole library is updated or none of it.
+	syncLibrary := func(ctx context.Context) error {
+		movies, err := fetchMovieData(config)
+		if err != nil {
+			return err
+		}
+		if err := storeMovieImages(ctx, movies, repos); err != nil {
+			return err
+		}
+		return repos.UnitOfWork.Do(ctx, func(ctx context.Context) error {
+			if err := syncMovieData(ctx, movies, repos); err != nil {
+				return err
+			}
+			return syncWatchlistData(ctx, services)
+		})
+	}
+	if err := syncLibrary(ctx); err != nil {
 		log.Fatal(err)
 	}
 
+	runCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	scheduler := newSyncScheduler(syncLibrary)
+	go scheduler.Run(runCtx, config.Settings.Current().Sync.Interval)
+	registerReloadHooks(config, scheduler)
+	go watchReloadSignal(config.Settings)
+
 	log.Println("Starting HTTP server...")
-	if err := createHttpMux(
+	serveErr := createHttpMux(
+		runCtx,
+		config.Settings,
 		services.Jellyfin,
 		config.JellyfinConfig,
 		config.JellyfinClient,
 		services.MovieWatchlist,
-	); err != nil {
-		log.Fatal(err)
+		services.Movie,
+		services.Poster,
+		services.UserAccess,
+		services.Backup,
+	)
+
+	if config.Settings.Current().Jellyfin.Session.LogoutOnShutdown {
+		logoutCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := config.JellyfinSessions.Logout(logoutCtx); err != nil {
+			log.Println("Failed to log out of Jellyfin:", err)
+		} else {
+			log.Println("Logged out of Jellyfin")
+		}
+		cancel()
+	}
+	if serveErr != nil {
+		log.Fatal(serveErr)
 	}
 }
 
-func createJellyfinClient(cfg config.JellyfinConfiguration) (jellyfinHttp.Client, error) {
+// createJellyfinClient builds the client and logs it in, reusing the session
+// stored in the database when there is a session key.
+func createJellyfinClient(ctx context.Context, cfg config.JellyfinConfiguration, settings config.JellyfinSessionSettings, sessionRepo repository.SessionRepository,
+) (jellyfinHttp.Client, service.SessionService, error) {
 	jHttpClient, err := jellyfinHttp.NewClient(cfg)
 	if err != nil {
 		fmt.Println("Failed to create jellyfinHttpClient")
-		return nil, err
+		return nil, nil, err
 	}
 
-	authError := jHttpClient.AuthenticateByName()
-	if authError != nil {
+	key, err := settings.SessionKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("jellyfin session key: %w", err)
+	}
+	if key == nil {
+		log.Println("No Jellyfin session key configured, the login is not kept between restarts")
+	}
+	sessions := service.NewSessionService(jHttpClient, sessionRepo, key)
+
+	if err := sessions.Login(ctx, cfg); err != nil {
 		fmt.Println("Failed to auth")
-		return nil, authError
+		return nil, nil, err
 	}
 
-	return jHttpClient, nil
+	return jHttpClient, sessions, nil
 }
 
-func createHttpMux(jService service.JellyfinService, jCfg config.JellyfinConfiguration,
-	hClient jellyfinHttp.Client, mwlService service.MovieWatchlistService,
+// createHttpMux serves the API, and the admin endpoints when an admin listener
+// is configured, until ctx is cancelled or a listener fails. Open requests get
+// shutdownTimeout to finish.
+func createHttpMux(ctx context.Context, settings *config.Store, jService service.JellyfinService, jCfg config.JellyfinConfiguration,
+	hClient jellyfinHttp.Client, mwlService service.MovieWatchlistService, mService service.MovieService, pService service.PosterService, uaService service.UserAccessService,
+	bService service.BackupService,
 ) error {
 	cfg := jellyfinHttp.Config{
 		JellyfinConfiguration: jCfg,
 		JellyfinService:       jService,
 		HttpClient:            hClient,
 		MovieWatchlistService: mwlService,
+		MovieService:          mService,
+		PosterService:         pService,
+		UserAccessService:     uaService,
+		Settings:              settings,
 	}
 	rc := jellyfinHttp.NewController(cfg)
 
-	httpServeError := http.ListenAndServe(":8080", rc.DefineMiddleware(rc.GetMux()))
-	if httpServeError != nil {
-		return httpServeError
+	serverSettings := settings.Current().Server
+	apiServer, err := jellyfinHttp.NewServer(serverSettings.ListenAddress, rc.DefineMiddleware(rc.GetMux()), serverSettings)
+	if err != nil {
+		return fmt.Errorf("create API server: %w", err)
+	}
+	servers := []*http.Server{apiServer}
+
+	if serverSettings.AdminListenAddress != "" {
+		adminServer, err := jellyfinHttp.NewServer(serverSettings.AdminListenAddress, jellyfinHttp.NewAdminMux(settings, bService), serverSettings)
+		if err != nil {
+			return fmt.Errorf("create admin server: %w", err)
+		}
+		servers = append(servers, adminServer)
 	}
-	return nil
-}
 
-func initDatabase() (*pgxpool.Pool, error) {
-	databaseHost := os.Getenv("DATABASE_HOST")
-	databasePort := os.Getenv("DATABASE_PORT")
-	if databasePort == "" || databaseHost == "" {
-		return nil, errors.New("DATABASE HOST or PORT not set")
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			log.Printf("Listening on %s\n", server.Addr)
+			errs <- jellyfinHttp.Serve(server)
+		}(server)
 	}
 
-	databaseUrl := fmt.Sprintf(
-		"postgres://user:password@%s:%s/movies?sslmode=disable",
-		databaseHost,
-		databasePort,
-	)
+	var serveErr error
+	select {
+	case serveErr = <-errs:
+	case <-ctx.Done():
+		log.Println("Shutting down HTTP server...")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Println("Error shutting down server:", err)
+		}
+	}
+	return serveErr
+}
+
+func initDatabase(ctx context.Context, settings config.DatabaseSettings) (*pgxpool.Pool, error) {
+	databaseUrl := settings.ConnectionString()
 
-	migration, err := migrate.New("file://db/migrations", databaseUrl)
+	migration, err := newPostgresMigration(databaseUrl)
 	if err != nil {
-		return nil, fmt.Errorf("create migration: %w", err)
+		return nil, err
 	}
-	if err := migration.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		return nil, fmt.Errorf("run migration: %w", err)
+	err = migration.prepare(ctx, settings.AutoMigrate)
+	migration.migrate.Close()
+	if err != nil {
+		return nil, err
 	}
 
 	pxgPoolConfig, err := pgxpool.ParseConfig(databaseUrl)
@@ -218,8 +350,8 @@ func initDatabase() (*pgxpool.Pool, error) {
 		return nil, fmt.Errorf("parse config: %w", err)
 	}
 
-	pxgPoolConfig.MaxConns = 25
-	pxgPoolConfig.MinConns = 5
+	pxgPoolConfig.MaxConns = settings.MaxConns
+	pxgPoolConfig.MinConns = settings.MinConns
 
 	pool, err := pgxpool.NewWithConfig(context.Background(), pxgPoolConfig)
 	if err != nil {
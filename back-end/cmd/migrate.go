@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"go-jellyfin-api/cmd/config"
+	"go-jellyfin-api/cmd/repository/sqlite"
+	"go-jellyfin-api/db"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	migratesqlite "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/jackc/pgx/v5"
+)
+
+// migrationLockId is the Postgres advisory lock held while migrating, so
+// replicas starting together migrate one after the other.
+const migrationLockId int64 = 0x6a66_6d69_6772
+
+// schemaMigration runs the embedded migrations on one database.
+type schemaMigration struct {
+	migrate *migrate.Migrate
+	latest  uint
+	// lock keeps other processes from migrating the same database until
+	// unlock is called.
+	lock func(ctx context.Context) (unlock func(), err error)
+}
+
+func newPostgresMigration(databaseUrl string) (*schemaMigration, error) {
+	src, err := db.PostgresMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+	return newSchemaMigration(src, func(src source.Driver) (*migrate.Migrate, error) {
+		return migrate.NewWithSourceInstance("iofs", src, databaseUrl)
+	}, func(ctx context.Context) (func(), error) {
+		return lockPostgres(ctx, databaseUrl)
+	})
+}
+
+// newSQLiteMigration migrates an open SQLite database. Only one process uses
+// a database file, so there is nothing to lock.
+func newSQLiteMigration(database *sql.DB) (*schemaMigration, error) {
+	src, err := db.SQLiteMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+	return newSchemaMigration(src, func(src source.Driver) (*migrate.Migrate, error) {
+		driver, err := migratesqlite.WithInstance(database, &migratesqlite.Config{})
+		if err != nil {
+			return nil, err
+		}
+		return migrate.NewWithInstance("iofs", src, "sqlite3", driver)
+	}, func(context.Context) (func(), error) {
+		return func() {}, nil
+	})
+}
+
+func newSchemaMigration(src source.Driver, open func(source.Driver) (*migrate.Migrate, error),
+	lock func(ctx context.Context) (func(), error),
+) (*schemaMigration, error) {
+	latest, err := db.LatestVersion(src)
+	if err != nil {
+		return nil, err
+	}
+	m, err := open(src)
+	if err != nil {
+		return nil, fmt.Errorf("create migration: %w", err)
+	}
+	return &schemaMigration{migrate: m, latest: latest, lock: lock}, nil
+}
+
+// lockPostgres takes the migration lock on a connection of its own, which
+// waits for whoever holds it, and releases it by closing that connection.
+func lockPostgres(ctx context.Context, databaseUrl string) (func(), error) {
+	conn, err := pgx.Connect(ctx, databaseUrl)
+	if err != nil {
+		return nil, fmt.Errorf("connect for migration lock: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockId); err != nil {
+		conn.Close(context.Background())
+		return nil, fmt.Errorf("take migration lock: %w", err)
+	}
+	return func() {
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockId); err != nil {
+			log.Println("Failed to release migration lock:", err)
+		}
+		conn.Close(context.Background())
+	}, nil
+}
+
+// version is the schema's current version, 0 before the first migration.
+func (s *schemaMigration) version() (uint, bool, error) {
+	version, dirty, err := s.migrate.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// prepare gets the schema ready at startup: with autoMigrate it is brought up
+// to date under the migration lock, and either way the backend only starts
+// on a clean schema at the version this build expects.
+func (s *schemaMigration) prepare(ctx context.Context, autoMigrate bool) error {
+	if autoMigrate {
+		unlock, err := s.lock(ctx)
+		if err != nil {
+			return err
+		}
+		err = s.migrate.Up()
+		unlock()
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return fmt.Errorf("run migration: %w", err)
+		}
+	}
+
+	version, dirty, err := s.version()
+	if err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	switch {
+	case dirty:
+		return fmt.Errorf("schema version %d is dirty after a failed migration, repair it and run \"migrate force %d\"", version, version)
+	case version < s.latest:
+		return fmt.Errorf("schema is at version %d but this build needs %d, run \"migrate up\" or enable database.auto_migrate", version, s.latest)
+	case version > s.latest:
+		return fmt.Errorf("schema is at version %d, newer than this build's %d", version, s.latest)
+	}
+	return nil
+}
+
+// openSQLite opens the SQLite database at path and prepares its schema.
+func openSQLite(ctx context.Context, path string, autoMigrate bool) (*sql.DB, error) {
+	database, err := sqlite.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	migration, err := newSQLiteMigration(database)
+	if err == nil {
+		err = migration.prepare(ctx, autoMigrate)
+	}
+	if err != nil {
+		database.Close()
+		return nil, err
+	}
+	return database, nil
+}
+
+// migrateCommand moves the configured database's schema between versions of
+// the embedded migrations.
+func migrateCommand(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CONFIG_FILE"), "configuration file to read the database settings from")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: migrate [-config file] up | down N | goto V | version | force V")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return errors.New("no migrate command given")
+	}
+
+	settings, err := config.LoadDatabase(*path)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	var migration *schemaMigration
+	switch settings.Driver {
+	case config.DatabaseDriverSQLite:
+		database, err := sqlite.Open(settings.Path)
+		if err != nil {
+			return err
+		}
+		migration, err = newSQLiteMigration(database)
+		if err != nil {
+			database.Close()
+			return err
+		}
+	default:
+		migration, err = newPostgresMigration(settings.ConnectionString())
+		if err != nil {
+			return err
+		}
+	}
+	defer migration.migrate.Close()
+
+	command, args := args[0], args[1:]
+	if command == "version" {
+		return migration.printVersion()
+	}
+	run, err := migrateStep(migration.migrate, command, args)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	ctx := context.Background()
+	unlock, err := migration.lock(ctx)
+	if err != nil {
+		return err
+	}
+	err = run()
+	unlock()
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Println("No change")
+	} else if err != nil {
+		return fmt.Errorf("migrate %s: %w", command, err)
+	}
+	return migration.printVersion()
+}
+
+// migrateStep parses a migrate command that changes the schema.
+func migrateStep(m *migrate.Migrate, command string, args []string) (func() error, error) {
+	number := func() (int, error) {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("migrate %s takes one number", command)
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return 0, fmt.Errorf("migrate %s: %q is not a number", command, args[0])
+		}
+		return n, nil
+	}
+
+	switch command {
+	case "up":
+		if len(args) != 0 {
+			return nil, errors.New("migrate up takes no arguments")
+		}
+		return m.Up, nil
+	case "down":
+		n, err := number()
+		if err != nil {
+			return nil, err
+		}
+		if n < 1 {
+			return nil, errors.New("migrate down needs a positive number of migrations to undo")
+		}
+		return func() error { return m.Steps(-n) }, nil
+	case "goto":
+		n, err := number()
+		if err != nil {
+			return nil, err
+		}
+		if n < 1 {
+			return nil, errors.New("migrate goto needs a positive version, use down to undo the first migration")
+		}
+		return func() error { return m.Migrate(uint(n)) }, nil
+	case "force":
+		n, err := number()
+		if err != nil {
+			return nil, err
+		}
+		if n < -1 {
+			return nil, errors.New("migrate force needs a version, or -1 for none")
+		}
+		return func() error { return m.Force(n) }, nil
+	default:
+		return nil, fmt.Errorf("unknown migrate command %q", command)
+	}
+}
+
+func (s *schemaMigration) printVersion() error {
+	version, dirty, err := s.version()
+	if err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	state := ""
+	if dirty {
+		state = " (dirty)"
+	}
+	fmt.Printf("Schema version %d%s, latest %d\n", version, state, s.latest)
+	return nil
+}
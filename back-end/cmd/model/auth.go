@@ -14,3 +14,11 @@ type AuthRequest struct {
 	Username string `json:"Username"`
 	Pw       string `json:"Pw"`
 }
+
+// JellyfinUser is a Jellyfin account the API acts on behalf of. An empty Token
+// means requests go out with the backend's own configured identity.
+type JellyfinUser struct {
+	Id    string
+	Name  string
+	Token string
+}
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// BackupFormat is the version of the backup layout written by this build.
+// Restores refuse backups with a newer format.
+const BackupFormat = 1
+
+// Backup is everything the backend stores, with the ids the rows have, so
+// pairs, changes and poster URLs still line up after a restore. Poster bytes
+// travel next to it in the archive, named by hash.
+type Backup struct {
+	Format         int                   `json:"format"`
+	CreatedAt      time.Time             `json:"created_at"`
+	Movies         []BackupMovie         `json:"movies"`
+	MovieChanges   []BackupMovieChange   `json:"movie_changes"`
+	Watchlist      []BackupWatchlistItem `json:"watchlist"`
+	MovieWatchlist []BackupMoviePair     `json:"movie_watchlist"`
+	Sessions       []BackupSession       `json:"sessions"`
+}
+
+// Filename names the backup's archive after the time it was taken.
+func (b Backup) Filename() string {
+	return "backup-" + b.CreatedAt.UTC().Format("20060102T150405Z") + ".tar.gz"
+}
+
+// BackupMovie is a movie row, archived ones included.
+type BackupMovie struct {
+	Id              int          `json:"id"`
+	JellyfinId      string       `json:"jellyfin_id"`
+	Name            string       `json:"name"`
+	ProductionYear  int          `json:"production_year"`
+	CommunityRating float32      `json:"community_rating"`
+	OriginalTitle   string       `json:"original_title"`
+	SortName        string       `json:"sort_name"`
+	LibraryId       string       `json:"library_id"`
+	Overview        string       `json:"overview"`
+	Genres          []string     `json:"genres"`
+	People          []string     `json:"people"`
+	ImdbId          string       `json:"imdb_id"`
+	TmdbId          string       `json:"tmdb_id"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	DeletedAt       *time.Time   `json:"deleted_at,omitempty"`
+	Image           *BackupImage `json:"image,omitempty"`
+}
+
+// BackupImage describes a movie's poster, whose bytes are stored under Hash.
+type BackupImage struct {
+	Hash        string `json:"hash"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+}
+
+// BackupMovieChange is one entry of a movie's change history. Changes holds
+// the []FieldChange as it was recorded.
+type BackupMovieChange struct {
+	Id            int             `json:"id"`
+	MovieId       int             `json:"movie_id"`
+	ChangedFields []string        `json:"changed_fields"`
+	Changes       json.RawMessage `json:"changes"`
+	ChangedAt     time.Time       `json:"changed_at"`
+}
+
+type BackupWatchlistItem struct {
+	Id            int       `json:"id"`
+	Title         string    `json:"title"`
+	DateReleased  time.Time `json:"date_released"`
+	DateAdded     time.Time `json:"date_added"`
+	LetterboxdUri string    `json:"letterboxd_uri"`
+	ImdbId        string    `json:"imdb_id"`
+	TmdbId        string    `json:"tmdb_id"`
+}
+
+type BackupMoviePair struct {
+	MovieId     int       `json:"movie_id"`
+	WatchlistId int       `json:"watchlist_id"`
+	AddedDate   time.Time `json:"added_date"`
+}
+
+// BackupSession is a stored Jellyfin login, only backed up when asked for. The
+// token stays encrypted, so it is only usable with the same session key.
+type BackupSession struct {
+	Host           string    `json:"host"`
+	Username       string    `json:"username"`
+	UserId         string    `json:"user_id"`
+	UserName       string    `json:"user_name"`
+	EncryptedToken []byte    `json:"encrypted_token"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,9 @@
+package model
+
+type ContinueWatchingMovie struct {
+	Movie                 Movie
+	MovieImage            MovieImage
+	PercentComplete       float64
+	PlaybackPositionTicks int64
+	RunTimeTicks          int64
+}
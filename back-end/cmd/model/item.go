@@ -5,12 +5,35 @@ type Items struct {
 }
 
 type ItemsElement struct {
-	Name            string  `json:"Name"`
-	Id              string  `json:"Id"`
-	Type            string  `json:"Type"`
-	ProductionYear  int16   `json:"ProductionYear"`
-	CommunityRating float32 `json:"CommunityRating"`
+	Name            string            `json:"Name"`
+	OriginalTitle   string            `json:"OriginalTitle"`
+	SortName        string            `json:"SortName"`
+	Id              string            `json:"Id"`
+	ProviderIds     map[string]string `json:"ProviderIds"`
+	Type            string            `json:"Type"`
+	ProductionYear  int16             `json:"ProductionYear"`
+	CommunityRating float32           `json:"CommunityRating"`
+	RunTimeTicks    int64             `json:"RunTimeTicks"`
+	Overview        string            `json:"Overview"`
+	Genres          []string          `json:"Genres"`
+	People          []ItemPerson      `json:"People"`
+	UserData        ItemUserData      `json:"UserData"`
 	Image           MovieImage
+	// LibraryId is the library the item was synced from.
+	LibraryId string `json:"-"`
+}
+
+// ItemPerson is someone credited on an item, such as an actor or director.
+type ItemPerson struct {
+	Name string `json:"Name"`
+	Role string `json:"Role"`
+	Type string `json:"Type"`
+}
+
+type ItemUserData struct {
+	PlaybackPositionTicks int64   `json:"PlaybackPositionTicks"`
+	PlayedPercentage      float64 `json:"PlayedPercentage"`
+	Played                bool    `json:"Played"`
 }
 
 func (ie ItemsElement) IsEmpty() bool {
@@ -21,6 +44,68 @@ func (ie ItemsElement) IsOfCorrectType(expectedType string) bool {
 	return ie.Type == expectedType
 }
 
+// IsInProgress reports whether playback of the item was started but not finished.
+func (ie ItemsElement) IsInProgress() bool {
+	return !ie.UserData.Played && ie.UserData.PlaybackPositionTicks > 0
+}
+
+// PercentComplete prefers the percentage Jellyfin reports and falls back to
+// working it out from the playback position and the runtime.
+func (ie ItemsElement) PercentComplete() float64 {
+	if ie.UserData.PlayedPercentage > 0 {
+		return ie.UserData.PlayedPercentage
+	}
+	if ie.RunTimeTicks <= 0 {
+		return 0
+	}
+	return float64(ie.UserData.PlaybackPositionTicks) / float64(ie.RunTimeTicks) * 100
+}
+
+// GetProviderIds picks the IMDb and TMDb ids out of Jellyfin's ProviderIds.
+func (ie ItemsElement) GetProviderIds() ProviderIds {
+	return ProviderIds{
+		ImdbId: ie.ProviderIds["Imdb"],
+		TmdbId: ie.ProviderIds["Tmdb"],
+	}
+}
+
+// Movie converts the item into a movie as it is stored. The database id is
+// left unset.
+func (ie ItemsElement) Movie() Movie {
+	genres := ie.Genres
+	if genres == nil {
+		genres = []string{}
+	}
+	return Movie{
+		JellyfinId:      ie.Id,
+		Name:            ie.Name,
+		ProductionYear:  int(ie.ProductionYear),
+		CommunityRating: ie.CommunityRating,
+		OriginalTitle:   ie.OriginalTitle,
+		SortName:        ie.SortName,
+		LibraryId:       ie.LibraryId,
+		Overview:        ie.Overview,
+		Genres:          genres,
+		People:          ie.PeopleNames(),
+		ProviderIds:     ie.GetProviderIds(),
+	}
+}
+
+// PeopleNames returns the names of everyone credited, in Jellyfin's order and
+// without repeats for people with several roles.
+func (ie ItemsElement) PeopleNames() []string {
+	names := make([]string, 0, len(ie.People))
+	seen := make(map[string]bool, len(ie.People))
+	for _, person := range ie.People {
+		if person.Name == "" || seen[person.Name] {
+			continue
+		}
+		seen[person.Name] = true
+		names = append(names, person.Name)
+	}
+	return names
+}
+
 func (i Items) GetItemByName(name string) ItemsElement {
 	for _, item := range i.ItemElements {
 		for item.Name == name {
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestItemMovieTitles(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		item ItemsElement
+		want []string
+	}{
+		{
+			"localized",
+			ItemsElement{Id: "a", Name: "Amelie", OriginalTitle: "Le Fabuleux Destin d'Amélie Poulain", SortName: "Fabuleux Destin d'Amélie Poulain"},
+			[]string{"Amelie", "Le Fabuleux Destin d'Amélie Poulain", "Fabuleux Destin d'Amélie Poulain"},
+		},
+		{
+			"repeats and blanks",
+			ItemsElement{Id: "b", Name: "Brazil", OriginalTitle: "Brazil", SortName: ""},
+			[]string{"Brazil"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			movie := test.item.Movie()
+			if movie.JellyfinId != test.item.Id || movie.Name != test.item.Name ||
+				movie.OriginalTitle != test.item.OriginalTitle || movie.SortName != test.item.SortName {
+				t.Fatalf("Movie() = %+v, want the item's id and titles", movie)
+			}
+			if titles := movie.Titles(); !slices.Equal(titles, test.want) {
+				t.Fatalf("Titles() = %q, want %q", titles, test.want)
+			}
+		})
+	}
+}
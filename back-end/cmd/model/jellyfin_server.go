@@ -0,0 +1,9 @@
+package model
+
+// JellyfinServer is a server that answered a discovery broadcast.
+type JellyfinServer struct {
+	Id              string `json:"Id"`
+	Name            string `json:"Name"`
+	Address         string `json:"Address"`
+	EndpointAddress string `json:"EndpointAddress"`
+}
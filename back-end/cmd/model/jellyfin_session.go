@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// JellyfinSession is the backend's own Jellyfin login as it is stored between
+// restarts. The access token is only ever kept encrypted.
+type JellyfinSession struct {
+	Host           string
+	Username       string
+	UserId         string
+	UserName       string
+	EncryptedToken []byte
+	UpdatedAt      time.Time
+}
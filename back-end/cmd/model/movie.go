@@ -1,5 +1,7 @@
 package model
 
+import "strconv"
+
 type MovieWithImage struct {
 	Movie      Movie
 	MovieImage MovieImage
@@ -11,9 +13,45 @@ type Movie struct {
 	Name            string
 	ProductionYear  int
 	CommunityRating float32
+	OriginalTitle   string
+	SortName        string
+	LibraryId       string
+	Overview        string
+	Genres          []string
+	People          []string
+	ProviderIds
 }
 
+// MovieImage is a movie's poster, whose bytes are kept in the blob store under
+// Hash, the hex SHA-256 of the bytes. Responses link to the poster endpoint by
+// Url rather than carrying the bytes; ImageData is only filled to store or
+// serve a poster, or for a movie not synced yet, which has no Url.
 type MovieImage struct {
-	MovieId   int
-	ImageData []byte
+	MovieId     int
+	ImageData   []byte `json:",omitempty"`
+	Hash        string
+	ContentType string
+	Width       int
+	Height      int
+	Url         string `json:",omitempty"`
+}
+
+// PosterPath is where the API serves the poster of the movie with id.
+func PosterPath(id int) string {
+	return "/movies/" + strconv.Itoa(id) + "/poster"
+}
+
+// Titles returns every name the movie is known by, without blanks or repeats.
+func (m Movie) Titles() []string {
+	candidates := []string{m.Name, m.OriginalTitle, m.SortName}
+	titles := make([]string, 0, len(candidates))
+	seen := make(map[string]bool, len(candidates))
+	for _, title := range candidates {
+		if title == "" || seen[title] {
+			continue
+		}
+		seen[title] = true
+		titles = append(titles, title)
+	}
+	return titles
 }
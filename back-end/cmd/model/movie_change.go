@@ -0,0 +1,90 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// PosterField names a replaced poster in a movie's change history.
+const PosterField = "poster"
+
+// FieldChange is one field a sync changed, with its value before and after.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old,omitempty"`
+	New   any    `json:"new,omitempty"`
+}
+
+// RecentlyUpdatedMovie is a movie whose metadata or poster changed recently,
+// with every field that changed.
+type RecentlyUpdatedMovie struct {
+	Movie         Movie
+	MovieImage    MovieImage
+	ChangedFields []string
+	LastChangedAt time.Time
+}
+
+// Changes lists the fields that differ between the stored movie and the
+// updated copy from Jellyfin, named after their columns.
+func (m Movie) Changes(updated Movie) []FieldChange {
+	var changes []FieldChange
+	add := func(field string, old, new any) {
+		changes = append(changes, FieldChange{Field: field, Old: old, New: new})
+	}
+	if m.Name != updated.Name {
+		add("title", m.Name, updated.Name)
+	}
+	if m.ProductionYear != updated.ProductionYear {
+		add("production_year", m.ProductionYear, updated.ProductionYear)
+	}
+	if m.CommunityRating != updated.CommunityRating {
+		add("community_rating", m.CommunityRating, updated.CommunityRating)
+	}
+	if m.OriginalTitle != updated.OriginalTitle {
+		add("original_title", m.OriginalTitle, updated.OriginalTitle)
+	}
+	if m.SortName != updated.SortName {
+		add("sort_name", m.SortName, updated.SortName)
+	}
+	if m.LibraryId != updated.LibraryId {
+		add("library_id", m.LibraryId, updated.LibraryId)
+	}
+	if m.Overview != updated.Overview {
+		add("overview", m.Overview, updated.Overview)
+	}
+	if !slices.Equal(m.Genres, updated.Genres) {
+		add("genres", m.Genres, updated.Genres)
+	}
+	if !slices.Equal(m.People, updated.People) {
+		add("people", m.People, updated.People)
+	}
+	if m.ImdbId != updated.ImdbId {
+		add("imdb_id", m.ImdbId, updated.ImdbId)
+	}
+	if m.TmdbId != updated.TmdbId {
+		add("tmdb_id", m.TmdbId, updated.TmdbId)
+	}
+	return changes
+}
+
+// MetadataHash is the hex SHA-256 of the fields Changes compares, so a sync
+// only has to read back the movies whose hash differs. Missing lists hash
+// like empty ones, as Changes treats them alike.
+func (m Movie) MetadataHash() string {
+	orEmpty := func(list []string) []string {
+		if list == nil {
+			return []string{}
+		}
+		return list
+	}
+	data, _ := json.Marshal([]any{
+		m.Name, m.ProductionYear, m.CommunityRating, m.OriginalTitle, m.SortName,
+		m.LibraryId, m.Overview, orEmpty(m.Genres), orEmpty(m.People),
+		m.ImdbId, m.TmdbId,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,24 @@
+package model
+
+// MovieFilter narrows the set of movies a query is drawn from. Unset fields
+// don't filter. AllowedJellyfinIds only applies when RestrictAccess is set, so
+// that a user with access to nothing is told apart from an unrestricted
+// caller, and PlayedJellyfinIds likewise only applies when Watched is set.
+type MovieFilter struct {
+	ExcludedJellyfinIds []string
+	RestrictAccess      bool
+	AllowedJellyfinIds  []string
+
+	YearFrom    *int
+	YearTo      *int
+	RatingFrom  *float32
+	RatingTo    *float32
+	Genres      []string
+	LibraryId   string
+	OnWatchlist *bool
+
+	// Watched keeps only the movies in PlayedJellyfinIds when true and only
+	// the others when false.
+	Watched           *bool
+	PlayedJellyfinIds []string
+}
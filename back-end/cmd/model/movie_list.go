@@ -0,0 +1,100 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// MovieSort names the column a movie listing is ordered by.
+type MovieSort string
+
+const (
+	SortByTitle  MovieSort = "title"
+	SortByYear   MovieSort = "year"
+	SortByRating MovieSort = "rating"
+	SortByAdded  MovieSort = "added"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// IsValid reports whether s is one of the supported sort orders.
+func (s MovieSort) IsValid() bool {
+	switch s {
+	case SortByTitle, SortByYear, SortByRating, SortByAdded:
+		return true
+	}
+	return false
+}
+
+// MovieListQuery asks for one page of the movie listing. After continues from
+// the page that ended with that cursor.
+type MovieListQuery struct {
+	Filter     MovieFilter
+	Sort       MovieSort
+	Descending bool
+	Limit      int
+	After      *MovieCursor
+}
+
+// MovieCursor marks the last movie of a page by its sort value and id, so the
+// next page starts right after it however the table changed in between. The
+// value is written as text: the title, an integer year, a decimal rating or
+// an RFC 3339 time for when the movie was added.
+type MovieCursor struct {
+	Sort       MovieSort `json:"s"`
+	Descending bool      `json:"d,omitempty"`
+	Value      string    `json:"v"`
+	Id         int       `json:"i"`
+}
+
+// MoviePage is one page of the movie listing. NextCursor is empty on the last
+// page.
+type MoviePage struct {
+	Movies     []MovieWithImage
+	NextCursor string
+}
+
+// Encode returns the cursor in the opaque form handed to clients.
+func (c MovieCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeMovieCursor reads a cursor produced by Encode.
+func DecodeMovieCursor(encoded string) (MovieCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return MovieCursor{}, ErrInvalidCursor
+	}
+	var cursor MovieCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || !cursor.Sort.IsValid() || !cursor.validValue() {
+		return MovieCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// validValue reports whether Value parses as the type the cursor sorts by.
+func (c MovieCursor) validValue() bool {
+	switch c.Sort {
+	case SortByYear:
+		_, err := strconv.Atoi(c.Value)
+		return err == nil
+	case SortByRating:
+		rating, err := strconv.ParseFloat(c.Value, 64)
+		return err == nil && !math.IsNaN(rating) && !math.IsInf(rating, 0)
+	case SortByAdded:
+		_, err := c.AddedAt()
+		return err == nil
+	default:
+		return true
+	}
+}
+
+// AddedAt is the value of a cursor sorted by when movies were added.
+func (c MovieCursor) AddedAt() (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, c.Value)
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestDecodeMovieCursor(t *testing.T) {
+	for _, cursor := range []MovieCursor{
+		{Sort: SortByTitle, Value: "alien", Id: 1},
+		{Sort: SortByYear, Value: "1979", Id: 2},
+		{Sort: SortByRating, Descending: true, Value: "8.5", Id: 3},
+		{Sort: SortByAdded, Value: "2024-05-01T12:30:00.123456Z", Id: 4},
+	} {
+		decoded, err := DecodeMovieCursor(cursor.Encode())
+		if err != nil || decoded != cursor {
+			t.Errorf("DecodeMovieCursor(%+v.Encode()) = %+v, %v", cursor, decoded, err)
+		}
+	}
+}
+
+func TestDecodeMovieCursorRejects(t *testing.T) {
+	raw := func(json string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(json))
+	}
+	for name, encoded := range map[string]string{
+		"not base64":         "!!!",
+		"not json":           raw("nope"),
+		"unknown sort":       raw(`{"s":"length","v":"90","i":1}`),
+		"year not a number":  raw(`{"s":"year","v":"abc","i":1}`),
+		"year not whole":     raw(`{"s":"year","v":"1979.5","i":1}`),
+		"rating not number":  raw(`{"s":"rating","v":"abc","i":1}`),
+		"rating not finite":  raw(`{"s":"rating","v":"NaN","i":1}`),
+		"added not a time":   raw(`{"s":"added","v":"yesterday","i":1}`),
+		"added without zone": raw(`{"s":"added","v":"2024-05-01 12:30:00","i":1}`),
+	} {
+		if cursor, err := DecodeMovieCursor(encoded); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: DecodeMovieCursor = %+v, %v, want ErrInvalidCursor", name, cursor, err)
+		}
+	}
+}
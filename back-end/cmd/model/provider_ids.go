@@ -0,0 +1,23 @@
+package model
+
+// ProviderIds are the external database ids a movie is known by.
+type ProviderIds struct {
+	ImdbId string
+	TmdbId string
+}
+
+func (p ProviderIds) IsEmpty() bool {
+	return p.ImdbId == "" && p.TmdbId == ""
+}
+
+// Matches compares the ids both sides have, preferring TMDb over IMDb. The
+// second result is false when there was no id in common to compare.
+func (p ProviderIds) Matches(other ProviderIds) (matched bool, compared bool) {
+	if p.TmdbId != "" && other.TmdbId != "" {
+		return p.TmdbId == other.TmdbId, true
+	}
+	if p.ImdbId != "" && other.ImdbId != "" {
+		return p.ImdbId == other.ImdbId, true
+	}
+	return false, false
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SearchQuery is a parsed movie search. Bare words must all match, "quoted
+// phrases" must match in order, a trailing * matches a prefix and a leading -
+// excludes the word or phrase.
+type SearchQuery struct {
+	Terms []SearchTerm
+}
+
+// SearchTerm is one word or phrase of a search. Words are lowercased and hold
+// only letters and digits.
+type SearchTerm struct {
+	Words   []string
+	Prefix  bool
+	Exclude bool
+}
+
+type MovieSearchResult struct {
+	Movie      Movie
+	MovieImage MovieImage
+	Rank       float32
+}
+
+// MovieSuggestion is an autocomplete candidate. Similarity runs from 0 to 1,
+// where 1 means the typed text appears in a title as is.
+type MovieSuggestion struct {
+	Movie      Movie
+	Similarity float32
+}
+
+// MovieSearchPage is one page of search results, best match first.
+type MovieSearchPage struct {
+	Results []MovieSearchResult
+	Total   int
+	Limit   int
+	Offset  int
+}
+
+// ParseSearchQuery splits raw into terms. The last bare word also matches as a
+// prefix so results show up while the user is still typing.
+func ParseSearchQuery(raw string) SearchQuery {
+	var query SearchQuery
+	lastBare := -1
+	for rest := strings.TrimSpace(raw); rest != ""; rest = strings.TrimSpace(rest) {
+		var term SearchTerm
+		if rest[0] == '-' {
+			term.Exclude = true
+			rest = rest[1:]
+		}
+
+		var text string
+		quoted := strings.HasPrefix(rest, `"`)
+		if quoted {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				text, rest = rest[1:], ""
+			} else {
+				text, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			text, rest = rest[:end], rest[end:]
+			term.Prefix = strings.HasSuffix(text, "*")
+		}
+
+		term.Words = searchWords(text)
+		if len(term.Words) == 0 {
+			continue
+		}
+		if !quoted && !term.Exclude {
+			lastBare = len(query.Terms)
+		}
+		query.Terms = append(query.Terms, term)
+	}
+	if lastBare >= 0 {
+		query.Terms[lastBare].Prefix = true
+	}
+	return query
+}
+
+// IsEmpty reports whether the query has nothing to match, which includes a
+// query made only of exclusions.
+func (q SearchQuery) IsEmpty() bool {
+	for _, term := range q.Terms {
+		if !term.Exclude {
+			return false
+		}
+	}
+	return true
+}
+
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -12,4 +12,5 @@ type WatchlistItem struct {
 	DateAdded     time.Time
 	DateReleased  time.Time
 	LetterboxdUri string
+	ProviderIds
 }
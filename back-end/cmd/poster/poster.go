@@ -0,0 +1,39 @@
+// Package poster inspects the poster images synced from Jellyfin.
+package poster
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+
+	_ "golang.org/x/image/webp"
+)
+
+// ErrUnreadable is returned for data that is not an image in a known format.
+var ErrUnreadable = errors.New("unreadable image")
+
+// Info is what is stored about an image besides its bytes.
+type Info struct {
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Describe works out the content type and dimensions of an image.
+func Describe(data []byte) (Info, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Info{}, fmt.Errorf("%w: %v", ErrUnreadable, err)
+	}
+	contentType := http.DetectContentType(data)
+	if format == "webp" {
+		// DetectContentType only learned WebP in recent Go versions.
+		contentType = "image/webp"
+	}
+	return Info{ContentType: contentType, Width: config.Width, Height: config.Height}, nil
+}
@@ -0,0 +1,104 @@
+package poster
+
+import (
+	"bytes"
+	"fmt"
+	"go-jellyfin-api/cmd/blob"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+)
+
+// Size is one of the widths a poster is rendered at.
+type Size string
+
+const (
+	SizeThumbnail Size = "thumbnail"
+	SizeCard      Size = "card"
+	SizeFull      Size = "full"
+)
+
+// maxWidths are the widths the sizes are scaled down to. Full keeps the
+// stored width, and no size scales an image up.
+var maxWidths = map[Size]int{
+	SizeThumbnail: 150,
+	SizeCard:      300,
+}
+
+func (s Size) IsValid() bool {
+	return s == SizeThumbnail || s == SizeCard || s == SizeFull
+}
+
+// Format is an encoding a poster is rendered in.
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+)
+
+func (f Format) IsValid() bool {
+	return f == FormatJPEG || f == FormatPNG
+}
+
+func (f Format) ContentType() string {
+	if f == FormatPNG {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// Variant is a poster rendered at a size in a format.
+type Variant struct {
+	Size   Size
+	Format Format
+}
+
+// jpegQuality trades a little detail for much smaller cards.
+const jpegQuality = 85
+
+// Key identifies the variant of the image stored under hash, for caching it
+// and as its ETag. It is derived from the original's hash, so a new poster
+// gets new variants. It is not a blob key: variants are never put in the image
+// store, where every key is the hash of the bytes stored under it.
+func (v Variant) Key(hash string) string {
+	return blob.Key([]byte(fmt.Sprintf("variant:%s:%s:%s", hash, v.Size, v.Format)))
+}
+
+// Render decodes the image and encodes it at the variant's size and format.
+func Render(data []byte, v Variant) ([]byte, Info, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, Info{}, fmt.Errorf("%w: %v", ErrUnreadable, err)
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if maxWidth, ok := maxWidths[v.Size]; ok && width > maxWidth {
+		height = max(1, height*maxWidth/width)
+		width = maxWidth
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if v.Format == FormatJPEG {
+		// JPEG has no transparency, so transparent posters go on white
+		// rather than black.
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	switch v.Format {
+	case FormatPNG:
+		err = png.Encode(&buf, dst)
+	default:
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: jpegQuality})
+	}
+	if err != nil {
+		return nil, Info{}, fmt.Errorf("encode %s: %w", v.Format, err)
+	}
+	return buf.Bytes(), Info{ContentType: v.Format.ContentType(), Width: width, Height: height}, nil
+}
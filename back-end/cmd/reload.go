@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go-jellyfin-api/cmd/config"
+	"go-jellyfin-api/cmd/logging"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// registerReloadHooks applies reloaded settings to the parts of the running
+// app that don't read the config store on every use. The Jellyfin login is
+// registered first because it is the only hook that can fail.
+func registerReloadHooks(app *AppConfig, scheduler *syncScheduler) {
+	app.Settings.OnReload(func(previous, next *config.Config) error {
+		// Session settings only matter at startup and shutdown, and the store
+		// reports a changed host as needing a restart, so neither counts.
+		previousJellyfin, nextJellyfin := previous.Jellyfin, next.Jellyfin
+		for _, settings := range []*config.JellyfinSettings{&previousJellyfin, &nextJellyfin} {
+			settings.Session = config.JellyfinSessionSettings{}
+			settings.Host, settings.ServerId = "", ""
+		}
+		if previousJellyfin == nextJellyfin {
+			return nil
+		}
+		// The host may have been discovered at startup, so the running one is
+		// kept rather than the configured one.
+		settings := next.Jellyfin
+		settings.Host = app.JellyfinConfig.GetHost()
+		jellyfinConfig, err := config.NewJellyfinConfiguration(settings)
+		if err != nil {
+			return fmt.Errorf("jellyfin configuration: %w", err)
+		}
+		if err := app.JellyfinSessions.Reconfigure(context.Background(), jellyfinConfig); err != nil {
+			return fmt.Errorf("jellyfin login with new credentials failed: %w", err)
+		}
+		log.Println("Config reload: Jellyfin connection settings updated")
+		return nil
+	})
+
+	app.Settings.OnReload(func(previous, next *config.Config) error {
+		if err := logging.SetLevel(next.Log.Level); err != nil {
+			return fmt.Errorf("log level: %w", err)
+		}
+		if previous.Sync.Interval != next.Sync.Interval {
+			scheduler.SetInterval(next.Sync.Interval)
+		}
+		return nil
+	})
+}
+
+// watchReloadSignal reloads the configuration every time the process gets
+// SIGHUP.
+func watchReloadSignal(store *config.Store) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		log.Println("Reloading configuration...")
+		if err := store.Reload(); err != nil {
+			log.Println(err)
+			continue
+		}
+		log.Println("Configuration reloaded")
+	}
+}
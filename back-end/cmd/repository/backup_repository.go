@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-jellyfin-api/cmd/model"
+	"time"
+)
+
+// ErrNotEmpty is returned by Import when the database already holds movies or
+// watchlist entries and the backup isn't to be merged into them.
+var ErrNotEmpty = errors.New("database is not empty")
+
+// BackupRepository reads and writes every table at once, for backups.
+type BackupRepository interface {
+	// Export reads every table as of one moment. Stored Jellyfin sessions are
+	// only included with sessions set, since they hold access tokens.
+	Export(ctx context.Context, sessions bool) (model.Backup, error)
+	// Import writes a backup as a whole, keeping its ids. Without merge it
+	// returns ErrNotEmpty unless the database holds no movies and no
+	// watchlist entries. With merge, rows with the same ids are overwritten,
+	// so importing a backup twice changes nothing, but rows that clash with
+	// the backup's on jellyfin_id or letterboxd_uri fail the import.
+	Import(ctx context.Context, backup model.Backup, merge bool) error
+}
+
+type backupRepository struct {
+	db *Database
+}
+
+func NewBackupRepository(db *Database) BackupRepository {
+	return &backupRepository{
+		db: db,
+	}
+}
+
+// Export reads the tables in one snapshot, which keeps a sync running
+// meanwhile from leaving them out of step with each other.
+func (b *backupRepository) Export(ctx context.Context, sessions bool) (model.Backup, error) {
+	d := b.db.dialect
+	backup := model.Backup{Format: model.BackupFormat, CreatedAt: time.Now().UTC(), Sessions: []model.BackupSession{}}
+	err := b.db.snapshot(ctx, func(ctx context.Context) error {
+		db := b.db.conn(ctx)
+		var err error
+		if backup.Movies, err = collect(ctx, db, `
+      SELECT m.id, m.jellyfin_id, m.title, m.production_year, m.community_rating, m.original_title,
+             m.sort_name, m.library_id, m.overview, m.genres, m.people, m.imdb_id,
+             m.tmdb_id, m.created_at, m.updated_at, m.deleted_at, mi.image_hash,
+             coalesce(mi.content_type, ''), coalesce(mi.width, 0), coalesce(mi.height, 0)
+      FROM movie m
+      LEFT JOIN movie_image mi ON m.id = mi.movie_id
+      ORDER BY m.id
+    `, func(rows Rows, movie *model.BackupMovie) error {
+			return scanBackupMovie(d, rows, movie)
+		}); err != nil {
+			return fmt.Errorf("export movies: %w", err)
+		}
+		if backup.MovieChanges, err = collect(ctx, db, `
+      SELECT id, movie_id, changed_fields, changes, changed_at FROM movie_change ORDER BY id
+    `, func(rows Rows, change *model.BackupMovieChange) error {
+			return rows.Scan(&change.Id, &change.MovieId, d.ScanList(&change.ChangedFields), d.ScanJSON(&change.Changes),
+				d.ScanTime(&change.ChangedAt))
+		}); err != nil {
+			return fmt.Errorf("export movie changes: %w", err)
+		}
+		if backup.Watchlist, err = collect(ctx, db, `
+      SELECT id, title, production_year, added_date, letterboxd_uri, imdb_id, tmdb_id FROM watchlist ORDER BY id
+    `, func(rows Rows, item *model.BackupWatchlistItem) error {
+			return rows.Scan(&item.Id, &item.Title, d.ScanTime(&item.DateReleased), d.ScanTime(&item.DateAdded),
+				&item.LetterboxdUri, &item.ImdbId, &item.TmdbId)
+		}); err != nil {
+			return fmt.Errorf("export watchlist: %w", err)
+		}
+		if backup.MovieWatchlist, err = collect(ctx, db, `
+      SELECT movie_id, watchlist_id, added_date FROM movie_watchlist ORDER BY movie_id, watchlist_id
+    `, func(rows Rows, pair *model.BackupMoviePair) error {
+			return rows.Scan(&pair.MovieId, &pair.WatchlistId, d.ScanTime(&pair.AddedDate))
+		}); err != nil {
+			return fmt.Errorf("export movie watchlist: %w", err)
+		}
+		if !sessions {
+			return nil
+		}
+		if backup.Sessions, err = collect(ctx, db, `
+      SELECT host, username, user_id, user_name, encrypted_token, updated_at FROM jellyfin_session ORDER BY host, username
+    `, func(rows Rows, session *model.BackupSession) error {
+			return rows.Scan(&session.Host, &session.Username, &session.UserId, &session.UserName,
+				&session.EncryptedToken, d.ScanTime(&session.UpdatedAt))
+		}); err != nil {
+			return fmt.Errorf("export sessions: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return model.Backup{}, err
+	}
+	return backup, nil
+}
+
+// scanBackupMovie reads a movie with its poster, if it has one in the blob
+// store. Posters still inline in the database are moved out at startup.
+func scanBackupMovie(d Dialect, rows Rows, movie *model.BackupMovie) error {
+	var imageHash *string
+	var image model.BackupImage
+	err := rows.Scan(
+		&movie.Id,
+		&movie.JellyfinId,
+		&movie.Name,
+		&movie.ProductionYear,
+		&movie.CommunityRating,
+		&movie.OriginalTitle,
+		&movie.SortName,
+		&movie.LibraryId,
+		&movie.Overview,
+		d.ScanList(&movie.Genres),
+		d.ScanList(&movie.People),
+		&movie.ImdbId,
+		&movie.TmdbId,
+		d.ScanTime(&movie.CreatedAt),
+		d.ScanTime(&movie.UpdatedAt),
+		d.ScanNullTime(&movie.DeletedAt),
+		&imageHash,
+		&image.ContentType,
+		&image.Width,
+		&image.Height,
+	)
+	if imageHash != nil {
+		image.Hash = *imageHash
+		movie.Image = &image
+	}
+	return err
+}
+
+func collect[T any](ctx context.Context, db Conn, query string, scan func(rows Rows, item *T) error) ([]T, error) {
+	rows, err := db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []T{}
+	for rows.Next() {
+		var item T
+		if err := scan(rows, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (b *backupRepository) Import(ctx context.Context, backup model.Backup, merge bool) error {
+	d := b.db.dialect
+	var statements []Statement
+	add := func(query string, p *Params) {
+		statements = append(statements, Statement{query, p.Args()})
+	}
+
+	// Restored movies get no metadata hash, so the next sync compares them in full.
+	for _, movie := range backup.Movies {
+		p := b.db.params()
+		add(`
+      INSERT INTO movie (id, jellyfin_id, title, production_year, community_rating, original_title, sort_name,
+                         library_id, overview, genres, people, imdb_id, tmdb_id, created_at, updated_at, deleted_at)
+      VALUES (`+p.AddAll(
+			movie.Id, movie.JellyfinId, movie.Name, movie.ProductionYear, movie.CommunityRating, movie.OriginalTitle,
+			movie.SortName, movie.LibraryId, movie.Overview, d.List(movie.Genres),
+			d.List(movie.People), movie.ImdbId, movie.TmdbId, d.Time(movie.CreatedAt), d.Time(movie.UpdatedAt),
+			d.NullTime(movie.DeletedAt),
+		)+`)
+      ON CONFLICT (id) DO UPDATE SET
+        jellyfin_id = excluded.jellyfin_id, title = excluded.title, production_year = excluded.production_year,
+        community_rating = excluded.community_rating, original_title = excluded.original_title,
+        sort_name = excluded.sort_name, library_id = excluded.library_id, overview = excluded.overview,
+        genres = excluded.genres,
+        people = excluded.people, imdb_id = excluded.imdb_id, tmdb_id = excluded.tmdb_id,
+        created_at = excluded.created_at, updated_at = excluded.updated_at, deleted_at = excluded.deleted_at,
+        metadata_hash = ''`, p)
+
+		p = b.db.params()
+		if movie.Image == nil {
+			add(`DELETE FROM movie_image WHERE movie_id = `+p.Add(movie.Id), p)
+			continue
+		}
+		clearInline := ""
+		if d.InlineImages() {
+			clearInline = "image_data = NULL, "
+		}
+		add(`
+      INSERT INTO movie_image (movie_id, image_hash, content_type, width, height)
+      VALUES (`+p.AddAll(movie.Id, movie.Image.Hash, movie.Image.ContentType, movie.Image.Width, movie.Image.Height)+`)
+      ON CONFLICT (movie_id) DO UPDATE SET
+        `+clearInline+`image_hash = excluded.image_hash, content_type = excluded.content_type,
+        width = excluded.width, height = excluded.height`, p)
+	}
+	for _, change := range backup.MovieChanges {
+		p := b.db.params()
+		add(`
+      INSERT INTO movie_change (id, movie_id, changed_fields, changes, changed_at)
+      VALUES (`+p.AddAll(change.Id, change.MovieId, d.List(change.ChangedFields), d.JSON(change.Changes), d.Time(change.ChangedAt))+`)
+      ON CONFLICT (id) DO NOTHING`, p)
+	}
+	for _, item := range backup.Watchlist {
+		p := b.db.params()
+		add(`
+      INSERT INTO watchlist (id, title, production_year, added_date, letterboxd_uri, imdb_id, tmdb_id)
+      VALUES (`+p.AddAll(item.Id, item.Title, d.Time(item.DateReleased), d.Time(item.DateAdded), item.LetterboxdUri, item.ImdbId, item.TmdbId)+`)
+      ON CONFLICT (id) DO UPDATE SET
+        title = excluded.title, production_year = excluded.production_year, added_date = excluded.added_date,
+        letterboxd_uri = excluded.letterboxd_uri, imdb_id = excluded.imdb_id, tmdb_id = excluded.tmdb_id`, p)
+	}
+	for _, pair := range backup.MovieWatchlist {
+		p := b.db.params()
+		add(`
+      INSERT INTO movie_watchlist (movie_id, watchlist_id, added_date)
+      VALUES (`+p.AddAll(pair.MovieId, pair.WatchlistId, d.Time(pair.AddedDate))+`)
+      ON CONFLICT (movie_id, watchlist_id) DO UPDATE SET added_date = excluded.added_date`, p)
+	}
+	for _, session := range backup.Sessions {
+		p := b.db.params()
+		add(`
+      INSERT INTO jellyfin_session (host, username, user_id, user_name, encrypted_token, updated_at)
+      VALUES (`+p.AddAll(session.Host, session.Username, session.UserId, session.UserName, session.EncryptedToken, d.Time(session.UpdatedAt))+`)
+      ON CONFLICT (host, username) DO UPDATE SET
+        user_id = excluded.user_id, user_name = excluded.user_name,
+        encrypted_token = excluded.encrypted_token, updated_at = excluded.updated_at`, p)
+	}
+	// The ids were written by hand, so the sequences are moved past them.
+	for _, query := range d.ResetSequences("movie", "movie_change", "watchlist") {
+		statements = append(statements, Statement{Query: query})
+	}
+
+	return b.db.Do(ctx, func(ctx context.Context) error {
+		if !merge {
+			var stored int
+			if err := b.db.conn(ctx).QueryRow(ctx, `
+        SELECT CASE WHEN EXISTS (SELECT 1 FROM movie) OR EXISTS (SELECT 1 FROM watchlist) THEN 1 ELSE 0 END
+      `).Scan(&stored); err != nil {
+				return fmt.Errorf("check database is empty: %w", err)
+			}
+			if stored != 0 {
+				return ErrNotEmpty
+			}
+		}
+		if _, err := b.db.conn(ctx).Batch(ctx, statements); err != nil {
+			return fmt.Errorf("import backup: %w", err)
+		}
+		return nil
+	})
+}
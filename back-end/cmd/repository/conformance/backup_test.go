@@ -0,0 +1,225 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-jellyfin-api/cmd/model"
+	"go-jellyfin-api/cmd/repository"
+	"time"
+)
+
+func checkBackupRestore(ctx context.Context, r Repositories) error {
+	alien, err := withPoster(movieItem("a", "Alien", 1979, 8.5, "Horror"), 1)
+	if err != nil {
+		return err
+	}
+	heat, err := withPoster(movieItem("h", "Heat", 1995, 8.2, "Crime"), 2)
+	if err != nil {
+		return err
+	}
+	if err := populate(ctx, r, "first sync", alien, heat, movieItem("r", "Rear Window", 1954, 8.5)); err != nil {
+		return err
+	}
+	alien.CommunityRating = 8.6
+	if err := populate(ctx, r, "second sync", alien, heat); err != nil {
+		return err
+	}
+	watchlist := model.Watchlist{WatchlistItems: []model.WatchlistItem{
+		watchlistItem("w1", "Alien", 1979),
+		watchlistItem("w2", "Tokyo Story", 1953),
+	}}
+	if err := r.Watchlist.PopulateDatabase(ctx, watchlist); err != nil {
+		return err
+	}
+	ids, err := movieIds(ctx, r)
+	if err != nil {
+		return err
+	}
+	entries, err := r.Watchlist.GetAllWatchlist(ctx)
+	if err != nil {
+		return err
+	}
+	pair := model.MovieWatchlistPair{MovieId: ids["a"], WatchlistId: entries[0].Id, AddedDate: entries[0].DateAdded}
+	if err := r.MovieWatchlist.InsertPairs(ctx, []model.MovieWatchlistPair{pair}); err != nil {
+		return err
+	}
+	session := model.JellyfinSession{Host: "http://jellyfin", Username: "alice", UserId: "1", UserName: "Alice", EncryptedToken: []byte{1, 2, 3}}
+	if err := r.Session.SaveSession(ctx, session); err != nil {
+		return err
+	}
+
+	withoutSessions, err := r.Backup.Export(ctx, false)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	if err := expect(len(withoutSessions.Sessions) == 0, "exported %d sessions without asking for them", len(withoutSessions.Sessions)); err != nil {
+		return err
+	}
+	backup, err := r.Backup.Export(ctx, true)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	if err := checkBackupContents(backup); err != nil {
+		return err
+	}
+
+	restored, err := r.fresh()
+	if err != nil {
+		return err
+	}
+	if err := restored.Backup.Import(ctx, backup, false); err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	if err := restored.Backup.Import(ctx, backup, true); err != nil {
+		return fmt.Errorf("importing again: %w", err)
+	}
+	again, err := restored.Backup.Export(ctx, true)
+	if err != nil {
+		return fmt.Errorf("export after import: %w", err)
+	}
+	if err := sameBackup(again, backup, "restored store"); err != nil {
+		return err
+	}
+
+	// New rows carry on after the restored ids instead of reusing them.
+	if err := populate(ctx, restored, "sync after restore", alien, heat, movieItem("s", "Stalker", 1979, 8.1)); err != nil {
+		return err
+	}
+	restoredIds, err := movieIds(ctx, restored)
+	if err != nil {
+		return err
+	}
+	for _, movie := range backup.Movies {
+		if err := expect(restoredIds["s"] > movie.Id, "a movie added after the restore got id %d, not past restored id %d", restoredIds["s"], movie.Id); err != nil {
+			return err
+		}
+	}
+	return expect(restoredIds["a"] == ids["a"] && restoredIds["h"] == ids["h"], "restored movies got ids %v, want %v", restoredIds, ids)
+}
+
+// checkBackupContents checks the export holds every table the check wrote.
+func checkBackupContents(backup model.Backup) error {
+	var archived, posters int
+	for _, movie := range backup.Movies {
+		if movie.DeletedAt != nil {
+			archived++
+		}
+		if movie.Image != nil {
+			posters++
+		}
+	}
+	return errors.Join(
+		expect(backup.Format == model.BackupFormat, "got format %d, want %d", backup.Format, model.BackupFormat),
+		expect(len(backup.Movies) == 3, "exported %d movies, want 3 with the archived one", len(backup.Movies)),
+		expect(archived == 1, "exported %d archived movies, want 1", archived),
+		expect(posters == 2, "exported %d posters, want 2", posters),
+		expect(len(backup.MovieChanges) == 1, "exported %d movie changes, want 1", len(backup.MovieChanges)),
+		expect(len(backup.Watchlist) == 2, "exported %d watchlist entries, want 2", len(backup.Watchlist)),
+		expect(len(backup.MovieWatchlist) == 1, "exported %d pairs, want 1", len(backup.MovieWatchlist)),
+		expect(len(backup.Sessions) == 1, "exported %d sessions, want 1", len(backup.Sessions)),
+	)
+}
+
+// sameBackup compares two backups as JSON, leaving out when they were taken.
+func sameBackup(got, want model.Backup, what string) error {
+	gotJson, err := backupJson(got)
+	if err != nil {
+		return err
+	}
+	wantJson, err := backupJson(want)
+	if err != nil {
+		return err
+	}
+	return expect(bytes.Equal(gotJson, wantJson), "%s exports\n%s\nwant\n%s", what, gotJson, wantJson)
+}
+
+// backupJson renders the backup without its creation time. The change lists
+// are decoded so their formatting doesn't count.
+func backupJson(backup model.Backup) ([]byte, error) {
+	backup.CreatedAt = time.Time{}
+	changes := make([]model.BackupMovieChange, len(backup.MovieChanges))
+	for i, change := range backup.MovieChanges {
+		var decoded []model.FieldChange
+		if err := json.Unmarshal(change.Changes, &decoded); err == nil {
+			change.Changes, _ = json.Marshal(decoded)
+		}
+		changes[i] = change
+	}
+	backup.MovieChanges = changes
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encode backup: %w", err)
+	}
+	return data, nil
+}
+
+func checkBackupConflict(ctx context.Context, r Repositories) error {
+	if err := populate(ctx, r, "sync", movieItem("a", "Alien", 1979, 8.5)); err != nil {
+		return err
+	}
+	if err := r.Watchlist.PopulateDatabase(ctx, model.Watchlist{WatchlistItems: []model.WatchlistItem{watchlistItem("w1", "Alien", 1979)}}); err != nil {
+		return err
+	}
+	backup, err := r.Backup.Export(ctx, true)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+
+	clashingMovie := backup
+	clashingMovie.Movies = []model.BackupMovie{backup.Movies[0]}
+	clashingMovie.Movies[0].Id += 100
+	clashingMovie.Movies[0].Name = "Aliens"
+	if err := expect(r.Backup.Import(ctx, clashingMovie, true) != nil, "importing another movie with a stored jellyfin id succeeded"); err != nil {
+		return err
+	}
+	clashingEntry := backup
+	clashingEntry.Watchlist = []model.BackupWatchlistItem{backup.Watchlist[0]}
+	clashingEntry.Watchlist[0].Id += 100
+	if err := expect(r.Backup.Import(ctx, clashingEntry, true) != nil, "importing another watchlist entry with a stored letterboxd uri succeeded"); err != nil {
+		return err
+	}
+
+	after, err := r.Backup.Export(ctx, true)
+	if err != nil {
+		return fmt.Errorf("export after failed imports: %w", err)
+	}
+	return sameBackup(after, backup, "store after failed imports")
+}
+
+func checkBackupNotEmpty(ctx context.Context, r Repositories) error {
+	if err := populate(ctx, r, "sync", movieItem("a", "Alien", 1979, 8.5)); err != nil {
+		return err
+	}
+	backup, err := r.Backup.Export(ctx, false)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	backup.Movies[0].Name = "Aliens"
+	if err := r.Backup.Import(ctx, backup, false); !errors.Is(err, repository.ErrNotEmpty) {
+		return fmt.Errorf("importing over stored movies returned %v, want ErrNotEmpty", err)
+	}
+	after, err := r.Backup.Export(ctx, false)
+	if err != nil {
+		return fmt.Errorf("export after refused import: %w", err)
+	}
+	if err := expect(after.Movies[0].Name == "Alien", "a refused import renamed the movie to %q", after.Movies[0].Name); err != nil {
+		return err
+	}
+
+	// A session saved by starting the backend doesn't stand in the way.
+	restored, err := r.fresh()
+	if err != nil {
+		return err
+	}
+	session := model.JellyfinSession{Host: "http://jellyfin", Username: "alice", UserId: "1", UserName: "Alice", EncryptedToken: []byte{1, 2, 3}}
+	if err := restored.Session.SaveSession(ctx, session); err != nil {
+		return err
+	}
+	if err := restored.Backup.Import(ctx, backup, false); err != nil {
+		return fmt.Errorf("import next to a stored session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Package conformance checks that a set of repositories behaves like the
+// Postgres ones, so every storage backend is held to the same contract. The
+// checks run against memory and SQLite, and against Postgres when
+// TEST_POSTGRES_URL is set.
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"go-jellyfin-api/cmd/blob"
+	"go-jellyfin-api/cmd/repository"
+	"testing"
+)
+
+// Repositories is the implementation under test.
+type Repositories struct {
+	UnitOfWork     repository.UnitOfWork
+	Movie          repository.MovieRepository
+	Watchlist      repository.WatchlistRepository
+	MovieWatchlist repository.MovieWatchlistRepository
+	Session        repository.SessionRepository
+	Backup         repository.BackupRepository
+
+	// fresh opens another empty store, for checks that need two.
+	fresh func() (Repositories, error)
+}
+
+// databaseRepositories are the SQL repositories on db, with posters kept in
+// memory.
+func databaseRepositories(db *repository.Database) Repositories {
+	return Repositories{
+		UnitOfWork:     repository.NewUnitOfWork(db),
+		Movie:          repository.NewMovieRepository(db, blob.NewMemoryStore()),
+		Watchlist:      repository.NewWatchlistRepository(db),
+		MovieWatchlist: repository.NewMovieWatchlistRepository(db),
+		Session:        repository.NewSessionRepository(db),
+		Backup:         repository.NewBackupRepository(db),
+	}
+}
+
+// openStore returns repositories on a fresh, empty store, released when the
+// test ends.
+type openStore func(t *testing.T) (Repositories, error)
+
+type check struct {
+	name string
+	run  func(ctx context.Context, r Repositories) error
+}
+
+var checks = []check{
+	{"movies are upserted by jellyfin id", checkMovieUpsert},
+	{"movies missing from a sync are archived and restored", checkMovieArchive},
+	{"an empty sync changes nothing", checkEmptySync},
+	{"changed fields are recorded", checkRecentlyUpdated},
+	{"posters are stored by hash", checkPosters},
+	{"filters narrow random picks", checkRandomFilter},
+	{"random picks don't favour movies after gaps", checkRandomUniform},
+	{"search matches words, phrases, prefixes and exclusions", checkSearch},
+	{"search and suggestions ignore accents", checkAccentedSearch},
+	{"suggestions tolerate typos", checkSuggest},
+	{"listing pages cover every movie once", checkListing},
+	{"watchlist entries are upserted by letterboxd uri", checkWatchlistUpsert},
+	{"movie watchlist pairs are kept once", checkPairs},
+	{"fuzzy pairs need the same year and a similar title", checkFuzzyPairs},
+	{"sessions are saved, replaced and deleted", checkSessions},
+	{"units of work commit or roll back as a whole", checkUnitOfWork},
+	{"backups restore into an empty store as they were", checkBackupRestore},
+	{"backups don't restore over clashing rows", checkBackupConflict},
+	{"backups only restore over stored rows when merged", checkBackupNotEmpty},
+}
+
+// runChecks runs every check as a subtest, each on a store of its own.
+func runChecks(t *testing.T, open openStore) {
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			r, err := open(t)
+			if err != nil {
+				t.Fatalf("open store: %v", err)
+			}
+			r.fresh = func() (Repositories, error) {
+				return open(t)
+			}
+			if err := c.run(ctx, r); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// expect returns an error built from format unless ok.
+func expect(ok bool, format string, args ...any) error {
+	if ok {
+		return nil
+	}
+	return fmt.Errorf(format, args...)
+}
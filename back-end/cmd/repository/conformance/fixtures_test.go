@@ -0,0 +1,118 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go-jellyfin-api/cmd/model"
+	"image"
+	"image/color"
+	"image/png"
+	"slices"
+	"time"
+)
+
+// movieItem is a movie as Jellyfin would return it.
+func movieItem(id, name string, year int, rating float32, genres ...string) model.ItemsElement {
+	return model.ItemsElement{
+		Name:            name,
+		SortName:        name,
+		Id:              id,
+		Type:            "Movie",
+		ProductionYear:  int16(year),
+		CommunityRating: rating,
+		Genres:          genres,
+		ProviderIds:     map[string]string{},
+		LibraryId:       "library",
+	}
+}
+
+func library(items ...model.ItemsElement) *model.Items {
+	return &model.Items{ItemElements: items}
+}
+
+// posterData is a small PNG whose content depends on shade, so different
+// shades hash differently.
+func posterData(shade uint8) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, 20, 30))
+	for x := 0; x < 20; x++ {
+		for y := 0; y < 30; y++ {
+			img.Set(x, y, color.RGBA{R: shade, G: 40, B: 80, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode poster: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func watchlistItem(uri, title string, year int) model.WatchlistItem {
+	return model.WatchlistItem{
+		Title:         title,
+		DateReleased:  time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC),
+		DateAdded:     time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+		LetterboxdUri: uri,
+	}
+}
+
+// movieIds maps the synced movies' Jellyfin ids to their ids.
+func movieIds(ctx context.Context, r Repositories) (map[string]int, error) {
+	movies, err := r.Movie.GetAllMovies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]int, len(movies))
+	for _, movie := range movies {
+		ids[movie.JellyfinId] = movie.Id
+	}
+	return ids, nil
+}
+
+func jellyfinIds[T any](movies []T, movie func(T) model.Movie) []string {
+	ids := make([]string, 0, len(movies))
+	for _, m := range movies {
+		ids = append(ids, movie(m).JellyfinId)
+	}
+	return ids
+}
+
+// sameIds compares two lists of Jellyfin ids, ignoring their order.
+func sameIds(got, want []string) error {
+	got, want = slices.Sorted(slices.Values(got)), slices.Sorted(slices.Values(want))
+	return expect(slices.Equal(got, want), "got movies %v, want %v", got, want)
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func float32Ptr(v float32) *float32 {
+	return &v
+}
+
+// populate syncs the library and fails with the step it was for.
+// withPoster gives the item a generated poster.
+func withPoster(item model.ItemsElement, shade uint8) (model.ItemsElement, error) {
+	data, err := posterData(shade)
+	if err != nil {
+		return item, err
+	}
+	item.Image.ImageData = data
+	return item, nil
+}
+
+func populate(ctx context.Context, r Repositories, step string, items ...model.ItemsElement) error {
+	movies := library(items...)
+	if err := r.Movie.StoreImages(ctx, movies); err != nil {
+		return fmt.Errorf("%s: %w", step, err)
+	}
+	if err := r.Movie.PopulateMovieDatabase(ctx, movies); err != nil {
+		return fmt.Errorf("%s: %w", step, err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package conformance
+
+import (
+	"go-jellyfin-api/cmd/blob"
+	"go-jellyfin-api/cmd/repository/memory"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	runChecks(t, func(t *testing.T) (Repositories, error) {
+		db := memory.NewDatabase()
+		return Repositories{
+			UnitOfWork:     memory.NewUnitOfWork(db),
+			Movie:          memory.NewMovieRepository(db, blob.NewMemoryStore()),
+			Watchlist:      memory.NewWatchlistRepository(db),
+			MovieWatchlist: memory.NewMovieWatchlistRepository(db),
+			Session:        memory.NewSessionRepository(db),
+			Backup:         memory.NewBackupRepository(db),
+		}, nil
+	})
+}
@@ -0,0 +1,520 @@
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"go-jellyfin-api/cmd/blob"
+	"go-jellyfin-api/cmd/model"
+	"maps"
+	"slices"
+)
+
+func checkMovieUpsert(ctx context.Context, r Repositories) error {
+	if err := populate(ctx, r, "first sync", movieItem("a", "Alien", 1979, 8.5), movieItem("b", "Brazil", 1985, 7.5)); err != nil {
+		return err
+	}
+	before, err := movieIds(ctx, r)
+	if err != nil {
+		return err
+	}
+	if err := expect(len(before) == 2, "got %d movies after the first sync, want 2", len(before)); err != nil {
+		return err
+	}
+
+	if err := populate(ctx, r, "second sync", movieItem("a", "Aliens", 1986, 8.5), movieItem("b", "Brazil", 1985, 7.5)); err != nil {
+		return err
+	}
+	after, err := movieIds(ctx, r)
+	if err != nil {
+		return err
+	}
+	if err := expect(len(after) == 2 && after["a"] == before["a"], "the renamed movie was not updated in place: %v, then %v", before, after); err != nil {
+		return err
+	}
+	movie, err := r.Movie.GetMovieById(ctx, after["a"])
+	if err != nil {
+		return err
+	}
+	if err := expect(movie.Name == "Aliens" && movie.ProductionYear == 1986, "got %q (%d), want Aliens (1986)", movie.Name, movie.ProductionYear); err != nil {
+		return err
+	}
+	byName, err := r.Movie.GetMovieByName(ctx, "ALIENS")
+	if err != nil {
+		return err
+	}
+	if err := expect(byName != nil && byName.Id == after["a"], "looking up the new title ignoring case found %v", byName); err != nil {
+		return err
+	}
+	byName, err = r.Movie.GetMovieByName(ctx, "Alien")
+	if err != nil {
+		return err
+	}
+	return expect(byName == nil, "the old title still finds %v", byName)
+}
+
+func checkMovieArchive(ctx context.Context, r Repositories) error {
+	alien, brazil := movieItem("a", "Alien", 1979, 8.5), movieItem("b", "Brazil", 1985, 7.5)
+	if err := populate(ctx, r, "first sync", alien, brazil); err != nil {
+		return err
+	}
+	before, err := movieIds(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	if err := populate(ctx, r, "sync without brazil", alien); err != nil {
+		return err
+	}
+	after, err := movieIds(ctx, r)
+	if err != nil {
+		return err
+	}
+	if err := expect(len(after) == 1 && after["a"] != 0, "got movies %v, want only a", after); err != nil {
+		return err
+	}
+	if _, err := r.Movie.GetMovieById(ctx, before["b"]); err == nil {
+		return fmt.Errorf("the archived movie can still be read by id")
+	}
+	if _, err := r.Movie.GetMovieByJellyfinIdWithImage(ctx, "b"); err == nil {
+		return fmt.Errorf("the archived movie can still be read by jellyfin id")
+	}
+	byName, err := r.Movie.GetMovieByName(ctx, "Brazil")
+	if err != nil {
+		return err
+	}
+	if err := expect(byName == nil, "the archived movie is still found by name"); err != nil {
+		return err
+	}
+
+	if err := populate(ctx, r, "sync with brazil again", alien, brazil); err != nil {
+		return err
+	}
+	restored, err := movieIds(ctx, r)
+	if err != nil {
+		return err
+	}
+	return expect(len(restored) == 2 && restored["b"] == before["b"], "the returning movie was not restored under its id: %v, then %v", before, restored)
+}
+
+func checkEmptySync(ctx context.Context, r Repositories) error {
+	if err := populate(ctx, r, "first sync", movieItem("a", "Alien", 1979, 8.5)); err != nil {
+		return err
+	}
+	if err := populate(ctx, r, "empty sync"); err != nil {
+		return err
+	}
+	ids, err := movieIds(ctx, r)
+	if err != nil {
+		return err
+	}
+	return expect(len(ids) == 1, "got %d movies after an empty sync, want 1", len(ids))
+}
+
+func checkRecentlyUpdated(ctx context.Context, r Repositories) error {
+	alien, brazil := movieItem("a", "Alien", 1979, 8.5), movieItem("b", "Brazil", 1985, 7.5)
+	if err := populate(ctx, r, "first sync", alien, brazil); err != nil {
+		return err
+	}
+	recent, err := r.Movie.GetRecentlyUpdatedMovies(ctx, 10, model.MovieFilter{})
+	if err != nil {
+		return err
+	}
+	if err := expect(len(recent) == 0, "new movies count as updated: %v", recent); err != nil {
+		return err
+	}
+
+	alien.CommunityRating = 9.0
+	alien.Genres = []string{"Horror"}
+	alien, err = withPoster(alien, 1)
+	if err != nil {
+		return err
+	}
+	if err := populate(ctx, r, "second sync", alien, brazil); err != nil {
+		return err
+	}
+	recent, err = r.Movie.GetRecentlyUpdatedMovies(ctx, 10, model.MovieFilter{})
+	if err != nil {
+		return err
+	}
+	if err := expect(len(recent) == 1 && recent[0].Movie.JellyfinId == "a", "got updated movies %v, want only a", recent); err != nil {
+		return err
+	}
+	want := []string{"community_rating", "genres", model.PosterField}
+	fields := slices.Sorted(slices.Values(recent[0].ChangedFields))
+	if err := expect(slices.Equal(fields, want), "got changed fields %v, want %v", fields, want); err != nil {
+		return err
+	}
+	if err := expect(!recent[0].LastChangedAt.IsZero(), "the change has no time"); err != nil {
+		return err
+	}
+
+	if err := populate(ctx, r, "unchanged sync", alien, brazil); err != nil {
+		return err
+	}
+	again, err := r.Movie.GetRecentlyUpdatedMovies(ctx, 10, model.MovieFilter{})
+	if err != nil {
+		return err
+	}
+	if err := expect(len(again) == 1 && slices.Equal(again[0].ChangedFields, recent[0].ChangedFields) && again[0].LastChangedAt.Equal(recent[0].LastChangedAt),
+		"an unchanged sync recorded a change: %v, then %v", recent, again); err != nil {
+		return err
+	}
+
+	excluded, err := r.Movie.GetRecentlyUpdatedMovies(ctx, 10, model.MovieFilter{ExcludedJellyfinIds: []string{"a"}})
+	if err != nil {
+		return err
+	}
+	return expect(len(excluded) == 0, "the filter is ignored: %v", excluded)
+}
+
+func checkPosters(ctx context.Context, r Repositories) error {
+	alien, brazil := movieItem("a", "Alien", 1979, 8.5), movieItem("b", "Brazil", 1985, 7.5)
+	alien, err := withPoster(alien, 1)
+	if err != nil {
+		return err
+	}
+	if err := populate(ctx, r, "sync", alien, brazil); err != nil {
+		return err
+	}
+	ids, err := movieIds(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	image, err := r.Movie.GetMovieImage(ctx, ids["a"], model.MovieFilter{})
+	if err != nil {
+		return err
+	}
+	if err := expect(image != nil && image.Hash == blob.Key(alien.Image.ImageData), "got poster %v, want hash %s", image, blob.Key(alien.Image.ImageData)); err != nil {
+		return err
+	}
+	if err := expect(image.ContentType == "image/png" && image.Width == 20 && image.Height == 30,
+		"got %s %dx%d, want image/png 20x30", image.ContentType, image.Width, image.Height); err != nil {
+		return err
+	}
+	withImage, err := r.Movie.GetMovieByIdWithImage(ctx, ids["a"])
+	if err != nil {
+		return err
+	}
+	if err := expect(withImage.MovieImage.Url == model.PosterPath(ids["a"]) && withImage.MovieImage.ImageData == nil,
+		"got poster url %q with %d bytes, want %q without bytes", withImage.MovieImage.Url, len(withImage.MovieImage.ImageData), model.PosterPath(ids["a"])); err != nil {
+		return err
+	}
+	withoutImage, err := r.Movie.GetMovieByIdWithImage(ctx, ids["b"])
+	if err != nil {
+		return err
+	}
+	if err := expect(withoutImage.MovieImage.Url == "", "a movie without a poster links to %q", withoutImage.MovieImage.Url); err != nil {
+		return err
+	}
+
+	missing, err := r.Movie.GetMovieImage(ctx, ids["b"], model.MovieFilter{})
+	if err != nil {
+		return err
+	}
+	if err := expect(missing == nil, "a movie without a poster has %v", missing); err != nil {
+		return err
+	}
+	hidden, err := r.Movie.GetMovieImage(ctx, ids["a"], model.MovieFilter{RestrictAccess: true})
+	if err != nil {
+		return err
+	}
+	return expect(hidden == nil, "the poster of a filtered movie is returned")
+}
+
+func checkRandomFilter(ctx context.Context, r Repositories) error {
+	items := []model.ItemsElement{
+		movieItem("a", "Alien", 1979, 8.5, "Horror", "Science Fiction"),
+		movieItem("b", "Brazil", 1985, 7.5, "Comedy"),
+		movieItem("c", "Casablanca", 1942, 8.5, "Drama", "Romance"),
+		movieItem("d", "Dune", 2021, 8.0, "Science Fiction"),
+		movieItem("e", "Eraserhead", 1977, 7.0, "Horror"),
+	}
+	items[4].LibraryId = "other"
+	if err := populate(ctx, r, "sync", items...); err != nil {
+		return err
+	}
+
+	picked, err := r.Movie.GetRandomMovies(ctx, 2, model.MovieFilter{})
+	if err != nil {
+		return err
+	}
+	ids := jellyfinIds(picked, func(m model.MovieWithImage) model.Movie { return m.Movie })
+	if err := expect(len(ids) == 2 && ids[0] != ids[1], "got %v, want two different movies", ids); err != nil {
+		return err
+	}
+
+	filters := []struct {
+		name   string
+		filter model.MovieFilter
+		want   []string
+	}{
+		{"excluded", model.MovieFilter{ExcludedJellyfinIds: []string{"a", "b"}}, []string{"c", "d", "e"}},
+		{"allowed", model.MovieFilter{RestrictAccess: true, AllowedJellyfinIds: []string{"b"}}, []string{"b"}},
+		{"nothing allowed", model.MovieFilter{RestrictAccess: true}, nil},
+		{"years", model.MovieFilter{YearFrom: intPtr(1970), YearTo: intPtr(1985)}, []string{"a", "b", "e"}},
+		{"ratings", model.MovieFilter{RatingFrom: float32Ptr(8.0), RatingTo: float32Ptr(8.5)}, []string{"a", "c", "d"}},
+		{"genres", model.MovieFilter{Genres: []string{"horror", "science fiction"}}, []string{"a"}},
+		{"library", model.MovieFilter{LibraryId: "other"}, []string{"e"}},
+		{"watched", model.MovieFilter{Watched: boolPtr(true), PlayedJellyfinIds: []string{"c"}}, []string{"c"}},
+		{"unwatched", model.MovieFilter{Watched: boolPtr(false), PlayedJellyfinIds: []string{"c"}}, []string{"a", "b", "d", "e"}},
+	}
+	for _, f := range filters {
+		picked, err := r.Movie.GetRandomMovies(ctx, 10, f.filter)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+		ids := jellyfinIds(picked, func(m model.MovieWithImage) model.Movie { return m.Movie })
+		if err := sameIds(ids, f.want); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+func checkRandomUniform(ctx context.Context, r Repositories) error {
+	// Only the first and the last of many movies match, leaving a wide gap
+	// between them that must not make the last one more likely.
+	var items []model.ItemsElement
+	var excluded []string
+	for i := 0; i < 30; i++ {
+		id := fmt.Sprintf("m%02d", i)
+		items = append(items, movieItem(id, "Movie "+id, 2000, 7.0))
+		if i > 0 && i < 29 {
+			excluded = append(excluded, id)
+		}
+	}
+	if err := populate(ctx, r, "sync", items...); err != nil {
+		return err
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 200; i++ {
+		picked, err := r.Movie.GetRandomMovies(ctx, 1, model.MovieFilter{ExcludedJellyfinIds: excluded})
+		if err != nil {
+			return err
+		}
+		for _, id := range jellyfinIds(picked, func(m model.MovieWithImage) model.Movie { return m.Movie }) {
+			counts[id]++
+		}
+	}
+	return expect(counts["m00"] >= 60 && counts["m29"] >= 60 && counts["m00"]+counts["m29"] == 200,
+		"got %v out of 200 picks, want about as many of each", counts)
+}
+
+func checkSearch(ctx context.Context, r Repositories) error {
+	alien := movieItem("a", "Alien", 1979, 8.5, "Horror")
+	alien.Overview = "The crew of a space tug meets a deadly creature."
+	alien.People = []model.ItemPerson{{Name: "Sigourney Weaver"}}
+	spaceballs := movieItem("s", "Spaceballs", 1987, 7.0, "Comedy")
+	spaceballs.Overview = "A parody of space operas."
+	tug := movieItem("t", "Tug of War", 2010, 6.0, "Drama")
+	tug.Overview = "Two brothers fall out."
+	if err := populate(ctx, r, "sync", alien, spaceballs, tug); err != nil {
+		return err
+	}
+
+	searches := []struct {
+		query string
+		want  []string
+	}{
+		{"alien", []string{"a"}},
+		{"weaver", []string{"a"}},
+		{"space", []string{"a", "s"}},
+		{"spaceb", []string{"s"}},
+		{`"space tug"`, []string{"a"}},
+		{"tug -space", []string{"t"}},
+		{"comedy", []string{"s"}},
+		{"nothing", nil},
+	}
+	for _, s := range searches {
+		page, err := r.Movie.SearchMovies(ctx, model.ParseSearchQuery(s.query), 10, 0, model.MovieFilter{})
+		if err != nil {
+			return fmt.Errorf("search %s: %w", s.query, err)
+		}
+		ids := jellyfinIds(page.Results, func(m model.MovieSearchResult) model.Movie { return m.Movie })
+		if err := sameIds(ids, s.want); err != nil {
+			return fmt.Errorf("search %s: %w", s.query, err)
+		}
+		if err := expect(page.Total == len(s.want), "search %s: got total %d, want %d", s.query, page.Total, len(s.want)); err != nil {
+			return err
+		}
+	}
+
+	// A title match ranks above a match in the overview.
+	page, err := r.Movie.SearchMovies(ctx, model.ParseSearchQuery("tug"), 10, 0, model.MovieFilter{})
+	if err != nil {
+		return err
+	}
+	ids := jellyfinIds(page.Results, func(m model.MovieSearchResult) model.Movie { return m.Movie })
+	if err := expect(slices.Equal(ids, []string{"t", "a"}), "search tug ranked %v, want [t a]", ids); err != nil {
+		return err
+	}
+	page, err = r.Movie.SearchMovies(ctx, model.ParseSearchQuery("tug"), 10, 1, model.MovieFilter{})
+	if err != nil {
+		return err
+	}
+	ids = jellyfinIds(page.Results, func(m model.MovieSearchResult) model.Movie { return m.Movie })
+	return expect(page.Total == 2 && slices.Equal(ids, []string{"a"}), "the second page of tug is %v of %d, want [a] of 2", ids, page.Total)
+}
+
+func checkAccentedSearch(ctx context.Context, r Repositories) error {
+	amelie := movieItem("a", "Amélie", 2001, 8.3, "Comedy")
+	amelie.People = []model.ItemPerson{{Name: "Jean-Pierre Jeunet"}}
+	kaerlighed := movieItem("k", "Kærlighed på film", 2007, 6.5, "Drama")
+	kaerlighed.People = []model.ItemPerson{{Name: "Søren Kragh-Jacobsen"}}
+	if err := populate(ctx, r, "sync", amelie, kaerlighed); err != nil {
+		return err
+	}
+
+	searches := []struct {
+		query string
+		want  []string
+	}{
+		{"amelie", []string{"a"}},
+		{"AMÉLIE", []string{"a"}},
+		{"amé*", []string{"a"}},
+		{"kaerlighed", []string{"k"}},
+		{"kærlighed", []string{"k"}},
+		{`"pa film"`, []string{"k"}},
+		{"soren", []string{"k"}},
+		{"film -amelie", []string{"k"}},
+	}
+	for _, s := range searches {
+		page, err := r.Movie.SearchMovies(ctx, model.ParseSearchQuery(s.query), 10, 0, model.MovieFilter{})
+		if err != nil {
+			return fmt.Errorf("search %s: %w", s.query, err)
+		}
+		ids := jellyfinIds(page.Results, func(m model.MovieSearchResult) model.Movie { return m.Movie })
+		if err := sameIds(ids, s.want); err != nil {
+			return fmt.Errorf("search %s: %w", s.query, err)
+		}
+	}
+
+	suggestions, err := r.Movie.SuggestMovies(ctx, "amelie", 5, model.MovieFilter{})
+	if err != nil {
+		return err
+	}
+	ids := jellyfinIds(suggestions, func(s model.MovieSuggestion) model.Movie { return s.Movie })
+	return expect(slices.Equal(ids, []string{"a"}), "suggestions for amelie are %v, want [a]", ids)
+}
+
+func checkSuggest(ctx context.Context, r Repositories) error {
+	if err := populate(ctx, r, "sync",
+		movieItem("m", "The Matrix", 1999, 8.5),
+		movieItem("h", "Heat", 1995, 8.5),
+	); err != nil {
+		return err
+	}
+	suggestions, err := r.Movie.SuggestMovies(ctx, "matrx", 5, model.MovieFilter{})
+	if err != nil {
+		return err
+	}
+	ids := jellyfinIds(suggestions, func(s model.MovieSuggestion) model.Movie { return s.Movie })
+	if err := expect(slices.Equal(ids, []string{"m"}), "matrx suggested %v, want [m]", ids); err != nil {
+		return err
+	}
+	if err := expect(suggestions[0].Similarity > 0 && suggestions[0].Similarity <= 1, "got similarity %v", suggestions[0].Similarity); err != nil {
+		return err
+	}
+	hidden, err := r.Movie.SuggestMovies(ctx, "matrx", 5, model.MovieFilter{ExcludedJellyfinIds: []string{"m"}})
+	if err != nil {
+		return err
+	}
+	return expect(len(hidden) == 0, "the filter is ignored: %v", hidden)
+}
+
+func checkListing(ctx context.Context, r Repositories) error {
+	if err := populate(ctx, r, "sync",
+		movieItem("a", "Alien", 1979, 8.5),
+		movieItem("b", "Brazil", 1985, 7.5),
+		movieItem("c", "Casablanca", 1942, 8.5),
+		movieItem("d", "Dune", 2021, 8.0),
+		movieItem("e", "Eraserhead", 1977, 7.0),
+	); err != nil {
+		return err
+	}
+	orders := []struct {
+		sort       model.MovieSort
+		descending bool
+		want       []string
+	}{
+		{model.SortByTitle, false, []string{"a", "b", "c", "d", "e"}},
+		{model.SortByTitle, true, []string{"e", "d", "c", "b", "a"}},
+		{model.SortByYear, false, []string{"c", "e", "a", "b", "d"}},
+		{model.SortByYear, true, []string{"d", "b", "a", "e", "c"}},
+		{model.SortByRating, false, []string{"e", "b", "d", "a", "c"}},
+		{model.SortByRating, true, []string{"c", "a", "d", "b", "e"}},
+	}
+	ids, err := movieIds(ctx, r)
+	if err != nil {
+		return err
+	}
+	for _, o := range orders {
+		want := o.want
+		// Ties are broken by id, in the same direction.
+		if o.sort == model.SortByRating {
+			want = tieBreak(want, ids, o.descending)
+		}
+		got, err := listAll(ctx, r, model.MovieListQuery{Sort: o.sort, Descending: o.descending, Limit: 2})
+		if err != nil {
+			return fmt.Errorf("sort %s: %w", o.sort, err)
+		}
+		if err := expect(slices.Equal(got, want), "sort %s descending=%v listed %v, want %v", o.sort, o.descending, got, want); err != nil {
+			return err
+		}
+	}
+
+	// The movies were added in the order of their ids, within one sync. The
+	// cursor carries the time through every page.
+	added, err := listAll(ctx, r, model.MovieListQuery{Sort: model.SortByAdded, Limit: 2})
+	if err != nil {
+		return fmt.Errorf("sort %s: %w", model.SortByAdded, err)
+	}
+	byId := slices.SortedFunc(maps.Keys(ids), func(a, b string) int { return ids[a] - ids[b] })
+	if err := expect(slices.Equal(added, byId), "sort %s listed %v, want %v", model.SortByAdded, added, byId); err != nil {
+		return err
+	}
+
+	filtered, err := listAll(ctx, r, model.MovieListQuery{Sort: model.SortByTitle, Limit: 2, Filter: model.MovieFilter{YearFrom: intPtr(1979)}})
+	if err != nil {
+		return err
+	}
+	return expect(slices.Equal(filtered, []string{"a", "b", "d"}), "the filtered listing is %v, want [a b d]", filtered)
+}
+
+// tieBreak orders the movies rated 8.5, a and c, by their ids.
+func tieBreak(want []string, ids map[string]int, descending bool) []string {
+	a, c := slices.Index(want, "a"), slices.Index(want, "c")
+	first, second := "a", "c"
+	if (ids["a"] > ids["c"]) != descending {
+		first, second = "c", "a"
+	}
+	ordered := slices.Clone(want)
+	ordered[min(a, c)], ordered[max(a, c)] = first, second
+	return ordered
+}
+
+// listAll follows the cursors through every page of the listing.
+func listAll(ctx context.Context, r Repositories, query model.MovieListQuery) ([]string, error) {
+	var ids []string
+	for pages := 0; pages < 10; pages++ {
+		page, err := r.Movie.ListMovies(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		if len(page.Movies) > query.Limit {
+			return nil, fmt.Errorf("got a page of %d movies, want at most %d", len(page.Movies), query.Limit)
+		}
+		ids = append(ids, jellyfinIds(page.Movies, func(m model.MovieWithImage) model.Movie { return m.Movie })...)
+		if page.NextCursor == "" {
+			return ids, nil
+		}
+		cursor, err := model.DecodeMovieCursor(page.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+		query.After = &cursor
+	}
+	return nil, fmt.Errorf("the listing did not end after 10 pages: %v", ids)
+}
@@ -0,0 +1,82 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-jellyfin-api/cmd/repository"
+	"go-jellyfin-api/db"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TestPostgres runs the checks on the Postgres server at TEST_POSTGRES_URL.
+// Every check creates a database of its own there and drops it afterwards;
+// the database in the URL is only used to issue those statements.
+func TestPostgres(t *testing.T) {
+	serverUrl := os.Getenv("TEST_POSTGRES_URL")
+	if serverUrl == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	ctx := context.Background()
+	admin, err := pgx.Connect(ctx, serverUrl)
+	if err != nil {
+		t.Fatalf("connect to TEST_POSTGRES_URL: %v", err)
+	}
+	defer admin.Close(ctx)
+
+	runChecks(t, func(t *testing.T) (Repositories, error) {
+		name := fmt.Sprintf("conformance_%d", time.Now().UnixNano())
+		if _, err := admin.Exec(ctx, "CREATE DATABASE "+name); err != nil {
+			return Repositories{}, fmt.Errorf("create database: %w", err)
+		}
+		t.Cleanup(func() {
+			if _, err := admin.Exec(ctx, "DROP DATABASE "+name); err != nil {
+				t.Errorf("drop database %s: %v", name, err)
+			}
+		})
+
+		databaseUrl, err := withDatabase(serverUrl, name)
+		if err != nil {
+			return Repositories{}, err
+		}
+		src, err := db.PostgresMigrations()
+		if err != nil {
+			return Repositories{}, err
+		}
+		m, err := migrate.NewWithSourceInstance("iofs", src, databaseUrl)
+		if err != nil {
+			return Repositories{}, err
+		}
+		err = m.Up()
+		m.Close()
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return Repositories{}, fmt.Errorf("migrate: %w", err)
+		}
+
+		pool, err := pgxpool.New(ctx, databaseUrl)
+		if err != nil {
+			return Repositories{}, err
+		}
+		// Registered after the drop, so it runs before it.
+		t.Cleanup(pool.Close)
+		return databaseRepositories(repository.NewPostgresDatabase(pool)), nil
+	})
+}
+
+// withDatabase points a Postgres URL at another database on the same server.
+func withDatabase(serverUrl, name string) (string, error) {
+	u, err := url.Parse(serverUrl)
+	if err != nil {
+		return "", fmt.Errorf("parse TEST_POSTGRES_URL: %w", err)
+	}
+	u.Path = "/" + name
+	return u.String(), nil
+}
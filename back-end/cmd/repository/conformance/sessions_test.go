@@ -0,0 +1,116 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go-jellyfin-api/cmd/model"
+)
+
+func checkSessions(ctx context.Context, r Repositories) error {
+	session, err := r.Session.GetSession(ctx, "http://jellyfin", "alice")
+	if err != nil {
+		return err
+	}
+	if err := expect(session == nil, "got a session before one was saved"); err != nil {
+		return err
+	}
+
+	saved := model.JellyfinSession{Host: "http://jellyfin", Username: "alice", UserId: "1", UserName: "Alice", EncryptedToken: []byte{1, 2, 3}}
+	if err := r.Session.SaveSession(ctx, saved); err != nil {
+		return err
+	}
+	saved.EncryptedToken = []byte{4, 5, 6}
+	if err := r.Session.SaveSession(ctx, saved); err != nil {
+		return errors.Join(errors.New("saving the session again"), err)
+	}
+	other := model.JellyfinSession{Host: "http://jellyfin", Username: "bob", UserId: "2", UserName: "Bob", EncryptedToken: []byte{7}}
+	if err := r.Session.SaveSession(ctx, other); err != nil {
+		return err
+	}
+
+	session, err = r.Session.GetSession(ctx, "http://jellyfin", "alice")
+	if err != nil {
+		return err
+	}
+	if err := expect(session != nil && session.UserId == "1" && session.UserName == "Alice" && bytes.Equal(session.EncryptedToken, []byte{4, 5, 6}),
+		"got session %+v, want the replaced one", session); err != nil {
+		return err
+	}
+	if err := expect(!session.UpdatedAt.IsZero(), "the session has no update time"); err != nil {
+		return err
+	}
+
+	if err := r.Session.DeleteSession(ctx, "http://jellyfin", "alice"); err != nil {
+		return err
+	}
+	session, err = r.Session.GetSession(ctx, "http://jellyfin", "alice")
+	if err != nil {
+		return err
+	}
+	if err := expect(session == nil, "the deleted session is still there"); err != nil {
+		return err
+	}
+	session, err = r.Session.GetSession(ctx, "http://jellyfin", "bob")
+	if err != nil {
+		return err
+	}
+	return expect(session != nil, "deleting one session deleted another")
+}
+
+func checkUnitOfWork(ctx context.Context, r Repositories) error {
+	failure := errors.New("failure")
+	err := r.UnitOfWork.Do(ctx, func(ctx context.Context) error {
+		if err := populate(ctx, r, "sync", movieItem("a", "Alien", 1979, 8.5)); err != nil {
+			return err
+		}
+		if err := r.Watchlist.PopulateDatabase(ctx, model.Watchlist{WatchlistItems: []model.WatchlistItem{watchlistItem("w1", "Alien", 1979)}}); err != nil {
+			return err
+		}
+		// Writes are visible inside the unit of work.
+		ids, err := movieIds(ctx, r)
+		if err != nil {
+			return err
+		}
+		if err := expect(len(ids) == 1, "the unit of work doesn't see its own write"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err := expect(errors.Is(err, failure), "got %v, want the error the unit of work failed with", err); err != nil {
+		return err
+	}
+	ids, err := movieIds(ctx, r)
+	if err != nil {
+		return err
+	}
+	watchlist, err := r.Watchlist.GetAllWatchlist(ctx)
+	if err != nil {
+		return err
+	}
+	if err := expect(len(ids) == 0 && len(watchlist) == 0, "the failed unit of work left %d movies and %d watchlist entries", len(ids), len(watchlist)); err != nil {
+		return err
+	}
+
+	err = r.UnitOfWork.Do(ctx, func(ctx context.Context) error {
+		if err := populate(ctx, r, "sync", movieItem("a", "Alien", 1979, 8.5)); err != nil {
+			return err
+		}
+		// A nested unit of work joins the outer one.
+		return r.UnitOfWork.Do(ctx, func(ctx context.Context) error {
+			return r.Watchlist.PopulateDatabase(ctx, model.Watchlist{WatchlistItems: []model.WatchlistItem{watchlistItem("w1", "Alien", 1979)}})
+		})
+	})
+	if err != nil {
+		return err
+	}
+	ids, err = movieIds(ctx, r)
+	if err != nil {
+		return err
+	}
+	watchlist, err = r.Watchlist.GetAllWatchlist(ctx)
+	if err != nil {
+		return err
+	}
+	return expect(len(ids) == 1 && len(watchlist) == 1, "the unit of work committed %d movies and %d watchlist entries, want 1 and 1", len(ids), len(watchlist))
+}
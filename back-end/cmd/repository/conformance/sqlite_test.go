@@ -0,0 +1,41 @@
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"go-jellyfin-api/cmd/repository/sqlite"
+	"go-jellyfin-api/db"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratesqlite "github.com/golang-migrate/migrate/v4/database/sqlite3"
+)
+
+func TestSQLite(t *testing.T) {
+	runChecks(t, func(t *testing.T) (Repositories, error) {
+		database, err := sqlite.Open(filepath.Join(t.TempDir(), "movies.db"))
+		if err != nil {
+			return Repositories{}, err
+		}
+		t.Cleanup(func() { database.Close() })
+
+		src, err := db.SQLiteMigrations()
+		if err != nil {
+			return Repositories{}, err
+		}
+		driver, err := migratesqlite.WithInstance(database, &migratesqlite.Config{})
+		if err != nil {
+			return Repositories{}, err
+		}
+		m, err := migrate.NewWithInstance("iofs", src, "sqlite3", driver)
+		if err != nil {
+			return Repositories{}, err
+		}
+		if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return Repositories{}, fmt.Errorf("migrate: %w", err)
+		}
+
+		return databaseRepositories(sqlite.NewDatabase(database)), nil
+	})
+}
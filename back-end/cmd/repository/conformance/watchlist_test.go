@@ -0,0 +1,173 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-jellyfin-api/cmd/model"
+	"slices"
+	"time"
+)
+
+func checkWatchlistUpsert(ctx context.Context, r Repositories) error {
+	first := watchlistItem("https://boxd.it/1", "Alien", 1979)
+	second := watchlistItem("https://boxd.it/2", "Brazil", 1985)
+	if err := r.Watchlist.PopulateDatabase(ctx, model.Watchlist{WatchlistItems: []model.WatchlistItem{first, second}}); err != nil {
+		return err
+	}
+
+	// The same entry again, now with an IMDb id and a different title.
+	renamed := first
+	renamed.Title = "Alien: Director's Cut"
+	renamed.ImdbId = "tt0078748"
+	if err := r.Watchlist.PopulateDatabase(ctx, model.Watchlist{WatchlistItems: []model.WatchlistItem{renamed}}); err != nil {
+		return err
+	}
+	// And once more without one, which must not clear it.
+	if err := r.Watchlist.PopulateDatabase(ctx, model.Watchlist{WatchlistItems: []model.WatchlistItem{first}}); err != nil {
+		return err
+	}
+
+	watchlist, err := r.Watchlist.GetAllWatchlist(ctx)
+	if err != nil {
+		return err
+	}
+	if err := expect(len(watchlist) == 2, "got %d watchlist entries, want 2", len(watchlist)); err != nil {
+		return err
+	}
+	i := slices.IndexFunc(watchlist, func(item model.WatchlistItem) bool { return item.LetterboxdUri == first.LetterboxdUri })
+	if err := expect(i >= 0, "the first entry is gone"); err != nil {
+		return err
+	}
+	stored := watchlist[i]
+	if err := expect(stored.Title == "Alien" && stored.ImdbId == "tt0078748",
+		"got %q with IMDb id %q, want the original title with the new id", stored.Title, stored.ImdbId); err != nil {
+		return err
+	}
+	return expect(stored.DateReleased.Year() == 1979 && stored.DateAdded.Equal(first.DateAdded),
+		"got released %s and added %s, want 1979 and %s", stored.DateReleased, stored.DateAdded, first.DateAdded)
+}
+
+// syncWatchlist stores the movies and watchlist entries and returns their ids
+// by Jellyfin id and Letterboxd URI.
+func syncWatchlist(ctx context.Context, r Repositories, movies []model.ItemsElement, entries []model.WatchlistItem) (map[string]int, map[string]int, error) {
+	if err := populate(ctx, r, "sync", movies...); err != nil {
+		return nil, nil, err
+	}
+	if err := r.Watchlist.PopulateDatabase(ctx, model.Watchlist{WatchlistItems: entries}); err != nil {
+		return nil, nil, err
+	}
+	ids, err := movieIds(ctx, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	watchlist, err := r.Watchlist.GetAllWatchlist(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	entryIds := make(map[string]int, len(watchlist))
+	for _, item := range watchlist {
+		entryIds[item.LetterboxdUri] = item.Id
+	}
+	return ids, entryIds, nil
+}
+
+func checkPairs(ctx context.Context, r Repositories) error {
+	if _, err := r.MovieWatchlist.GetRandomMovies(ctx, 5, model.MovieFilter{}); err == nil {
+		return errors.New("an empty watchlist gives no error")
+	}
+
+	movies, entries, err := syncWatchlist(ctx, r,
+		[]model.ItemsElement{movieItem("a", "Alien", 1979, 8.5), movieItem("b", "Brazil", 1985, 7.5), movieItem("c", "Casablanca", 1942, 8.5)},
+		[]model.WatchlistItem{watchlistItem("w1", "Alien", 1979), watchlistItem("w2", "Alien", 1979), watchlistItem("w3", "Brazil", 1985)},
+	)
+	if err != nil {
+		return err
+	}
+	early := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	late := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	pairs := []model.MovieWatchlistPair{
+		{MovieId: movies["a"], WatchlistId: entries["w1"], AddedDate: late},
+		{MovieId: movies["a"], WatchlistId: entries["w2"], AddedDate: early},
+		{MovieId: movies["b"], WatchlistId: entries["w3"], AddedDate: early},
+	}
+	if err := r.MovieWatchlist.InsertPairs(ctx, pairs); err != nil {
+		return err
+	}
+	// Inserting a pair again keeps the first one.
+	again := pairs[0]
+	again.AddedDate = early.Add(-time.Hour)
+	if err := r.MovieWatchlist.InsertPairs(ctx, []model.MovieWatchlistPair{again}); err != nil {
+		return fmt.Errorf("inserting a pair again: %w", err)
+	}
+
+	picked, err := r.MovieWatchlist.GetRandomMovies(ctx, 5, model.MovieFilter{})
+	if err != nil {
+		return err
+	}
+	if err := expect(len(picked) == 2, "got %d watchlist movies, want 2: %v", len(picked), picked); err != nil {
+		return err
+	}
+	for _, pair := range picked {
+		if pair.MovieId == movies["a"] {
+			if err := expect(pair.WatchlistId == entries["w2"] && pair.AddedDate.Equal(early),
+				"alien came with entry %d added %s, want the earliest entry %d", pair.WatchlistId, pair.AddedDate, entries["w2"]); err != nil {
+				return err
+			}
+		}
+	}
+
+	one, err := r.MovieWatchlist.GetRandomMovies(ctx, 1, model.MovieFilter{})
+	if err != nil {
+		return err
+	}
+	if err := expect(len(one) == 1, "asked for one watchlist movie, got %d", len(one)); err != nil {
+		return err
+	}
+	onWatchlist, err := r.Movie.GetRandomMovies(ctx, 10, model.MovieFilter{OnWatchlist: boolPtr(true)})
+	if err != nil {
+		return err
+	}
+	if err := sameIds(jellyfinIds(onWatchlist, func(m model.MovieWithImage) model.Movie { return m.Movie }), []string{"a", "b"}); err != nil {
+		return fmt.Errorf("on watchlist: %w", err)
+	}
+	filtered, err := r.MovieWatchlist.GetRandomMovies(ctx, 5, model.MovieFilter{ExcludedJellyfinIds: []string{"a"}})
+	if err != nil {
+		return err
+	}
+	return expect(len(filtered) == 1 && filtered[0].MovieId == movies["b"], "the filter is ignored: %v", filtered)
+}
+
+func checkFuzzyPairs(ctx context.Context, r Repositories) error {
+	matrix := movieItem("m", "The Matrix", 1999, 8.5)
+	heat := movieItem("h", "Heat", 1995, 8.5)
+	heat.ProviderIds["Tmdb"] = "949"
+	typo := watchlistItem("typo", "Matrix", 1999)
+	otherYear := watchlistItem("year", "Matrix", 2003)
+	unrelated := watchlistItem("unrelated", "Casablanca", 1999)
+	otherId := watchlistItem("id", "Heat", 1995)
+	otherId.TmdbId = "11"
+	movies, entries, err := syncWatchlist(ctx, r, []model.ItemsElement{matrix, heat}, []model.WatchlistItem{typo, otherYear, unrelated, otherId})
+	if err != nil {
+		return err
+	}
+
+	pairs, err := r.MovieWatchlist.FindFuzzyPairs(ctx, []int{entries["typo"], entries["year"], entries["unrelated"], entries["id"]}, 0.5)
+	if err != nil {
+		return err
+	}
+	if err := expect(len(pairs) == 1, "got fuzzy pairs %v, want only the typo", pairs); err != nil {
+		return err
+	}
+	pair := pairs[0]
+	if err := expect(pair.MovieId == movies["m"] && pair.WatchlistId == entries["typo"] && pair.AddedDate.Equal(typo.DateAdded),
+		"got pair %v, want movie %d with entry %d added %s", pair, movies["m"], entries["typo"], typo.DateAdded); err != nil {
+		return err
+	}
+
+	none, err := r.MovieWatchlist.FindFuzzyPairs(ctx, nil, 0.5)
+	if err != nil {
+		return err
+	}
+	return expect(len(none) == 0, "no entries gave pairs %v", none)
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrNoRows is returned when a query that reads one row finds none.
+var ErrNoRows = errors.New("no rows in result set")
+
+// Conn is what the repositories run their statements on: the database, or
+// the transaction of the unit of work they were called in.
+type Conn interface {
+	// Exec runs a statement and returns how many rows it affected.
+	Exec(ctx context.Context, query string, args ...any) (int64, error)
+	Query(ctx context.Context, query string, args ...any) (Rows, error)
+	// QueryRow reads one row, whose Scan returns ErrNoRows if there is none.
+	QueryRow(ctx context.Context, query string, args ...any) Row
+	// Batch runs the statements in order, in one round trip where the
+	// database allows it, and returns how many rows each affected.
+	Batch(ctx context.Context, statements []Statement) ([]int64, error)
+}
+
+type Rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+	Close()
+}
+
+type Row interface {
+	Scan(dest ...any) error
+}
+
+// Statement is one statement of a batch.
+type Statement struct {
+	Query string
+	Args  []any
+}
+
+// Tx is a transaction begun by a Driver. Rolling back a transaction that has
+// already been committed does nothing.
+type Tx interface {
+	Conn
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
+}
+
+// Driver connects the repositories to a database.
+type Driver interface {
+	Conn
+	// Begin starts a transaction. A snapshot transaction only reads, and sees
+	// every table as of one moment.
+	Begin(ctx context.Context, snapshot bool) (Tx, error)
+}
+
+// Database is a database the repositories run on, through its driver and in
+// its dialect of SQL. It is also the unit of work of those repositories.
+type Database struct {
+	driver  Driver
+	dialect Dialect
+}
+
+func NewDatabase(driver Driver, dialect Dialect) *Database {
+	return &Database{
+		driver:  driver,
+		dialect: dialect,
+	}
+}
+
+func NewUnitOfWork(db *Database) UnitOfWork {
+	return db
+}
+
+// UnitOfWork groups the writes of several repositories into one transaction.
+type UnitOfWork interface {
+	// Do runs fn in a transaction, committing it if fn succeeds and rolling
+	// it back otherwise. Repositories called with the context fn is given
+	// join the transaction. A Do inside another joins the outer transaction.
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txContextKey struct{}
+
+// txContext is the transaction a context carries, with the driver it was
+// begun on so repositories on another database don't join it.
+type txContext struct {
+	driver Driver
+	tx     Tx
+}
+
+func (d *Database) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return d.transaction(ctx, false, fn)
+}
+
+// snapshot runs fn in a read-only transaction that sees the tables as of one
+// moment, or in the unit of work ctx belongs to.
+func (d *Database) snapshot(ctx context.Context, fn func(ctx context.Context) error) error {
+	return d.transaction(ctx, true, fn)
+}
+
+func (d *Database) transaction(ctx context.Context, snapshot bool, fn func(ctx context.Context) error) error {
+	if _, ok := d.tx(ctx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := d.driver.Begin(ctx, snapshot)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	if err := fn(context.WithValue(ctx, txContextKey{}, txContext{driver: d.driver, tx: tx})); err != nil {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("roll back transaction: %w", rollbackErr))
+		}
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+var savepointCounter atomic.Uint64
+
+// savepoint runs fn so that, inside a unit of work, a failure only undoes what
+// fn wrote and the transaction can carry on. Outside a unit of work fn just
+// runs.
+func (d *Database) savepoint(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, ok := d.tx(ctx)
+	if !ok {
+		return fn(ctx)
+	}
+
+	name := fmt.Sprintf("sp_%d", savepointCounter.Add(1))
+	if _, err := tx.Exec(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("create savepoint: %w", err)
+	}
+	if err := fn(ctx); err != nil {
+		if _, rollbackErr := tx.Exec(ctx, "ROLLBACK TO SAVEPOINT "+name); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("roll back to savepoint: %w", rollbackErr))
+		}
+		if _, releaseErr := tx.Exec(ctx, "RELEASE SAVEPOINT "+name); releaseErr != nil {
+			return errors.Join(err, fmt.Errorf("release savepoint: %w", releaseErr))
+		}
+		return err
+	}
+	if _, err := tx.Exec(ctx, "RELEASE SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("release savepoint: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) tx(ctx context.Context) (Tx, bool) {
+	current, ok := ctx.Value(txContextKey{}).(txContext)
+	if !ok || current.driver != d.driver {
+		return nil, false
+	}
+	return current.tx, true
+}
+
+// conn returns the transaction of the unit of work ctx belongs to, if any,
+// and the database otherwise.
+func (d *Database) conn(ctx context.Context) Conn {
+	if tx, ok := d.tx(ctx); ok {
+		return tx
+	}
+	return d.driver
+}
+
+// params starts the arguments of a query.
+func (d *Database) params() *Params {
+	return &Params{dialect: d.dialect}
+}
+
+// Params collects a query's arguments, handing out a placeholder for each so
+// conditions can be put together in any order.
+type Params struct {
+	dialect Dialect
+	args    []any
+}
+
+// Add binds value and returns its placeholder.
+func (p *Params) Add(value any) string {
+	p.args = append(p.args, value)
+	return p.dialect.Placeholder(len(p.args))
+}
+
+// AddAll binds the values and returns their placeholders, separated by
+// commas.
+func (p *Params) AddAll(values ...any) string {
+	placeholders := make([]string, len(values))
+	for i, value := range values {
+		placeholders[i] = p.Add(value)
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+// Args are the values bound so far, in placeholder order.
+func (p *Params) Args() []any {
+	return p.args
+}
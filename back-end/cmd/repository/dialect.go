@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"encoding/json"
+	"go-jellyfin-api/cmd/model"
+	"time"
+)
+
+// Dialect writes the parts of the repositories' SQL that differ between
+// databases, and binds and scans the values whose types do.
+type Dialect interface {
+	// Placeholder is the placeholder of the nth argument, counting from one.
+	Placeholder(n int) string
+
+	// List binds a []string or []int, for a list column or for In.
+	List(values any) any
+	// ScanList scans a list column.
+	ScanList(target *[]string) any
+	// In matches expr against the list bound to the placeholder list.
+	In(expr, list string) string
+	// Elements is a table of the elements of a list column, aliased alias,
+	// with the element in its value column.
+	Elements(list, alias string) string
+	// OrderedIds is a table of the ids bound to the placeholder list, aliased
+	// alias, with the id in its value column and a position to order by.
+	OrderedIds(list, alias string) string
+
+	// Time binds a time and NullTime a nullable one.
+	Time(t time.Time) any
+	NullTime(t *time.Time) any
+	ScanTime(target *time.Time) any
+	ScanNullTime(target **time.Time) any
+	// JSON binds a JSON document.
+	JSON(data []byte) any
+	ScanJSON(target *json.RawMessage) any
+
+	// Now is the current time.
+	Now() string
+	// Year is the year of the timestamp expr, in UTC, as an integer.
+	Year(expr string) string
+	// Greatest is the function returning the largest of its arguments.
+	Greatest() string
+	// CursorType is the type a listing cursor's value is cast to for sort.
+	// Cursors by time are bound as times instead.
+	CursorType(sort model.MovieSort) string
+
+	// Search matches movie m against the full-text search, binding to p. It
+	// returns the FROM clause to search, the condition and the rank.
+	Search(query model.SearchQuery, p *Params) (from, condition, rank string)
+	// SimilarTitles and SimilarWords narrow a trigram similarity or word
+	// similarity comparison down with an index, if the database has one for
+	// it, before the similarity is computed. They return "" otherwise.
+	SimilarTitles(a, b string) string
+	SimilarWords(a, b string) string
+
+	// InlineImages tells whether movie_image still has the image_data column
+	// posters were stored in before they moved to the blob store.
+	InlineImages() bool
+	// ResetSequences returns the statements that move the id sequences of
+	// tables past ids written by hand.
+	ResetSequences(tables ...string) []string
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"go-jellyfin-api/cmd/blob"
+	"go-jellyfin-api/cmd/model"
+	"go-jellyfin-api/cmd/poster"
+)
+
+// StoreImage puts the image into the blob store, where identical images from
+// different movies end up as one blob, and describes it for movie_image.
+// Blobs are never deleted here because another movie may share them.
+func StoreImage(ctx context.Context, store blob.Store, data []byte) (model.MovieImage, error) {
+	info, err := poster.Describe(data)
+	if err != nil {
+		return model.MovieImage{}, err
+	}
+	key := blob.Key(data)
+	if err := store.Put(ctx, key, data, info.ContentType); err != nil {
+		return model.MovieImage{}, fmt.Errorf("store image: %w", err)
+	}
+	return model.MovieImage{
+		Hash:        key,
+		ContentType: info.ContentType,
+		Width:       info.Width,
+		Height:      info.Height,
+	}, nil
+}
+
+// LinkPoster points the image at the poster endpoint when the movie has a
+// poster, so responses don't have to carry the bytes.
+func LinkPoster(image *model.MovieImage) {
+	if image.Hash != "" {
+		image.Url = model.PosterPath(image.MovieId)
+	}
+}
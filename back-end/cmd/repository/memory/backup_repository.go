@@ -0,0 +1,238 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"go-jellyfin-api/cmd/model"
+	"go-jellyfin-api/cmd/repository"
+	"maps"
+	"slices"
+	"time"
+)
+
+type backupRepository struct {
+	db *Database
+}
+
+func NewBackupRepository(db *Database) repository.BackupRepository {
+	return &backupRepository{
+		db: db,
+	}
+}
+
+func (b *backupRepository) Export(ctx context.Context, sessions bool) (model.Backup, error) {
+	s := b.db.view(ctx)
+	backup := model.Backup{
+		Format:         model.BackupFormat,
+		CreatedAt:      time.Now().UTC(),
+		Movies:         []model.BackupMovie{},
+		MovieChanges:   []model.BackupMovieChange{},
+		Watchlist:      []model.BackupWatchlistItem{},
+		MovieWatchlist: []model.BackupMoviePair{},
+		Sessions:       []model.BackupSession{},
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(s.movies)) {
+		row := s.movies[id]
+		movie := copyMovie(row.movie)
+		exported := model.BackupMovie{
+			Id:              movie.Id,
+			JellyfinId:      movie.JellyfinId,
+			Name:            movie.Name,
+			ProductionYear:  movie.ProductionYear,
+			CommunityRating: movie.CommunityRating,
+			OriginalTitle:   movie.OriginalTitle,
+			SortName:        movie.SortName,
+			LibraryId:       movie.LibraryId,
+			Overview:        movie.Overview,
+			Genres:          movie.Genres,
+			People:          movie.People,
+			ImdbId:          movie.ImdbId,
+			TmdbId:          movie.TmdbId,
+			CreatedAt:       row.createdAt,
+			UpdatedAt:       row.updatedAt,
+			DeletedAt:       row.deletedAt,
+		}
+		if image, ok := s.images[id]; ok {
+			exported.Image = &model.BackupImage{
+				Hash:        image.Hash,
+				ContentType: image.ContentType,
+				Width:       image.Width,
+				Height:      image.Height,
+			}
+		}
+		backup.Movies = append(backup.Movies, exported)
+	}
+	for _, change := range s.changes {
+		backup.MovieChanges = append(backup.MovieChanges, model.BackupMovieChange{
+			Id:            change.id,
+			MovieId:       change.movieId,
+			ChangedFields: slices.Clone(change.fields),
+			Changes:       slices.Clone(change.changes),
+			ChangedAt:     change.changedAt,
+		})
+	}
+	for _, id := range slices.Sorted(maps.Keys(s.watchlist)) {
+		item := s.watchlist[id]
+		backup.Watchlist = append(backup.Watchlist, model.BackupWatchlistItem{
+			Id:            item.Id,
+			Title:         item.Title,
+			DateReleased:  item.DateReleased,
+			DateAdded:     item.DateAdded,
+			LetterboxdUri: item.LetterboxdUri,
+			ImdbId:        item.ImdbId,
+			TmdbId:        item.TmdbId,
+		})
+	}
+	for pair, added := range s.pairs {
+		backup.MovieWatchlist = append(backup.MovieWatchlist, model.BackupMoviePair{
+			MovieId:     pair.movieId,
+			WatchlistId: pair.watchlistId,
+			AddedDate:   added,
+		})
+	}
+	slices.SortFunc(backup.MovieWatchlist, func(a, b model.BackupMoviePair) int {
+		return cmp.Or(cmp.Compare(a.MovieId, b.MovieId), cmp.Compare(a.WatchlistId, b.WatchlistId))
+	})
+	if !sessions {
+		return backup, nil
+	}
+	for _, session := range s.sessions {
+		backup.Sessions = append(backup.Sessions, model.BackupSession{
+			Host:           session.Host,
+			Username:       session.Username,
+			UserId:         session.UserId,
+			UserName:       session.UserName,
+			EncryptedToken: slices.Clone(session.EncryptedToken),
+			UpdatedAt:      session.UpdatedAt,
+		})
+	}
+	slices.SortFunc(backup.Sessions, func(a, b model.BackupSession) int {
+		return cmp.Or(cmp.Compare(a.Host, b.Host), cmp.Compare(a.Username, b.Username))
+	})
+	return backup, nil
+}
+
+// Import checks the same constraints the database tables have: unique
+// jellyfin_id and letterboxd_uri, and pairs and changes only for rows that
+// exist.
+func (b *backupRepository) Import(ctx context.Context, backup model.Backup, merge bool) error {
+	return b.db.update(ctx, func(s *state) error {
+		if !merge && (len(s.movies) > 0 || len(s.watchlist) > 0) {
+			return repository.ErrNotEmpty
+		}
+		for _, movie := range backup.Movies {
+			if id, ok := s.movieIds[movie.JellyfinId]; ok && id != movie.Id {
+				return fmt.Errorf("import movie %d: jellyfin_id %s already belongs to movie %d", movie.Id, movie.JellyfinId, id)
+			}
+			if previous, ok := s.movies[movie.Id]; ok {
+				delete(s.movieIds, previous.movie.JellyfinId)
+			}
+			s.movies[movie.Id] = movieRow{
+				movie: copyMovie(model.Movie{
+					Id:              movie.Id,
+					JellyfinId:      movie.JellyfinId,
+					Name:            movie.Name,
+					ProductionYear:  movie.ProductionYear,
+					CommunityRating: movie.CommunityRating,
+					OriginalTitle:   movie.OriginalTitle,
+					SortName:        movie.SortName,
+					LibraryId:       movie.LibraryId,
+					Overview:        movie.Overview,
+					Genres:          nonNil(movie.Genres),
+					People:          nonNil(movie.People),
+					ProviderIds:     model.ProviderIds{ImdbId: movie.ImdbId, TmdbId: movie.TmdbId},
+				}),
+				createdAt: movie.CreatedAt,
+				updatedAt: movie.UpdatedAt,
+				deletedAt: movie.DeletedAt,
+			}
+			s.movieIds[movie.JellyfinId] = movie.Id
+			s.nextMovieId = max(s.nextMovieId, movie.Id)
+
+			if movie.Image == nil {
+				delete(s.images, movie.Id)
+				continue
+			}
+			s.images[movie.Id] = model.MovieImage{
+				MovieId:     movie.Id,
+				Hash:        movie.Image.Hash,
+				ContentType: movie.Image.ContentType,
+				Width:       movie.Image.Width,
+				Height:      movie.Image.Height,
+			}
+		}
+
+		changeIds := make(map[int]bool, len(s.changes))
+		for _, change := range s.changes {
+			changeIds[change.id] = true
+		}
+		for _, change := range backup.MovieChanges {
+			if changeIds[change.Id] {
+				continue
+			}
+			if _, ok := s.movies[change.MovieId]; !ok {
+				return fmt.Errorf("import movie change %d: movie %d does not exist", change.Id, change.MovieId)
+			}
+			s.changes = append(s.changes, movieChange{
+				id:        change.Id,
+				movieId:   change.MovieId,
+				fields:    slices.Clone(change.ChangedFields),
+				changes:   slices.Clone(change.Changes),
+				changedAt: change.ChangedAt,
+			})
+			changeIds[change.Id] = true
+			s.nextChangeId = max(s.nextChangeId, change.Id)
+		}
+		slices.SortFunc(s.changes, func(a, b movieChange) int { return cmp.Compare(a.id, b.id) })
+
+		for _, item := range backup.Watchlist {
+			if id, ok := s.watchlistIds[item.LetterboxdUri]; ok && id != item.Id {
+				return fmt.Errorf("import watchlist entry %d: letterboxd_uri %s already belongs to entry %d", item.Id, item.LetterboxdUri, id)
+			}
+			if previous, ok := s.watchlist[item.Id]; ok {
+				delete(s.watchlistIds, previous.LetterboxdUri)
+			}
+			s.watchlist[item.Id] = model.WatchlistItem{
+				Id:            item.Id,
+				Title:         item.Title,
+				DateAdded:     item.DateAdded,
+				DateReleased:  item.DateReleased,
+				LetterboxdUri: item.LetterboxdUri,
+				ProviderIds:   model.ProviderIds{ImdbId: item.ImdbId, TmdbId: item.TmdbId},
+			}
+			s.watchlistIds[item.LetterboxdUri] = item.Id
+			s.nextWatchlistId = max(s.nextWatchlistId, item.Id)
+		}
+
+		for _, pair := range backup.MovieWatchlist {
+			if _, ok := s.movies[pair.MovieId]; !ok {
+				return fmt.Errorf("import movie watchlist pair: movie %d does not exist", pair.MovieId)
+			}
+			if _, ok := s.watchlist[pair.WatchlistId]; !ok {
+				return fmt.Errorf("import movie watchlist pair: watchlist entry %d does not exist", pair.WatchlistId)
+			}
+			s.pairs[moviePair{movieId: pair.MovieId, watchlistId: pair.WatchlistId}] = pair.AddedDate
+		}
+
+		for _, session := range backup.Sessions {
+			s.sessions[sessionKey{host: session.Host, username: session.Username}] = model.JellyfinSession{
+				Host:           session.Host,
+				Username:       session.Username,
+				UserId:         session.UserId,
+				UserName:       session.UserName,
+				EncryptedToken: slices.Clone(session.EncryptedToken),
+				UpdatedAt:      session.UpdatedAt,
+			}
+		}
+		return nil
+	})
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
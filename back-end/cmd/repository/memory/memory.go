@@ -0,0 +1,177 @@
+// Package memory implements the repositories in memory, for tests and demo
+// mode. It behaves like the Postgres repositories, including their conflict
+// handling, but keeps nothing once the process exits.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"go-jellyfin-api/cmd/model"
+	"go-jellyfin-api/cmd/repository"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Database holds the tables the repositories share. Every write works on a
+// copy of the tables that replaces them once it succeeds, so readers never
+// see half a write and never wait for one. Writes take turns, and a unit of
+// work holds the turn until it ends, like a database write lock.
+type Database struct {
+	writeMu sync.Mutex
+	current atomic.Pointer[state]
+}
+
+func NewDatabase() *Database {
+	d := &Database{}
+	d.current.Store(&state{
+		movies:       make(map[int]movieRow),
+		movieIds:     make(map[string]int),
+		images:       make(map[int]model.MovieImage),
+		watchlist:    make(map[int]model.WatchlistItem),
+		watchlistIds: make(map[string]int),
+		pairs:        make(map[moviePair]time.Time),
+		sessions:     make(map[sessionKey]model.JellyfinSession),
+	})
+	return d
+}
+
+// state is one version of the tables. It is never changed once published.
+type state struct {
+	movies          map[int]movieRow
+	movieIds        map[string]int // by jellyfin_id
+	nextMovieId     int
+	images          map[int]model.MovieImage
+	changes         []movieChange
+	nextChangeId    int
+	watchlist       map[int]model.WatchlistItem
+	watchlistIds    map[string]int // by letterboxd_uri
+	nextWatchlistId int
+	pairs           map[moviePair]time.Time
+	sessions        map[sessionKey]model.JellyfinSession
+}
+
+type movieRow struct {
+	movie     model.Movie
+	createdAt time.Time
+	updatedAt time.Time
+	deletedAt *time.Time
+}
+
+func (r movieRow) active() bool {
+	return r.deletedAt == nil
+}
+
+type movieChange struct {
+	id        int
+	movieId   int
+	fields    []string
+	changes   json.RawMessage
+	changedAt time.Time
+}
+
+type moviePair struct {
+	movieId     int
+	watchlistId int
+}
+
+type sessionKey struct {
+	host     string
+	username string
+}
+
+// clone copies the maps so they can be written to. Rows are values whose
+// slices are replaced rather than modified, so they can be shared.
+func (s *state) clone() *state {
+	return &state{
+		movies:          maps.Clone(s.movies),
+		movieIds:        maps.Clone(s.movieIds),
+		nextMovieId:     s.nextMovieId,
+		images:          maps.Clone(s.images),
+		changes:         slices.Clip(s.changes),
+		nextChangeId:    s.nextChangeId,
+		watchlist:       maps.Clone(s.watchlist),
+		watchlistIds:    maps.Clone(s.watchlistIds),
+		nextWatchlistId: s.nextWatchlistId,
+		pairs:           maps.Clone(s.pairs),
+		sessions:        maps.Clone(s.sessions),
+	}
+}
+
+type txContextKey struct{}
+
+// transaction is a unit of work in progress: the tables as its writes left
+// them, published when it ends without an error.
+type transaction struct {
+	db    *Database
+	state *state
+}
+
+func (d *Database) transaction(ctx context.Context) (*transaction, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(*transaction)
+	if !ok || tx.db != d {
+		return nil, false
+	}
+	return tx, true
+}
+
+// view returns the tables as ctx sees them: with the writes of its unit of
+// work, if it belongs to one.
+func (d *Database) view(ctx context.Context) *state {
+	if tx, ok := d.transaction(ctx); ok {
+		return tx.state
+	}
+	return d.current.Load()
+}
+
+// update runs fn on a copy of the tables and keeps the copy if fn succeeds,
+// so a failed write changes nothing.
+func (d *Database) update(ctx context.Context, fn func(s *state) error) error {
+	if tx, ok := d.transaction(ctx); ok {
+		working := tx.state.clone()
+		if err := fn(working); err != nil {
+			return err
+		}
+		tx.state = working
+		return nil
+	}
+
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	working := d.current.Load().clone()
+	if err := fn(working); err != nil {
+		return err
+	}
+	d.current.Store(working)
+	return nil
+}
+
+type unitOfWork struct {
+	db *Database
+}
+
+// NewUnitOfWork runs units of work on db. Other writes wait until a unit of
+// work ends, so code inside one must pass its ctx on rather than start from
+// a fresh context.
+func NewUnitOfWork(db *Database) repository.UnitOfWork {
+	return &unitOfWork{
+		db: db,
+	}
+}
+
+func (u *unitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := u.db.transaction(ctx); ok {
+		return fn(ctx)
+	}
+
+	u.db.writeMu.Lock()
+	defer u.db.writeMu.Unlock()
+	tx := &transaction{db: u.db, state: u.db.current.Load()}
+	if err := fn(context.WithValue(ctx, txContextKey{}, tx)); err != nil {
+		return err
+	}
+	u.db.current.Store(tx.state)
+	return nil
+}
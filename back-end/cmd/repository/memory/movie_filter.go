@@ -0,0 +1,138 @@
+package memory
+
+import (
+	"go-jellyfin-api/cmd/model"
+	"go-jellyfin-api/cmd/repository"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// matchesFilter reports whether the filter lets the movie through. Movies
+// removed from Jellyfin never match.
+func (s *state) matchesFilter(row movieRow, filter model.MovieFilter) bool {
+	movie := row.movie
+	if !row.active() {
+		return false
+	}
+	if slices.Contains(filter.ExcludedJellyfinIds, movie.JellyfinId) {
+		return false
+	}
+	if filter.RestrictAccess && !slices.Contains(filter.AllowedJellyfinIds, movie.JellyfinId) {
+		return false
+	}
+	if filter.YearFrom != nil && movie.ProductionYear < *filter.YearFrom {
+		return false
+	}
+	if filter.YearTo != nil && movie.ProductionYear > *filter.YearTo {
+		return false
+	}
+	if filter.RatingFrom != nil && movie.CommunityRating < *filter.RatingFrom {
+		return false
+	}
+	if filter.RatingTo != nil && movie.CommunityRating > *filter.RatingTo {
+		return false
+	}
+	for _, genre := range filter.Genres {
+		if !slices.ContainsFunc(movie.Genres, func(g string) bool { return strings.EqualFold(g, genre) }) {
+			return false
+		}
+	}
+	if filter.LibraryId != "" && movie.LibraryId != filter.LibraryId {
+		return false
+	}
+	if filter.OnWatchlist != nil && s.onWatchlist(movie.Id) != *filter.OnWatchlist {
+		return false
+	}
+	if filter.Watched != nil && slices.Contains(filter.PlayedJellyfinIds, movie.JellyfinId) != *filter.Watched {
+		return false
+	}
+	return true
+}
+
+func (s *state) onWatchlist(movieId int) bool {
+	for pair := range s.pairs {
+		if pair.movieId == movieId {
+			return true
+		}
+	}
+	return false
+}
+
+// searchWeights are ts_rank's default weights for the parts of the Postgres
+// search vector: titles A, genres B, people C and the overview D.
+const (
+	weightA = 1.0
+	weightB = 0.4
+	weightC = 0.2
+	weightD = 0.1
+)
+
+type searchField struct {
+	words  []string
+	weight float64
+}
+
+// searchFields splits the movie into the words the Postgres search vector
+// holds: lowercased and without accents, as search_title folds them.
+func searchFields(movie model.Movie) []searchField {
+	return []searchField{
+		{searchWords(movie.Name), weightA},
+		{searchWords(movie.OriginalTitle), weightA},
+		{searchWords(strings.Join(movie.Genres, " ")), weightB},
+		{searchWords(strings.Join(movie.People, " ")), weightC},
+		{searchWords(movie.Overview), weightD},
+	}
+}
+
+func searchWords(text string) []string {
+	return strings.FieldsFunc(repository.SearchTitle(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchRank scores the movie against the query, or returns false when it
+// doesn't match: every included term has to be found and no excluded one.
+func searchRank(movie model.Movie, query model.SearchQuery) (float32, bool) {
+	fields := searchFields(movie)
+	rank := 0.0
+	for _, term := range query.Terms {
+		term.Words = searchWords(strings.Join(term.Words, " "))
+		hits := 0.0
+		for _, field := range fields {
+			hits += float64(countPhrase(field.words, term)) * field.weight
+		}
+		if term.Exclude {
+			if hits > 0 {
+				return 0, false
+			}
+			continue
+		}
+		if hits == 0 {
+			return 0, false
+		}
+		rank += hits
+	}
+	return float32(rank), true
+}
+
+// countPhrase counts where the term's words follow each other in words, the
+// last one only as a prefix for prefix terms.
+func countPhrase(words []string, term model.SearchTerm) int {
+	count := 0
+	for start := 0; start+len(term.Words) <= len(words); start++ {
+		matched := true
+		for i, word := range term.Words {
+			candidate := words[start+i]
+			last := i == len(term.Words)-1
+			if candidate != word && !(last && term.Prefix && strings.HasPrefix(candidate, word)) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			count++
+		}
+	}
+	return count
+}
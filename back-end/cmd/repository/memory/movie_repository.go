@@ -0,0 +1,466 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-jellyfin-api/cmd/blob"
+	"go-jellyfin-api/cmd/model"
+	"go-jellyfin-api/cmd/repository"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recentChangeWindow is how far back GetRecentlyUpdatedMovies looks, like the
+// recently_updated_movie view.
+const recentChangeWindow = 30 * 24 * time.Hour
+
+// errNotFound is returned by the getters that fail when nothing matches, as
+// pgx.ErrNoRows is by the Postgres repositories.
+var errNotFound = errors.New("not found")
+
+type movieRepository struct {
+	db     *Database
+	images blob.Store
+}
+
+func NewMovieRepository(db *Database, images blob.Store) repository.MovieRepository {
+	return &movieRepository{
+		db:     db,
+		images: images,
+	}
+}
+
+// copyMovie returns the movie with slices of its own, so neither the caller
+// nor the tables can change the other's copy.
+func copyMovie(movie model.Movie) model.Movie {
+	movie.Genres = slices.Clone(movie.Genres)
+	movie.People = slices.Clone(movie.People)
+	return movie
+}
+
+// movieWithImage joins in the movie's poster, whose bytes are read from the
+// blob store separately.
+func (s *state) movieWithImage(row movieRow) model.MovieWithImage {
+	image := s.images[row.movie.Id]
+	image.MovieId = row.movie.Id
+	repository.LinkPoster(&image)
+	return model.MovieWithImage{Movie: copyMovie(row.movie), MovieImage: image}
+}
+
+// activeMovies returns the movies the filter lets through, by id.
+func (s *state) activeMovies(filter model.MovieFilter) []movieRow {
+	var rows []movieRow
+	for _, row := range s.movies {
+		if s.matchesFilter(row, filter) {
+			rows = append(rows, row)
+		}
+	}
+	slices.SortFunc(rows, func(a, b movieRow) int { return cmp.Compare(a.movie.Id, b.movie.Id) })
+	return rows
+}
+
+// MigrateInlineImages has nothing to do: posters were never stored inline
+// here.
+func (m *movieRepository) MigrateInlineImages(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (m *movieRepository) GetMovieById(ctx context.Context, id int) (model.Movie, error) {
+	row, ok := m.db.view(ctx).movies[id]
+	if !ok || !row.active() {
+		return model.Movie{}, fmt.Errorf("movie %d: %w", id, errNotFound)
+	}
+	return copyMovie(row.movie), nil
+}
+
+func (m *movieRepository) GetMovieByIdWithImage(ctx context.Context, id int) (model.MovieWithImage, error) {
+	s := m.db.view(ctx)
+	row, ok := s.movies[id]
+	if !ok || !row.active() {
+		return model.MovieWithImage{}, fmt.Errorf("movie %d: %w", id, errNotFound)
+	}
+	return s.movieWithImage(row), nil
+}
+
+func (m *movieRepository) GetMovieByJellyfinIdWithImage(ctx context.Context, jellyfinId string) (model.MovieWithImage, error) {
+	id, ok := m.db.view(ctx).movieIds[jellyfinId]
+	if !ok {
+		return model.MovieWithImage{}, fmt.Errorf("movie %s: %w", jellyfinId, errNotFound)
+	}
+	return m.GetMovieByIdWithImage(ctx, id)
+}
+
+// GetMovieImage describes the poster of a movie the filter lets through, or
+// returns nil when the movie is unknown, filtered out or has no poster.
+func (m *movieRepository) GetMovieImage(ctx context.Context, id int, filter model.MovieFilter) (*model.MovieImage, error) {
+	s := m.db.view(ctx)
+	row, ok := s.movies[id]
+	if !ok || !s.matchesFilter(row, filter) {
+		return nil, nil
+	}
+	image, ok := s.images[id]
+	if !ok {
+		return nil, nil
+	}
+	image.MovieId = id
+	return &image, nil
+}
+
+// GetMovieByName looks the name up case-insensitively against the title, the
+// original title and the sort name. It returns nil when nothing matches.
+func (m *movieRepository) GetMovieByName(ctx context.Context, name string) (*model.Movie, error) {
+	name = strings.ToLower(name)
+	for _, row := range m.db.view(ctx).activeMovies(model.MovieFilter{}) {
+		movie := row.movie
+		names := []string{movie.Name, movie.OriginalTitle, movie.SortName}
+		if slices.ContainsFunc(names, func(n string) bool { return strings.ToLower(n) == name }) {
+			found := copyMovie(movie)
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *movieRepository) StoreImages(ctx context.Context, items *model.Items) error {
+	s := m.db.view(ctx)
+	for i := range items.ItemElements {
+		item := &items.ItemElements[i]
+		storedHash := s.images[s.movieIds[item.Id]].Hash
+		if err := repository.StoreItemImage(ctx, m.images, item, storedHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PopulateMovieDatabase upserts the movies fetched from Jellyfin by their
+// Jellyfin id, recording every changed field and replaced poster, and
+// soft-deletes every stored movie that wasn't among them. A movie that shows
+// up again is restored. An empty fetch leaves the tables alone. Posters are
+// only recorded once StoreImages has put them in the image store.
+func (m *movieRepository) PopulateMovieDatabase(ctx context.Context, items *model.Items) error {
+	if len(items.ItemElements) == 0 {
+		log.Println("Jellyfin returned no movies, skipping reconciliation")
+		return nil
+	}
+
+	updated, archived := 0, 0
+	err := m.db.update(ctx, func(s *state) error {
+		now := time.Now().UTC()
+		seen := make(map[string]bool, len(items.ItemElements))
+		for _, item := range items.ItemElements {
+			seen[item.Id] = true
+			movie := copyMovie(item.Movie())
+			id, exists := s.movieIds[item.Id]
+			image := item.Image
+			imageChanged := image.Hash != "" && image.Hash != s.images[id].Hash
+
+			if !exists {
+				s.nextMovieId++
+				movie.Id = s.nextMovieId
+				s.movies[movie.Id] = movieRow{movie: movie, createdAt: now, updatedAt: now}
+				s.movieIds[movie.JellyfinId] = movie.Id
+			} else {
+				previous := s.movies[id]
+				movie.Id = id
+				changes := previous.movie.Changes(movie)
+				if imageChanged {
+					changes = append(changes, model.FieldChange{Field: model.PosterField})
+				}
+				row := movieRow{movie: movie, createdAt: previous.createdAt, updatedAt: previous.updatedAt}
+				if len(changes) > 0 {
+					row.updatedAt = now
+					fields := make([]string, 0, len(changes))
+					for _, change := range changes {
+						fields = append(fields, change.Field)
+					}
+					changesJson, err := json.Marshal(changes)
+					if err != nil {
+						return fmt.Errorf("failed to marshal movie changes: %w", err)
+					}
+					s.nextChangeId++
+					s.changes = append(s.changes, movieChange{
+						id:        s.nextChangeId,
+						movieId:   id,
+						fields:    fields,
+						changes:   changesJson,
+						changedAt: now,
+					})
+					updated++
+				}
+				s.movies[id] = row
+			}
+
+			if imageChanged {
+				image.MovieId = movie.Id
+				image.ImageData = nil
+				s.images[movie.Id] = image
+			}
+		}
+
+		for id, row := range s.movies {
+			if row.active() && !seen[row.movie.JellyfinId] {
+				row.deletedAt = &now
+				s.movies[id] = row
+				archived++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if updated > 0 {
+		log.Printf("Updated %d movies changed in Jellyfin\n", updated)
+	}
+	if archived > 0 {
+		log.Printf("Archived %d movies no longer in Jellyfin\n", archived)
+	}
+	return nil
+}
+
+func (m *movieRepository) GetRandomMovies(ctx context.Context, numberOfMovies int, filter model.MovieFilter) ([]model.MovieWithImage, error) {
+	s := m.db.view(ctx)
+	rows := s.activeMovies(filter)
+	rand.Shuffle(len(rows), func(i, j int) { rows[i], rows[j] = rows[j], rows[i] })
+
+	var movies []model.MovieWithImage
+	for _, row := range rows[:min(numberOfMovies, len(rows))] {
+		movies = append(movies, s.movieWithImage(row))
+	}
+	return movies, nil
+}
+
+func (m *movieRepository) GetAllMovies(ctx context.Context) ([]model.Movie, error) {
+	var movies []model.Movie
+	for _, row := range m.db.view(ctx).activeMovies(model.MovieFilter{}) {
+		movies = append(movies, copyMovie(row.movie))
+	}
+	return movies, nil
+}
+
+// GetRecentlyUpdatedMovies returns the movies changed most recently, newest
+// change first.
+func (m *movieRepository) GetRecentlyUpdatedMovies(ctx context.Context, limit int, filter model.MovieFilter) ([]model.RecentlyUpdatedMovie, error) {
+	s := m.db.view(ctx)
+	since := time.Now().Add(-recentChangeWindow)
+	recent := make(map[int]*model.RecentlyUpdatedMovie)
+	for _, change := range s.changes {
+		if !change.changedAt.After(since) {
+			continue
+		}
+		row := s.movies[change.movieId]
+		if !s.matchesFilter(row, filter) {
+			continue
+		}
+		movie, ok := recent[change.movieId]
+		if !ok {
+			withImage := s.movieWithImage(row)
+			movie = &model.RecentlyUpdatedMovie{Movie: withImage.Movie, MovieImage: withImage.MovieImage}
+			recent[change.movieId] = movie
+		}
+		for _, field := range change.fields {
+			if !slices.Contains(movie.ChangedFields, field) {
+				movie.ChangedFields = append(movie.ChangedFields, field)
+			}
+		}
+		if change.changedAt.After(movie.LastChangedAt) {
+			movie.LastChangedAt = change.changedAt
+		}
+	}
+
+	movies := make([]model.RecentlyUpdatedMovie, 0, len(recent))
+	for _, movie := range recent {
+		slices.Sort(movie.ChangedFields)
+		movies = append(movies, *movie)
+	}
+	slices.SortFunc(movies, func(a, b model.RecentlyUpdatedMovie) int {
+		return cmp.Or(b.LastChangedAt.Compare(a.LastChangedAt), cmp.Compare(a.Movie.Id, b.Movie.Id))
+	})
+	movies = movies[:min(limit, len(movies))]
+	return movies, nil
+}
+
+// SearchMovies matches the query against titles, genres, people and the
+// overview the way the Postgres full-text search does, best ranked first.
+func (m *movieRepository) SearchMovies(ctx context.Context, query model.SearchQuery, limit, offset int, filter model.MovieFilter) (model.MovieSearchPage, error) {
+	page := model.MovieSearchPage{Results: []model.MovieSearchResult{}, Limit: limit, Offset: offset}
+
+	s := m.db.view(ctx)
+	var results []model.MovieSearchResult
+	for _, row := range s.activeMovies(filter) {
+		rank, ok := searchRank(row.movie, query)
+		if !ok {
+			continue
+		}
+		withImage := s.movieWithImage(row)
+		results = append(results, model.MovieSearchResult{Movie: withImage.Movie, MovieImage: withImage.MovieImage, Rank: rank})
+	}
+	slices.SortFunc(results, func(a, b model.MovieSearchResult) int {
+		return cmp.Or(
+			cmp.Compare(b.Rank, a.Rank),
+			cmp.Compare(a.Movie.SortName, b.Movie.SortName),
+			cmp.Compare(a.Movie.Id, b.Movie.Id),
+		)
+	})
+
+	page.Total = len(results)
+	if offset >= len(results) {
+		return page, nil
+	}
+	page.Results = results[offset:min(offset+limit, len(results))]
+	return page, nil
+}
+
+// suggestThreshold is pg_trgm's default word similarity threshold, which the
+// <% operator of the Postgres version applies.
+const suggestThreshold = 0.6
+
+// SuggestMovies finds the titles closest to text by trigram word similarity,
+// ignoring case and accents, so typos and partly typed titles still match.
+func (m *movieRepository) SuggestMovies(ctx context.Context, text string, limit int, filter model.MovieFilter) ([]model.MovieSuggestion, error) {
+	search := repository.SearchTitle(text)
+	suggestions := []model.MovieSuggestion{}
+	for _, row := range m.db.view(ctx).activeMovies(filter) {
+		similarity := max(
+			repository.WordSimilarity(search, repository.SearchTitle(row.movie.Name)),
+			repository.WordSimilarity(search, repository.SearchTitle(row.movie.OriginalTitle)),
+		)
+		if similarity < suggestThreshold {
+			continue
+		}
+		suggestions = append(suggestions, model.MovieSuggestion{Movie: copyMovie(row.movie), Similarity: float32(similarity)})
+	}
+	slices.SortFunc(suggestions, func(a, b model.MovieSuggestion) int {
+		return cmp.Or(
+			cmp.Compare(b.Similarity, a.Similarity),
+			cmp.Compare(a.Movie.SortName, b.Movie.SortName),
+			cmp.Compare(a.Movie.Id, b.Movie.Id),
+		)
+	})
+	return suggestions[:min(limit, len(suggestions))], nil
+}
+
+// sortKey is a movie's value for one sort order, compared against the
+// others' and written into cursors.
+type sortKey struct {
+	text   string
+	number float64
+	time   time.Time
+}
+
+func movieSortKey(row movieRow, sort model.MovieSort) (sortKey, error) {
+	switch sort {
+	case model.SortByTitle:
+		if row.movie.SortName != "" {
+			return sortKey{text: row.movie.SortName}, nil
+		}
+		return sortKey{text: strings.ToLower(row.movie.Name)}, nil
+	case model.SortByYear:
+		return sortKey{number: float64(row.movie.ProductionYear)}, nil
+	case model.SortByRating:
+		return sortKey{number: float64(row.movie.CommunityRating)}, nil
+	case model.SortByAdded:
+		return sortKey{time: row.createdAt}, nil
+	default:
+		return sortKey{}, fmt.Errorf("unknown sort order %q", sort)
+	}
+}
+
+func (k sortKey) compare(other sortKey) int {
+	return cmp.Or(cmp.Compare(k.text, other.text), cmp.Compare(k.number, other.number), k.time.Compare(other.time))
+}
+
+func (k sortKey) encode(sort model.MovieSort) string {
+	switch sort {
+	case model.SortByTitle:
+		return k.text
+	case model.SortByAdded:
+		return k.time.Format(time.RFC3339Nano)
+	default:
+		return strconv.FormatFloat(k.number, 'g', -1, 64)
+	}
+}
+
+func decodeSortKey(value string, sort model.MovieSort) (sortKey, error) {
+	switch sort {
+	case model.SortByTitle:
+		return sortKey{text: value}, nil
+	case model.SortByAdded:
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return sortKey{}, fmt.Errorf("%w: %v", model.ErrInvalidCursor, err)
+		}
+		return sortKey{time: parsed}, nil
+	default:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return sortKey{}, fmt.Errorf("%w: %v", model.ErrInvalidCursor, err)
+		}
+		return sortKey{number: parsed}, nil
+	}
+}
+
+// ListMovies returns one page of the filtered listing, continuing after the
+// cursor's sort value and id like the keyset pagination of the Postgres
+// version.
+func (m *movieRepository) ListMovies(ctx context.Context, query model.MovieListQuery) (model.MoviePage, error) {
+	type keyedRow struct {
+		row movieRow
+		key sortKey
+	}
+	s := m.db.view(ctx)
+	var rows []keyedRow
+	for _, row := range s.activeMovies(query.Filter) {
+		key, err := movieSortKey(row, query.Sort)
+		if err != nil {
+			return model.MoviePage{}, err
+		}
+		rows = append(rows, keyedRow{row: row, key: key})
+	}
+	compare := func(a keyedRow, key sortKey, id int) int {
+		order := cmp.Or(a.key.compare(key), cmp.Compare(a.row.movie.Id, id))
+		if query.Descending {
+			return -order
+		}
+		return order
+	}
+	slices.SortFunc(rows, func(a, b keyedRow) int { return compare(a, b.key, b.row.movie.Id) })
+
+	if query.After != nil {
+		after, err := decodeSortKey(query.After.Value, query.Sort)
+		if err != nil {
+			return model.MoviePage{}, err
+		}
+		start, _ := slices.BinarySearchFunc(rows, after, func(a keyedRow, key sortKey) int {
+			if compare(a, key, query.After.Id) <= 0 {
+				return -1
+			}
+			return 1
+		})
+		rows = rows[start:]
+	}
+
+	page := model.MoviePage{Movies: []model.MovieWithImage{}}
+	for i, keyed := range rows {
+		if i == query.Limit {
+			last := rows[i-1]
+			page.NextCursor = model.MovieCursor{
+				Sort:       query.Sort,
+				Descending: query.Descending,
+				Value:      last.key.encode(query.Sort),
+				Id:         last.row.movie.Id,
+			}.Encode()
+			break
+		}
+		page.Movies = append(page.Movies, s.movieWithImage(keyed.row))
+	}
+	return page, nil
+}
@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"go-jellyfin-api/cmd/model"
+	"go-jellyfin-api/cmd/repository"
+	"maps"
+	"math/rand/v2"
+	"slices"
+)
+
+type movieWatchlistRepository struct {
+	db *Database
+}
+
+func NewMovieWatchlistRepository(db *Database) repository.MovieWatchlistRepository {
+	return &movieWatchlistRepository{
+		db: db,
+	}
+}
+
+// InsertPairs adds the pairs, skipping the ones already stored.
+func (m *movieWatchlistRepository) InsertPairs(ctx context.Context, pairs []model.MovieWatchlistPair) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+	return m.db.update(ctx, func(s *state) error {
+		for _, pair := range pairs {
+			key := moviePair{movieId: pair.MovieId, watchlistId: pair.WatchlistId}
+			if _, exists := s.pairs[key]; !exists {
+				s.pairs[key] = pair.AddedDate
+			}
+		}
+		return nil
+	})
+}
+
+// GetRandomMovies samples distinct watchlisted movies; a movie paired with
+// several watchlist entries comes back once, with its earliest entry.
+func (m *movieWatchlistRepository) GetRandomMovies(ctx context.Context, noOfMovies int, filter model.MovieFilter) ([]model.MovieWatchlistPair, error) {
+	s := m.db.view(ctx)
+	earliest := make(map[int]model.MovieWatchlistPair)
+	for pair, addedDate := range s.pairs {
+		if !s.matchesFilter(s.movies[pair.movieId], filter) {
+			continue
+		}
+		candidate := model.MovieWatchlistPair{MovieId: pair.movieId, WatchlistId: pair.watchlistId, AddedDate: addedDate}
+		current, ok := earliest[pair.movieId]
+		if !ok || cmp.Or(addedDate.Compare(current.AddedDate), cmp.Compare(pair.watchlistId, current.WatchlistId)) < 0 {
+			earliest[pair.movieId] = candidate
+		}
+	}
+	if len(earliest) == 0 {
+		return nil, fmt.Errorf("no watchlist movies found")
+	}
+
+	movies := slices.Collect(maps.Values(earliest))
+	rand.Shuffle(len(movies), func(i, j int) { movies[i], movies[j] = movies[j], movies[i] })
+	return movies[:min(noOfMovies, len(movies))], nil
+}
+
+// FindFuzzyPairs pairs each of the watchlist entries with the movie from the
+// same year whose title is most similar, if any reaches threshold. Entries
+// whose provider ids rule a movie out are never paired with it.
+func (m *movieWatchlistRepository) FindFuzzyPairs(ctx context.Context, watchlistIds []int, threshold float32) ([]model.MovieWatchlistPair, error) {
+	s := m.db.view(ctx)
+	var pairs []model.MovieWatchlistPair
+	for _, id := range slices.Compact(slices.Sorted(slices.Values(watchlistIds))) {
+		item, ok := s.watchlist[id]
+		if !ok {
+			continue
+		}
+		title := repository.SearchTitle(item.Title)
+		best, bestScore := 0, 0.0
+		for _, row := range s.activeMovies(model.MovieFilter{}) {
+			movie := row.movie
+			if movie.ProductionYear != item.DateReleased.UTC().Year() {
+				continue
+			}
+			if (movie.TmdbId != "" && item.TmdbId != "") || (movie.ImdbId != "" && item.ImdbId != "") {
+				continue
+			}
+			score := max(
+				repository.Similarity(repository.SearchTitle(movie.Name), title),
+				repository.Similarity(repository.SearchTitle(movie.OriginalTitle), title),
+			)
+			if score >= float64(threshold) && score > bestScore {
+				best, bestScore = movie.Id, score
+			}
+		}
+		if best != 0 {
+			pairs = append(pairs, model.MovieWatchlistPair{MovieId: best, WatchlistId: id, AddedDate: item.DateAdded})
+		}
+	}
+	return pairs, nil
+}
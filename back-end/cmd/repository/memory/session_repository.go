@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"go-jellyfin-api/cmd/model"
+	"go-jellyfin-api/cmd/repository"
+	"slices"
+	"time"
+)
+
+type sessionRepository struct {
+	db *Database
+}
+
+func NewSessionRepository(db *Database) repository.SessionRepository {
+	return &sessionRepository{
+		db: db,
+	}
+}
+
+// GetSession returns the stored session for the account on the server, or nil
+// when there is none.
+func (s *sessionRepository) GetSession(ctx context.Context, host, username string) (*model.JellyfinSession, error) {
+	session, ok := s.db.view(ctx).sessions[sessionKey{host: host, username: username}]
+	if !ok {
+		return nil, nil
+	}
+	session.EncryptedToken = slices.Clone(session.EncryptedToken)
+	return &session, nil
+}
+
+func (s *sessionRepository) SaveSession(ctx context.Context, session model.JellyfinSession) error {
+	return s.db.update(ctx, func(st *state) error {
+		session.EncryptedToken = slices.Clone(session.EncryptedToken)
+		session.UpdatedAt = time.Now().UTC()
+		st.sessions[sessionKey{host: session.Host, username: session.Username}] = session
+		return nil
+	})
+}
+
+func (s *sessionRepository) DeleteSession(ctx context.Context, host, username string) error {
+	return s.db.update(ctx, func(st *state) error {
+		delete(st.sessions, sessionKey{host: host, username: username})
+		return nil
+	})
+}
@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"context"
+	"go-jellyfin-api/cmd/model"
+	"go-jellyfin-api/cmd/repository"
+	"maps"
+	"slices"
+)
+
+type watchlistRepository struct {
+	db *Database
+}
+
+func NewWatchlistRepository(db *Database) repository.WatchlistRepository {
+	return &watchlistRepository{
+		db: db,
+	}
+}
+
+// PopulateDatabase upserts the entries by their Letterboxd URI. An entry that
+// is already stored only takes the IMDb and TMDb ids it didn't have.
+func (w *watchlistRepository) PopulateDatabase(ctx context.Context, items model.Watchlist) error {
+	if len(items.WatchlistItems) == 0 {
+		return nil
+	}
+	return w.db.update(ctx, func(s *state) error {
+		for _, item := range items.WatchlistItems {
+			id, exists := s.watchlistIds[item.LetterboxdUri]
+			if !exists {
+				s.nextWatchlistId++
+				item.Id = s.nextWatchlistId
+				s.watchlist[item.Id] = item
+				s.watchlistIds[item.LetterboxdUri] = item.Id
+				continue
+			}
+			stored := s.watchlist[id]
+			if item.ImdbId != "" {
+				stored.ImdbId = item.ImdbId
+			}
+			if item.TmdbId != "" {
+				stored.TmdbId = item.TmdbId
+			}
+			s.watchlist[id] = stored
+		}
+		return nil
+	})
+}
+
+func (w *watchlistRepository) GetAllWatchlist(ctx context.Context) ([]model.WatchlistItem, error) {
+	s := w.db.view(ctx)
+	var watchlist []model.WatchlistItem
+	for _, id := range slices.Sorted(maps.Keys(s.watchlist)) {
+		watchlist = append(watchlist, s.watchlist[id])
+	}
+	return watchlist, nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"go-jellyfin-api/cmd/model"
+	"strings"
+)
+
+// movieFilterCondition turns the filter into a SQL condition on the movie table
+// aliased as alias, binding its values to p. Movies removed from Jellyfin are
+// always left out.
+func movieFilterCondition(alias string, filter model.MovieFilter, p *Params) string {
+	d := p.dialect
+	conditions := []string{activeMovieCondition(alias)}
+	add := func(condition string) {
+		conditions = append(conditions, condition)
+	}
+
+	if len(filter.ExcludedJellyfinIds) > 0 {
+		add("NOT (" + d.In(alias+".jellyfin_id", p.Add(d.List(filter.ExcludedJellyfinIds))) + ")")
+	}
+	if filter.RestrictAccess {
+		add(d.In(alias+".jellyfin_id", p.Add(d.List(filter.AllowedJellyfinIds))))
+	}
+	if filter.YearFrom != nil {
+		add(alias + ".production_year >= " + p.Add(*filter.YearFrom))
+	}
+	if filter.YearTo != nil {
+		add(alias + ".production_year <= " + p.Add(*filter.YearTo))
+	}
+	if filter.RatingFrom != nil {
+		add(alias + ".community_rating >= " + p.Add(*filter.RatingFrom))
+	}
+	if filter.RatingTo != nil {
+		add(alias + ".community_rating <= " + p.Add(*filter.RatingTo))
+	}
+	for _, genre := range filter.Genres {
+		add("EXISTS (SELECT 1 FROM " + d.Elements(alias+".genres", "g") + " WHERE lower(g.value) = lower(" + p.Add(genre) + "))")
+	}
+	if filter.LibraryId != "" {
+		add(alias + ".library_id = " + p.Add(filter.LibraryId))
+	}
+	if filter.OnWatchlist != nil {
+		condition := "EXISTS (SELECT 1 FROM movie_watchlist mw WHERE mw.movie_id = " + alias + ".id)"
+		if !*filter.OnWatchlist {
+			condition = "NOT " + condition
+		}
+		add(condition)
+	}
+	if filter.Watched != nil {
+		played := d.In(alias+".jellyfin_id", p.Add(d.List(filter.PlayedJellyfinIds)))
+		if *filter.Watched {
+			add(played)
+		} else {
+			add("NOT (" + played + ")")
+		}
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+// activeMovieCondition matches movies that haven't been soft-deleted because
+// they disappeared from Jellyfin.
+func activeMovieCondition(alias string) string {
+	return alias + ".deleted_at IS NULL"
+}
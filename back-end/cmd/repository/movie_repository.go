@@ -2,39 +2,179 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"go-jellyfin-api/cmd/blob"
 	"go-jellyfin-api/cmd/model"
-
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"go-jellyfin-api/cmd/poster"
+	"log"
+	"time"
 )
 
 type MovieRepository interface {
+	// StoreImages puts the fetched posters in the image store and describes
+	// them on the items for PopulateMovieDatabase. It belongs outside any unit
+	// of work: uploads can't be rolled back, and shouldn't hold one open.
+	StoreImages(ctx context.Context, items *model.Items) error
 	PopulateMovieDatabase(ctx context.Context, items *model.Items) error
 	GetMovieByName(ctx context.Context, name string) (*model.Movie, error)
-	GetRandomMovies(ctx context.Context, numberOfMovies int) ([]model.MovieWithImage, error)
+	GetRandomMovies(ctx context.Context, numberOfMovies int, filter model.MovieFilter) ([]model.MovieWithImage, error)
 	GetAllMovies(ctx context.Context) ([]model.Movie, error)
 	GetMovieById(ctx context.Context, id int) (model.Movie, error)
 	GetMovieByIdWithImage(ctx context.Context, id int) (model.MovieWithImage, error)
+	GetMovieByJellyfinIdWithImage(ctx context.Context, jellyfinId string) (model.MovieWithImage, error)
+	GetRecentlyUpdatedMovies(ctx context.Context, limit int, filter model.MovieFilter) ([]model.RecentlyUpdatedMovie, error)
+	SearchMovies(ctx context.Context, query model.SearchQuery, limit, offset int, filter model.MovieFilter) (model.MovieSearchPage, error)
+	SuggestMovies(ctx context.Context, text string, limit int, filter model.MovieFilter) ([]model.MovieSuggestion, error)
+	ListMovies(ctx context.Context, query model.MovieListQuery) (model.MoviePage, error)
+	GetMovieImage(ctx context.Context, id int, filter model.MovieFilter) (*model.MovieImage, error)
+	MigrateInlineImages(ctx context.Context) (int, error)
+}
+
+// movieColumns is the column list every movie query selects, in the order
+// movieScanTargets expects them.
+const movieColumns = `m.id, m.jellyfin_id, m.title, m.production_year, m.community_rating,
+    m.original_title, m.sort_name, m.library_id, m.overview, m.genres, m.people,
+    m.imdb_id, m.tmdb_id`
+
+func movieScanTargets(d Dialect, movie *model.Movie) []any {
+	return []any{
+		&movie.Id,
+		&movie.JellyfinId,
+		&movie.Name,
+		&movie.ProductionYear,
+		&movie.CommunityRating,
+		&movie.OriginalTitle,
+		&movie.SortName,
+		&movie.LibraryId,
+		&movie.Overview,
+		d.ScanList(&movie.Genres),
+		d.ScanList(&movie.People),
+		&movie.ImdbId,
+		&movie.TmdbId,
+	}
+}
+
+// movieImageColumns describe a movie's poster joined in as mi. The bytes are
+// read from the blob store separately.
+const movieImageColumns = `coalesce(mi.image_hash, ''), coalesce(mi.content_type, ''),
+    coalesce(mi.width, 0), coalesce(mi.height, 0)`
+
+func movieImageScanTargets(image *model.MovieImage) []any {
+	return []any{
+		&image.Hash,
+		&image.ContentType,
+		&image.Width,
+		&image.Height,
+	}
+}
+
+func movieWithImageScanTargets(d Dialect, movie *model.MovieWithImage) []any {
+	return append(movieScanTargets(d, &movie.Movie), movieImageScanTargets(&movie.MovieImage)...)
 }
 
 type movieRepository struct {
-	pool *pgxpool.Pool
+	db     *Database
+	images blob.Store
 }
 
-func NewMovieRepository(pool *pgxpool.Pool) MovieRepository {
+func NewMovieRepository(db *Database, images blob.Store) MovieRepository {
 	return &movieRepository{
-		pool: pool,
+		db:     db,
+		images: images,
 	}
 }
 
+func (m *movieRepository) conn(ctx context.Context) Conn {
+	return m.db.conn(ctx)
+}
+
+// inlineImageBatchSize is how many posters MigrateInlineImages moves per query.
+const inlineImageBatchSize = 100
+
+// MigrateInlineImages moves posters still stored in movie_image.image_data
+// into the blob store and returns how many were moved. Posters that cannot be
+// decoded are dropped; the next sync fetches them again. Databases that never
+// stored posters inline have nothing to move.
+func (m *movieRepository) MigrateInlineImages(ctx context.Context) (int, error) {
+	if !m.db.dialect.InlineImages() {
+		return 0, nil
+	}
+	moved := 0
+	for {
+		inline, err := m.getInlineImages(ctx)
+		if err != nil {
+			return moved, err
+		}
+		if len(inline) == 0 {
+			return moved, nil
+		}
+
+		var statements []Statement
+		for _, item := range inline {
+			image, err := StoreImage(ctx, m.images, item.data)
+			p := m.db.params()
+			if errors.Is(err, poster.ErrUnreadable) {
+				log.Printf("Dropping poster of movie %d: %v\n", item.movieId, err)
+				statements = append(statements, Statement{`DELETE FROM movie_image WHERE movie_id = ` + p.Add(item.movieId), p.Args()})
+				continue
+			}
+			if err != nil {
+				return moved, err
+			}
+			statements = append(statements, Statement{`
+        UPDATE movie_image
+        SET image_hash = ` + p.Add(image.Hash) + `, content_type = ` + p.Add(image.ContentType) + `,
+            width = ` + p.Add(image.Width) + `, height = ` + p.Add(image.Height) + `, image_data = NULL
+        WHERE movie_id = ` + p.Add(item.movieId), p.Args()})
+			moved++
+		}
+		if _, err := m.conn(ctx).Batch(ctx, statements); err != nil {
+			return moved, fmt.Errorf("failed to update migrated posters: %w", err)
+		}
+	}
+}
+
+type inlineImage struct {
+	movieId int
+	data    []byte
+}
+
+func (m *movieRepository) getInlineImages(ctx context.Context) ([]inlineImage, error) {
+	p := m.db.params()
+	rows, err := m.conn(ctx).Query(
+		ctx,
+		`SELECT movie_id, image_data FROM movie_image
+         WHERE image_hash IS NULL AND image_data IS NOT NULL
+         ORDER BY movie_id
+         LIMIT `+p.Add(inlineImageBatchSize),
+		p.Args()...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query inline posters: %w", err)
+	}
+	defer rows.Close()
+
+	var images []inlineImage
+	for rows.Next() {
+		var image inlineImage
+		if err := rows.Scan(&image.movieId, &image.data); err != nil {
+			return nil, fmt.Errorf("failed to read inline poster: %w", err)
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
 func (m *movieRepository) GetMovieById(ctx context.Context, id int) (model.Movie, error) {
 	var movie model.Movie
-	err := m.pool.QueryRow(
+	p := m.db.params()
+	err := m.conn(ctx).QueryRow(
 		ctx,
-		"SELECT id, jellyfin_id, title, production_year, community_rating from movie where id = $1",
-		id,
-	).Scan(&movie.Id, &movie.JellyfinId, &movie.Name, &movie.ProductionYear, &movie.CommunityRating)
+		"SELECT "+movieColumns+" FROM movie m WHERE m.id = "+p.Add(id)+" AND "+activeMovieCondition("m"),
+		p.Args()...,
+	).Scan(movieScanTargets(m.db.dialect, &movie)...)
 	if err != nil {
 		return model.Movie{}, err
 	}
@@ -42,86 +182,391 @@ func (m *movieRepository) GetMovieById(ctx context.Context, id int) (model.Movie
 }
 
 func (m *movieRepository) GetMovieByIdWithImage(ctx context.Context, id int) (model.MovieWithImage, error) {
+	return m.getMovieWithImage(ctx, "m.id", id)
+}
+
+func (m *movieRepository) GetMovieByJellyfinIdWithImage(ctx context.Context, jellyfinId string) (model.MovieWithImage, error) {
+	return m.getMovieWithImage(ctx, "m.jellyfin_id", jellyfinId)
+}
+
+func (m *movieRepository) getMovieWithImage(ctx context.Context, column string, value any) (model.MovieWithImage, error) {
 	var movie model.MovieWithImage
+	p := m.db.params()
 	query := `
-    SELECT m.id, m.jellyfin_id, m.title, m.production_year, m.community_rating, mi.image_data
+    SELECT ` + movieColumns + `, ` + movieImageColumns + `
     FROM movie m
     LEFT JOIN movie_image mi ON m.id = mi.movie_id
+    WHERE ` + column + ` = ` + p.Add(value) + ` AND ` + activeMovieCondition("m") + `
   `
-	err := m.pool.QueryRow(
-		ctx, query, id,
-	).Scan(
-		&movie.Movie.Id,
-		&movie.Movie.JellyfinId,
-		&movie.Movie.Name,
-		&movie.Movie.ProductionYear,
-		&movie.Movie.CommunityRating,
-		&movie.MovieImage.ImageData,
-	)
+	err := m.conn(ctx).QueryRow(ctx, query, p.Args()...).Scan(movieWithImageScanTargets(m.db.dialect, &movie)...)
 	if err != nil {
 		return model.MovieWithImage{}, err
 	}
+	movie.MovieImage.MovieId = movie.Movie.Id
+	LinkPoster(&movie.MovieImage)
 	return movie, nil
 }
 
+// GetMovieImage describes the poster of a movie the filter lets through, or
+// returns nil when the movie is unknown, filtered out or has no poster. The
+// bytes are left for the caller to read from the image store by Hash.
+func (m *movieRepository) GetMovieImage(ctx context.Context, id int, filter model.MovieFilter) (*model.MovieImage, error) {
+	image := model.MovieImage{MovieId: id}
+	p := m.db.params()
+	query := `
+    SELECT ` + movieImageColumns + `
+    FROM movie m
+    JOIN movie_image mi ON m.id = mi.movie_id
+    WHERE m.id = ` + p.Add(id) + ` AND mi.image_hash IS NOT NULL AND ` + movieFilterCondition("m", filter, p) + `
+  `
+	err := m.conn(ctx).QueryRow(ctx, query, p.Args()...).Scan(movieImageScanTargets(&image)...)
+	if errors.Is(err, ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+// GetMovieByName looks the name up case-insensitively against the title, the
+// original title and the sort name. It returns nil when nothing matches.
 func (m *movieRepository) GetMovieByName(ctx context.Context, name string) (*model.Movie, error) {
 	var movie model.Movie
-	err := m.pool.QueryRow(
-		ctx,
-		"SELECT title, production_year, community_rating from movie where name = $1",
-		name,
-	).Scan(&movie.Name, &movie.ProductionYear, &movie.CommunityRating)
-	if err != nil {
+	p := m.db.params()
+	value := p.Add(name)
+	query := `
+    SELECT ` + movieColumns + `
+    FROM movie m
+    WHERE ` + activeMovieCondition("m") + `
+      AND (lower(m.title) = lower(` + value + `)
+       OR lower(m.original_title) = lower(` + value + `)
+       OR lower(m.sort_name) = lower(` + value + `))
+    ORDER BY m.id
+    LIMIT 1
+  `
+	err := m.conn(ctx).QueryRow(ctx, query, p.Args()...).Scan(movieScanTargets(m.db.dialect, &movie)...)
+	if errors.Is(err, ErrNoRows) {
 		return nil, nil
 	}
+	if err != nil {
+		return nil, err
+	}
 	return &movie, nil
 }
 
+// storedMovie is what the last sync left of a movie, including soft-deleted
+// ones: digests of its metadata and poster to spot changes, without the
+// metadata itself.
+type storedMovie struct {
+	id           int
+	metadataHash string
+	imageHash    string
+}
+
+func (m *movieRepository) getStoredMovies(ctx context.Context) (map[string]storedMovie, error) {
+	query := `
+    SELECT m.id, m.jellyfin_id, m.metadata_hash, coalesce(mi.image_hash, '')
+    FROM movie m
+    LEFT JOIN movie_image mi ON m.id = mi.movie_id
+  `
+	rows, err := m.conn(ctx).Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[string]storedMovie)
+	for rows.Next() {
+		var jellyfinId string
+		var movie storedMovie
+		if err := rows.Scan(&movie.id, &jellyfinId, &movie.metadataHash, &movie.imageHash); err != nil {
+			return nil, err
+		}
+		stored[jellyfinId] = movie
+	}
+	return stored, rows.Err()
+}
+
+// getMoviesByIds reads the full metadata of the given movies, including
+// soft-deleted ones, keyed by id.
+func (m *movieRepository) getMoviesByIds(ctx context.Context, ids []int) (map[int]model.Movie, error) {
+	movies := make(map[int]model.Movie, len(ids))
+	if len(ids) == 0 {
+		return movies, nil
+	}
+	d := m.db.dialect
+	p := m.db.params()
+	rows, err := m.conn(ctx).Query(ctx,
+		"SELECT "+movieColumns+" FROM movie m WHERE "+d.In("m.id", p.Add(d.List(ids))), p.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movie model.Movie
+		if err := rows.Scan(movieScanTargets(d, &movie)...); err != nil {
+			return nil, err
+		}
+		movies[movie.Id] = movie
+	}
+	return movies, rows.Err()
+}
+
+// StoreImages uploads only the posters whose hash differs from the one stored
+// for the movie; the others just get their hash, which tells
+// PopulateMovieDatabase to leave them be. Unreadable posters are dropped.
+func (m *movieRepository) StoreImages(ctx context.Context, items *model.Items) error {
+	stored, err := m.getStoredImageHashes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read stored posters: %w", err)
+	}
+	for i := range items.ItemElements {
+		item := &items.ItemElements[i]
+		if err := StoreItemImage(ctx, m.images, item, stored[item.Id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StoreItemImage puts the item's poster in the store unless its hash is
+// storedHash, the one stored for the movie, and fills in the description
+// PopulateMovieDatabase writes.
+func StoreItemImage(ctx context.Context, store blob.Store, item *model.ItemsElement, storedHash string) error {
+	if item.Image.ImageData == nil {
+		return nil
+	}
+	if key := blob.Key(item.Image.ImageData); key == storedHash {
+		item.Image.Hash = key
+		return nil
+	}
+	image, err := StoreImage(ctx, store, item.Image.ImageData)
+	if errors.Is(err, poster.ErrUnreadable) {
+		log.Printf("Skipping poster of %s: %v\n", item.Id, err)
+		item.Image = model.MovieImage{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	image.ImageData = item.Image.ImageData
+	item.Image = image
+	return nil
+}
+
+func (m *movieRepository) getStoredImageHashes(ctx context.Context) (map[string]string, error) {
+	rows, err := m.conn(ctx).Query(ctx, `
+    SELECT m.jellyfin_id, mi.image_hash
+    FROM movie m
+    JOIN movie_image mi ON m.id = mi.movie_id
+    WHERE mi.image_hash IS NOT NULL
+  `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var jellyfinId, hash string
+		if err := rows.Scan(&jellyfinId, &hash); err != nil {
+			return nil, err
+		}
+		hashes[jellyfinId] = hash
+	}
+	return hashes, rows.Err()
+}
+
+// PopulateMovieDatabase upserts the movies fetched from Jellyfin, recording
+// every changed field and replaced poster in movie_change, and soft-deletes
+// every stored movie that wasn't among them, all in one transaction. A movie
+// that shows up again is restored. An empty fetch leaves the table alone,
+// since that is far more likely a Jellyfin hiccup than an emptied library.
+// Posters are only recorded once StoreImages has put them in the image store.
 func (m *movieRepository) PopulateMovieDatabase(ctx context.Context, items *model.Items) error {
-	batch := &pgx.Batch{}
+	if len(items.ItemElements) == 0 {
+		log.Println("Jellyfin returned no movies, skipping reconciliation")
+		return nil
+	}
+	return m.db.Do(ctx, func(ctx context.Context) error {
+		return m.populateMovies(ctx, items)
+	})
+}
 
-	for _, item := range items.ItemElements {
-		batch.Queue(
-			`INSERT INTO movie (jellyfin_id, title, production_year, community_rating) 
-             VALUES ($1, $2, $3, $4) 
-             ON CONFLICT (jellyfin_id) DO NOTHING`,
-			item.Id,
-			item.Name,
-			item.ProductionYear,
-			item.CommunityRating,
-		)
+// populateMovies compares digests to find the changed movies and only reads
+// back the full metadata of those, to record which fields changed.
+func (m *movieRepository) populateMovies(ctx context.Context, items *model.Items) error {
+	stored, err := m.getStoredMovies(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read stored movies: %w", err)
+	}
 
-		if item.Image.ImageData != nil {
-			batch.Queue(
-				`INSERT INTO movie_image (movie_id, image_data) 
-                 SELECT id, $2 FROM movie WHERE jellyfin_id = $1
-                 ON CONFLICT (movie_id) DO NOTHING`,
-				item.Id,
-				item.Image.ImageData,
-			)
+	movies := make([]model.Movie, len(items.ItemElements))
+	hashes := make([]string, len(items.ItemElements))
+	var changedIds []int
+	for i, item := range items.ItemElements {
+		movies[i] = item.Movie()
+		hashes[i] = movies[i].MetadataHash()
+		if previous, exists := stored[item.Id]; exists && previous.metadataHash != hashes[i] {
+			changedIds = append(changedIds, previous.id)
 		}
 	}
+	previousMovies, err := m.getMoviesByIds(ctx, changedIds)
+	if err != nil {
+		return fmt.Errorf("failed to read changed movies: %w", err)
+	}
+
+	d := m.db.dialect
+	var statements []Statement
+	jellyfinIds := make([]string, 0, len(items.ItemElements))
+	updated := 0
+
+	for i, item := range items.ItemElements {
+		jellyfinIds = append(jellyfinIds, item.Id)
+		movie := movies[i]
+		previous, exists := stored[item.Id]
+
+		image := item.Image
+		imageChanged := image.Hash != "" && image.Hash != previous.imageHash
 
-	if batch.Len() > 0 {
-		br := m.pool.SendBatch(ctx, batch)
-		defer br.Close()
-		if err := br.Close(); err != nil {
-			return fmt.Errorf("failed to execute batch: %w", err)
+		var changes []model.FieldChange
+		if exists {
+			if previousMovie, changed := previousMovies[previous.id]; changed {
+				changes = previousMovie.Changes(movie)
+			}
+			if imageChanged {
+				changes = append(changes, model.FieldChange{Field: model.PosterField})
+			}
+		}
+
+		statements = append(statements, upsertMovie(d, movie, hashes[i], len(changes) > 0))
+		if imageChanged {
+			statements = append(statements, upsertMovieImage(d, item.Id, image))
+		}
+		if len(changes) > 0 {
+			statement, err := insertMovieChange(d, previous.id, changes)
+			if err != nil {
+				return err
+			}
+			statements = append(statements, statement)
+			updated++
 		}
 	}
 
+	p := m.db.params()
+	statements = append(statements, Statement{`
+    UPDATE movie SET deleted_at = ` + d.Now() + `
+    WHERE deleted_at IS NULL AND NOT (` + d.In("jellyfin_id", p.Add(d.List(jellyfinIds))) + `)`, p.Args()})
+
+	affected, err := m.conn(ctx).Batch(ctx, statements)
+	if err != nil {
+		return fmt.Errorf("failed to write movies: %w", err)
+	}
+	if updated > 0 {
+		log.Printf("Updated %d movies changed in Jellyfin\n", updated)
+	}
+	if archived := affected[len(affected)-1]; archived > 0 {
+		log.Printf("Archived %d movies no longer in Jellyfin\n", archived)
+	}
 	return nil
 }
 
-func (m *movieRepository) GetRandomMovies(ctx context.Context, numberOfMovies int) ([]model.MovieWithImage, error) {
+func upsertMovie(d Dialect, movie model.Movie, metadataHash string, changed bool) Statement {
+	p := &Params{dialect: d}
+	values := p.AddAll(
+		movie.JellyfinId,
+		movie.Name,
+		movie.ProductionYear,
+		movie.CommunityRating,
+		movie.OriginalTitle,
+		movie.SortName,
+		movie.ImdbId,
+		movie.TmdbId,
+		movie.Overview,
+		d.List(movie.Genres),
+		d.List(movie.People),
+		movie.LibraryId,
+		metadataHash,
+	)
 	query := `
-    SELECT m.id, m.jellyfin_id, m.title, m.production_year, m.community_rating, mi.image_data
-    FROM movie m
+    INSERT INTO movie (jellyfin_id, title, production_year, community_rating,
+                       original_title, sort_name, imdb_id, tmdb_id,
+                       overview, genres, people, library_id, metadata_hash)
+    VALUES (` + values + `)
+    ON CONFLICT (jellyfin_id) DO UPDATE SET
+        title = excluded.title,
+        production_year = excluded.production_year,
+        community_rating = excluded.community_rating,
+        original_title = excluded.original_title,
+        sort_name = excluded.sort_name,
+        imdb_id = excluded.imdb_id,
+        tmdb_id = excluded.tmdb_id,
+        overview = excluded.overview,
+        genres = excluded.genres,
+        people = excluded.people,
+        library_id = excluded.library_id,
+        metadata_hash = excluded.metadata_hash,
+        updated_at = CASE WHEN ` + p.Add(changed) + ` THEN ` + d.Now() + ` ELSE movie.updated_at END,
+        deleted_at = NULL`
+	return Statement{query, p.Args()}
+}
+
+func upsertMovieImage(d Dialect, jellyfinId string, image model.MovieImage) Statement {
+	p := &Params{dialect: d}
+	values := p.AddAll(image.Hash, image.ContentType, image.Width, image.Height)
+	clearInline := ""
+	if d.InlineImages() {
+		clearInline = "image_data = NULL,"
+	}
+	query := `
+    INSERT INTO movie_image (movie_id, image_hash, content_type, width, height)
+    SELECT id, ` + values + ` FROM movie WHERE jellyfin_id = ` + p.Add(jellyfinId) + `
+    ON CONFLICT (movie_id) DO UPDATE SET
+        image_hash = excluded.image_hash,
+        content_type = excluded.content_type,
+        width = excluded.width,
+        height = excluded.height,
+        ` + clearInline + `
+        updated_at = ` + d.Now()
+	return Statement{query, p.Args()}
+}
+
+func insertMovieChange(d Dialect, movieId int, changes []model.FieldChange) (Statement, error) {
+	fields := make([]string, 0, len(changes))
+	for _, change := range changes {
+		fields = append(fields, change.Field)
+	}
+	changesJson, err := json.Marshal(changes)
+	if err != nil {
+		return Statement{}, fmt.Errorf("failed to marshal movie changes: %w", err)
+	}
+	p := &Params{dialect: d}
+	query := `INSERT INTO movie_change (movie_id, changed_fields, changes) VALUES (` +
+		p.AddAll(movieId, d.List(fields), d.JSON(changesJson)) + `)`
+	return Statement{query, p.Args()}, nil
+}
+
+// GetRandomMovies samples the ids first and only then reads the chosen
+// movies and their posters.
+func (m *movieRepository) GetRandomMovies(ctx context.Context, numberOfMovies int, filter model.MovieFilter) ([]model.MovieWithImage, error) {
+	ids, err := m.db.sampleMovieIds(ctx, numberOfMovies, "movie m", "m.id", filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	p := m.db.params()
+	query := `
+    SELECT ` + movieColumns + `, ` + movieImageColumns + `
+    FROM ` + m.db.dialect.OrderedIds(p.Add(m.db.dialect.List(ids)), "picked") + `
+    JOIN movie m ON m.id = picked.value
     LEFT JOIN movie_image mi ON m.id = mi.movie_id
-    ORDER BY RANDOM()
-    LIMIT $1
+    ORDER BY picked.position
   `
-	rows, err := m.pool.Query(ctx, query, numberOfMovies)
+	rows, err := m.conn(ctx).Query(ctx, query, p.Args()...)
 	if err != nil {
 		return nil, err
 	}
@@ -130,28 +575,22 @@ func (m *movieRepository) GetRandomMovies(ctx context.Context, numberOfMovies in
 	var movies []model.MovieWithImage
 	for rows.Next() {
 		var movie model.MovieWithImage
-		err := rows.Scan(
-			&movie.Movie.Id,
-			&movie.Movie.JellyfinId,
-			&movie.Movie.Name,
-			&movie.Movie.ProductionYear,
-			&movie.Movie.CommunityRating,
-			&movie.MovieImage.ImageData,
-		)
-		if err != nil {
+		if err := rows.Scan(movieWithImageScanTargets(m.db.dialect, &movie)...); err != nil {
 			return nil, err
 		}
 		movie.MovieImage.MovieId = movie.Movie.Id
+		LinkPoster(&movie.MovieImage)
 		movies = append(movies, movie)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	return movies, nil
 }
 
 func (m *movieRepository) GetAllMovies(ctx context.Context) ([]model.Movie, error) {
-	query := `
-		SELECT id, jellyfin_id, title, production_year, community_rating from movie
-	`
-	rows, err := m.pool.Query(ctx, query)
+	query := `SELECT ` + movieColumns + ` FROM movie m WHERE ` + activeMovieCondition("m")
+	rows, err := m.conn(ctx).Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -160,11 +599,228 @@ func (m *movieRepository) GetAllMovies(ctx context.Context) ([]model.Movie, erro
 	var movies []model.Movie
 	for rows.Next() {
 		var movie model.Movie
-		if err := rows.Scan(&movie.Id, &movie.JellyfinId, &movie.Name,
-			&movie.ProductionYear, &movie.CommunityRating); err != nil {
+		if err := rows.Scan(movieScanTargets(m.db.dialect, &movie)...); err != nil {
+			return nil, err
+		}
+		movies = append(movies, movie)
+	}
+	return movies, rows.Err()
+}
+
+// GetRecentlyUpdatedMovies returns the movies changed most recently, newest
+// change first.
+func (m *movieRepository) GetRecentlyUpdatedMovies(ctx context.Context, limit int, filter model.MovieFilter) ([]model.RecentlyUpdatedMovie, error) {
+	d := m.db.dialect
+	p := m.db.params()
+	query := `
+    SELECT ` + movieColumns + `, ` + movieImageColumns + `, r.changed_fields, r.last_changed_at
+    FROM recently_updated_movie r
+    JOIN movie m ON m.id = r.movie_id
+    LEFT JOIN movie_image mi ON m.id = mi.movie_id
+    WHERE ` + movieFilterCondition("m", filter, p) + `
+    ORDER BY r.last_changed_at DESC, m.id
+    LIMIT ` + p.Add(limit)
+	rows, err := m.conn(ctx).Query(ctx, query, p.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []model.RecentlyUpdatedMovie{}
+	for rows.Next() {
+		var movie model.RecentlyUpdatedMovie
+		targets := append(movieScanTargets(d, &movie.Movie), movieImageScanTargets(&movie.MovieImage)...)
+		targets = append(targets, d.ScanList(&movie.ChangedFields), d.ScanTime(&movie.LastChangedAt))
+		if err := rows.Scan(targets...); err != nil {
 			return nil, err
 		}
+		movie.MovieImage.MovieId = movie.Movie.Id
+		LinkPoster(&movie.MovieImage)
 		movies = append(movies, movie)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	return movies, nil
 }
+
+// SearchMovies runs a full-text search over titles, genres, people and the
+// overview, best ranked first.
+func (m *movieRepository) SearchMovies(ctx context.Context, query model.SearchQuery, limit, offset int, filter model.MovieFilter) (model.MovieSearchPage, error) {
+	page := model.MovieSearchPage{Results: []model.MovieSearchResult{}, Limit: limit, Offset: offset}
+
+	p := m.db.params()
+	from, match, rank := m.db.dialect.Search(query, p)
+	where := match + ` AND ` + movieFilterCondition("m", filter, p)
+	err := m.conn(ctx).QueryRow(ctx, "SELECT count(*) FROM "+from+" WHERE "+where, p.Args()...).Scan(&page.Total)
+	if err != nil {
+		return model.MovieSearchPage{}, err
+	}
+	if page.Total <= offset {
+		return page, nil
+	}
+
+	sql := `
+    SELECT ` + movieColumns + `, ` + movieImageColumns + `, ` + rank + ` AS rank
+    FROM ` + from + `
+    LEFT JOIN movie_image mi ON m.id = mi.movie_id
+    WHERE ` + where + `
+    ORDER BY rank DESC, m.sort_name, m.id
+    LIMIT ` + p.Add(limit) + ` OFFSET ` + p.Add(offset)
+	rows, err := m.conn(ctx).Query(ctx, sql, p.Args()...)
+	if err != nil {
+		return model.MovieSearchPage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result model.MovieSearchResult
+		targets := append(movieScanTargets(m.db.dialect, &result.Movie), movieImageScanTargets(&result.MovieImage)...)
+		targets = append(targets, &result.Rank)
+		if err := rows.Scan(targets...); err != nil {
+			return model.MovieSearchPage{}, err
+		}
+		result.MovieImage.MovieId = result.Movie.Id
+		LinkPoster(&result.MovieImage)
+		page.Results = append(page.Results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return model.MovieSearchPage{}, err
+	}
+	return page, nil
+}
+
+// suggestThreshold is the word similarity a title needs to be suggested,
+// pg_trgm's default for the <% operator.
+const suggestThreshold = 0.6
+
+// SuggestMovies finds the titles closest to text by trigram word similarity,
+// ignoring case and accents, so typos and partly typed titles still match.
+// Without a trigram index, every title the filter lets through is scored.
+func (m *movieRepository) SuggestMovies(ctx context.Context, text string, limit int, filter model.MovieFilter) ([]model.MovieSuggestion, error) {
+	d := m.db.dialect
+	p := m.db.params()
+	search := "search_title(" + p.Add(text) + ")"
+	condition := movieFilterCondition("m", filter, p)
+	if indexed := d.SimilarWords(search, "search_title(m.title)"); indexed != "" {
+		condition += " AND (" + indexed + " OR " + d.SimilarWords(search, "search_title(m.original_title)") + ")"
+	}
+	query := `
+    SELECT * FROM (
+        SELECT ` + movieColumns + `,
+               ` + d.Greatest() + `(word_similarity(` + search + `, search_title(m.title)),
+                   word_similarity(` + search + `, search_title(m.original_title))) AS similarity
+        FROM movie m
+        WHERE ` + condition + `
+    ) m
+    WHERE similarity >= ` + p.Add(suggestThreshold) + `
+    ORDER BY similarity DESC, m.sort_name, m.id
+    LIMIT ` + p.Add(limit)
+	rows, err := m.conn(ctx).Query(ctx, query, p.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []model.MovieSuggestion{}
+	for rows.Next() {
+		var suggestion model.MovieSuggestion
+		if err := rows.Scan(append(movieScanTargets(d, &suggestion.Movie), &suggestion.Similarity)...); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, rows.Err()
+}
+
+// movieSortColumns maps each sort order to the expression it orders by.
+var movieSortColumns = map[model.MovieSort]string{
+	model.SortByTitle:  "coalesce(nullif(m.sort_name, ''), lower(m.title))",
+	model.SortByYear:   "m.production_year",
+	model.SortByRating: "m.community_rating",
+	model.SortByAdded:  "m.created_at",
+}
+
+// ListMovies returns one page of the filtered listing using keyset
+// pagination: each page continues after the cursor's sort value and id
+// instead of skipping rows, so it stays fast and stable deep into the list.
+func (m *movieRepository) ListMovies(ctx context.Context, query model.MovieListQuery) (model.MoviePage, error) {
+	sortColumn, ok := movieSortColumns[query.Sort]
+	if !ok {
+		return model.MoviePage{}, fmt.Errorf("unknown sort order %q", query.Sort)
+	}
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	// Times are bound and scanned as times, which each database writes as text
+	// its own way, so the cursor always holds them in RFC 3339.
+	d := m.db.dialect
+	byTime := query.Sort == model.SortByAdded
+	p := m.db.params()
+	condition := movieFilterCondition("m", query.Filter, p)
+	if query.After != nil {
+		after := fmt.Sprintf("CAST(%s AS %s)", p.Add(query.After.Value), d.CursorType(query.Sort))
+		if byTime {
+			addedAt, err := query.After.AddedAt()
+			if err != nil {
+				return model.MoviePage{}, model.ErrInvalidCursor
+			}
+			after = p.Add(d.Time(addedAt))
+		}
+		condition += fmt.Sprintf(" AND (%s, m.id) %s (%s, %s)", sortColumn, comparison, after, p.Add(query.After.Id))
+	}
+	sortValue := "CAST(" + sortColumn + " AS TEXT)"
+	if byTime {
+		sortValue = sortColumn
+	}
+	// One row more than the page shows whether there is a next page.
+	sql := fmt.Sprintf(`
+    SELECT `+movieColumns+`, `+movieImageColumns+`, %[5]s
+    FROM movie m
+    LEFT JOIN movie_image mi ON m.id = mi.movie_id
+    WHERE %[2]s
+    ORDER BY %[1]s %[3]s, m.id %[3]s
+    LIMIT %[4]s
+  `, sortColumn, condition, direction, p.Add(query.Limit+1), sortValue)
+	rows, err := m.conn(ctx).Query(ctx, sql, p.Args()...)
+	if err != nil {
+		return model.MoviePage{}, err
+	}
+	defer rows.Close()
+
+	page := model.MoviePage{Movies: []model.MovieWithImage{}}
+	var lastValue string
+	var lastTime time.Time
+	valueTarget := any(&lastValue)
+	if byTime {
+		valueTarget = d.ScanTime(&lastTime)
+	}
+	for rows.Next() {
+		if len(page.Movies) == query.Limit {
+			last := page.Movies[len(page.Movies)-1].Movie
+			if byTime {
+				lastValue = lastTime.UTC().Format(time.RFC3339Nano)
+			}
+			page.NextCursor = model.MovieCursor{
+				Sort:       query.Sort,
+				Descending: query.Descending,
+				Value:      lastValue,
+				Id:         last.Id,
+			}.Encode()
+			break
+		}
+		var movie model.MovieWithImage
+		if err := rows.Scan(append(movieWithImageScanTargets(d, &movie), valueTarget)...); err != nil {
+			return model.MoviePage{}, err
+		}
+		movie.MovieImage.MovieId = movie.Movie.Id
+		LinkPoster(&movie.MovieImage)
+		page.Movies = append(page.Movies, movie)
+	}
+	if err := rows.Err(); err != nil {
+		return model.MoviePage{}, err
+	}
+	return page, nil
+}
@@ -4,56 +4,73 @@ import (
 	"context"
 	"fmt"
 	"go-jellyfin-api/cmd/model"
-
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type MovieWatchlistRepository interface {
 	InsertPairs(ctx context.Context, pairs []model.MovieWatchlistPair) error
-	GetRandomMovies(ctx context.Context, noOfMovies int) ([]model.MovieWatchlistPair, error)
+	GetRandomMovies(ctx context.Context, noOfMovies int, filter model.MovieFilter) ([]model.MovieWatchlistPair, error)
+	FindFuzzyPairs(ctx context.Context, watchlistIds []int, threshold float32) ([]model.MovieWatchlistPair, error)
 }
 
 type movieWatchlistRepository struct {
-	pool *pgxpool.Pool
+	db *Database
 }
 
-func NewMovieWatchlistRepository(pool *pgxpool.Pool) MovieWatchlistRepository {
+func NewMovieWatchlistRepository(db *Database) MovieWatchlistRepository {
 	return &movieWatchlistRepository{
-		pool: pool,
+		db: db,
 	}
 }
 
+func (m *movieWatchlistRepository) conn(ctx context.Context) Conn {
+	return m.db.conn(ctx)
+}
+
 func (m *movieWatchlistRepository) InsertPairs(ctx context.Context, pairs []model.MovieWatchlistPair) error {
-	query := `
+	if len(pairs) == 0 {
+		return nil
+	}
+	statements := make([]Statement, 0, len(pairs))
+	for _, pair := range pairs {
+		p := m.db.params()
+		query := `
 			INSERT INTO movie_watchlist (movie_id, watchlist_id, added_date)
-			VALUES ($1, $2, $3)
+			VALUES (` + p.AddAll(pair.MovieId, pair.WatchlistId, m.db.dialect.Time(pair.AddedDate)) + `)
 			ON CONFLICT (movie_id, watchlist_id) DO NOTHING
 	`
-	batch := &pgx.Batch{}
-	for _, pair := range pairs {
-		batch.Queue(query, pair.MovieId, pair.WatchlistId, pair.AddedDate)
+		statements = append(statements, Statement{query, p.Args()})
 	}
 
-	if batch.Len() > 0 {
-		br := m.pool.SendBatch(ctx, batch)
-		defer br.Close()
-		if err := br.Close(); err != nil {
+	return m.db.Do(ctx, func(ctx context.Context) error {
+		if _, err := m.conn(ctx).Batch(ctx, statements); err != nil {
 			return fmt.Errorf("failed to execute batch: %w", err)
 		}
-	}
-
-	return nil
+		return nil
+	})
 }
 
-func (m *movieWatchlistRepository) GetRandomMovies(ctx context.Context, noOfMovies int) ([]model.MovieWatchlistPair, error) {
+// GetRandomMovies samples distinct watchlisted movies; a movie paired with
+// several watchlist entries comes back once, with its earliest entry.
+func (m *movieWatchlistRepository) GetRandomMovies(ctx context.Context, noOfMovies int, filter model.MovieFilter) ([]model.MovieWatchlistPair, error) {
+	ids, err := m.db.sampleMovieIds(ctx, noOfMovies, "movie_watchlist mw JOIN movie m ON m.id = mw.movie_id", "mw.movie_id", filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no watchlist movies found")
+	}
+	p := m.db.params()
 	query := `
-		SELECT movie_id, watchlist_id, added_date
-		FROM movie_watchlist
-		ORDER BY RANDOM()
-		LIMIT $1
+		SELECT movie_id, watchlist_id, added_date FROM (
+			SELECT mw.movie_id, mw.watchlist_id, mw.added_date, picked.position,
+			       row_number() OVER (PARTITION BY mw.movie_id ORDER BY mw.added_date, mw.watchlist_id) AS entry
+			FROM ` + m.db.dialect.OrderedIds(p.Add(m.db.dialect.List(ids)), "picked") + `
+			JOIN movie_watchlist mw ON mw.movie_id = picked.value
+		) pairs
+		WHERE entry = 1
+		ORDER BY position
 	`
-	rows, err := m.pool.Query(ctx, query, noOfMovies)
+	rows, err := m.conn(ctx).Query(ctx, query, p.Args()...)
 	if err != nil {
 		return nil, err
 	}
@@ -64,15 +81,68 @@ func (m *movieWatchlistRepository) GetRandomMovies(ctx context.Context, noOfMovi
 		err := rows.Scan(
 			&movie.MovieId,
 			&movie.WatchlistId,
-			&movie.AddedDate,
+			m.db.dialect.ScanTime(&movie.AddedDate),
 		)
 		if err != nil {
 			return nil, err
 		}
 		movies = append(movies, movie)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	if len(movies) == 0 {
 		return nil, fmt.Errorf("no watchlist movies found")
 	}
 	return movies, nil
 }
+
+// FindFuzzyPairs pairs each of the watchlist entries with the movie from the
+// same year whose title is most similar, if any reaches threshold. Entries
+// whose provider ids rule a movie out are never paired with it.
+func (m *movieWatchlistRepository) FindFuzzyPairs(ctx context.Context, watchlistIds []int, threshold float32) ([]model.MovieWatchlistPair, error) {
+	if len(watchlistIds) == 0 {
+		return nil, nil
+	}
+	d := m.db.dialect
+	p := m.db.params()
+	condition := d.In("w.id", p.Add(d.List(watchlistIds)))
+	if indexed := d.SimilarTitles("search_title(m.title)", "search_title(w.title)"); indexed != "" {
+		condition += " AND (" + indexed + " OR " + d.SimilarTitles("search_title(m.original_title)", "search_title(w.title)") + ")"
+	}
+	query := `
+		SELECT movie_id, watchlist_id, added_date FROM (
+			SELECT movie_id, watchlist_id, added_date,
+			       row_number() OVER (PARTITION BY watchlist_id ORDER BY score DESC, movie_id) AS rank
+			FROM (
+				SELECT m.id AS movie_id, w.id AS watchlist_id, w.added_date,
+				       ` + d.Greatest() + `(similarity(search_title(m.title), search_title(w.title)),
+				           similarity(search_title(m.original_title), search_title(w.title))) AS score
+				FROM watchlist w
+				JOIN movie m ON m.production_year = ` + d.Year("w.production_year") + `
+				WHERE ` + condition + `
+				  AND ` + activeMovieCondition("m") + `
+				  AND NOT (m.tmdb_id <> '' AND w.tmdb_id <> '')
+				  AND NOT (m.imdb_id <> '' AND w.imdb_id <> '')
+			) candidates
+			WHERE score >= ` + p.Add(threshold) + `
+		) ranked
+		WHERE rank = 1
+		ORDER BY watchlist_id
+	`
+	rows, err := m.conn(ctx).Query(ctx, query, p.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []model.MovieWatchlistPair
+	for rows.Next() {
+		var pair model.MovieWatchlistPair
+		if err := rows.Scan(&pair.MovieId, &pair.WatchlistId, d.ScanTime(&pair.AddedDate)); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, rows.Err()
+}
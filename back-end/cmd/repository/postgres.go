@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-jellyfin-api/cmd/model"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// NewPostgresDatabase runs the repositories on the pool.
+func NewPostgresDatabase(pool *pgxpool.Pool) *Database {
+	return NewDatabase(postgresDriver{postgresConn{pool}, pool}, postgresDialect{})
+}
+
+// pgxConn is what pgx runs statements on: the pool or a transaction.
+type pgxConn interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults
+}
+
+type postgresConn struct {
+	db pgxConn
+}
+
+func (c postgresConn) Exec(ctx context.Context, query string, args ...any) (int64, error) {
+	tag, err := c.db.Exec(ctx, query, args...)
+	return tag.RowsAffected(), err
+}
+
+func (c postgresConn) Query(ctx context.Context, query string, args ...any) (Rows, error) {
+	return c.db.Query(ctx, query, args...)
+}
+
+func (c postgresConn) QueryRow(ctx context.Context, query string, args ...any) Row {
+	return postgresRow{c.db.QueryRow(ctx, query, args...)}
+}
+
+func (c postgresConn) Batch(ctx context.Context, statements []Statement) ([]int64, error) {
+	batch := &pgx.Batch{}
+	for _, statement := range statements {
+		batch.Queue(statement.Query, statement.Args...)
+	}
+	results := c.db.SendBatch(ctx, batch)
+	defer results.Close()
+
+	affected := make([]int64, len(statements))
+	for i := range statements {
+		tag, err := results.Exec()
+		if err != nil {
+			return nil, err
+		}
+		affected[i] = tag.RowsAffected()
+	}
+	return affected, results.Close()
+}
+
+type postgresRow struct {
+	row pgx.Row
+}
+
+func (r postgresRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNoRows
+	}
+	return err
+}
+
+type postgresDriver struct {
+	postgresConn
+	pool *pgxpool.Pool
+}
+
+func (d postgresDriver) Begin(ctx context.Context, snapshot bool) (Tx, error) {
+	options := pgx.TxOptions{}
+	if snapshot {
+		options = pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+	}
+	tx, err := d.pool.BeginTx(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	return postgresTx{postgresConn{tx}, tx}, nil
+}
+
+type postgresTx struct {
+	postgresConn
+	tx pgx.Tx
+}
+
+func (t postgresTx) Commit(ctx context.Context) error {
+	return t.tx.Commit(ctx)
+}
+
+func (t postgresTx) Rollback(ctx context.Context) error {
+	if err := t.tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+		return err
+	}
+	return nil
+}
+
+// postgresDialect keeps lists in arrays, searches the search_vector column
+// and narrows trigram comparisons down with the pg_trgm indexes.
+type postgresDialect struct{}
+
+func (postgresDialect) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// List keeps an empty list from being bound as NULL, which ANY would treat
+// as unknown rather than as matching nothing.
+func (postgresDialect) List(values any) any {
+	switch values := values.(type) {
+	case []string:
+		if values == nil {
+			return []string{}
+		}
+	case []int:
+		if values == nil {
+			return []int{}
+		}
+	}
+	return values
+}
+
+func (postgresDialect) ScanList(target *[]string) any {
+	return target
+}
+
+func (postgresDialect) In(expr, list string) string {
+	return expr + " = ANY(" + list + ")"
+}
+
+func (postgresDialect) Elements(list, alias string) string {
+	return "unnest(" + list + ") AS " + alias + " (value)"
+}
+
+func (postgresDialect) OrderedIds(list, alias string) string {
+	return "unnest(" + list + "::int[]) WITH ORDINALITY AS " + alias + " (value, position)"
+}
+
+func (postgresDialect) Time(t time.Time) any {
+	return t
+}
+
+func (postgresDialect) NullTime(t *time.Time) any {
+	return t
+}
+
+func (postgresDialect) ScanTime(target *time.Time) any {
+	return target
+}
+
+func (postgresDialect) ScanNullTime(target **time.Time) any {
+	return target
+}
+
+func (postgresDialect) JSON(data []byte) any {
+	return data
+}
+
+func (postgresDialect) ScanJSON(target *json.RawMessage) any {
+	return target
+}
+
+func (postgresDialect) Now() string {
+	return "now()"
+}
+
+func (postgresDialect) Year(expr string) string {
+	return "date_part('year', " + expr + " AT TIME ZONE 'UTC')::int"
+}
+
+func (postgresDialect) Greatest() string {
+	return "greatest"
+}
+
+func (postgresDialect) CursorType(sort model.MovieSort) string {
+	switch sort {
+	case model.SortByYear:
+		return "int"
+	case model.SortByRating:
+		return "numeric"
+	default:
+		return "text"
+	}
+}
+
+// Search folds the query with search_title, as the search vector is folded.
+func (postgresDialect) Search(query model.SearchQuery, p *Params) (from, condition, rank string) {
+	tsQuery := "to_tsquery('simple', search_title(" + p.Add(tsQuery(query)) + "))"
+	return "movie m", "m.search_vector @@ " + tsQuery, "ts_rank_cd(m.search_vector, " + tsQuery + ")"
+}
+
+func (postgresDialect) SimilarTitles(a, b string) string {
+	return a + " % " + b
+}
+
+func (postgresDialect) SimilarWords(a, b string) string {
+	return a + " <% " + b
+}
+
+func (postgresDialect) InlineImages() bool {
+	return true
+}
+
+func (postgresDialect) ResetSequences(tables ...string) []string {
+	statements := make([]string, 0, len(tables))
+	for _, table := range tables {
+		statements = append(statements,
+			`SELECT setval(pg_get_serial_sequence('`+table+`', 'id'), coalesce(max(id), 0) + 1, false) FROM `+table)
+	}
+	return statements
+}
+
+// tsQuery writes the search in to_tsquery syntax. Words only ever hold letters
+// and digits, so nothing in the query can be read as an operator.
+func tsQuery(query model.SearchQuery) string {
+	terms := make([]string, 0, len(query.Terms))
+	for _, term := range query.Terms {
+		words := append([]string(nil), term.Words...)
+		if term.Prefix {
+			words[len(words)-1] += ":*"
+		}
+		text := "(" + strings.Join(words, " <-> ") + ")"
+		if term.Exclude {
+			text = "!" + text
+		}
+		terms = append(terms, text)
+	}
+	return strings.Join(terms, " & ")
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"go-jellyfin-api/cmd/model"
+	"math/rand/v2"
+)
+
+const (
+	// sampleRounds is how many rounds of random probes are made before the
+	// ids still missing are picked by shuffling every matching id instead.
+	sampleRounds = 3
+	// sampleOversampling is how many probes a round makes per missing id
+	// before anything is known about how many of them will hit.
+	sampleOversampling = 4
+	// maxSampleProbes caps the probes bound in one round.
+	maxSampleProbes = 1000
+)
+
+// sampleMovieIds picks up to n distinct ids out of idColumn, uniformly at
+// random, from the rows of from that the filter lets through, without sorting
+// the whole table.
+//
+// Each round draws random ids between the smallest and largest movie id and
+// keeps the ones that exist and match, so every matching row is as likely to
+// be drawn as any other however the ids are spread out, and the filter is
+// checked once per drawn row rather than once per probe. When the rounds come
+// up short, because few rows match or the ids are sparse, the rest are picked
+// by shuffling the matching ids that weren't picked yet, which is cheap for
+// such a small set.
+func (d *Database) sampleMovieIds(ctx context.Context, n int, from, idColumn string, filter model.MovieFilter) ([]int, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	var lo, hi *int
+	if err := d.conn(ctx).QueryRow(ctx, `SELECT min(id), max(id) FROM movie`).Scan(&lo, &hi); err != nil {
+		return nil, err
+	}
+	if lo == nil {
+		return nil, nil
+	}
+
+	var picked []int
+	seen := map[int]bool{}
+	drawn, hits := 0, 0
+	probes := n*sampleOversampling + 8
+	for round := 0; round < sampleRounds && len(picked) < n; round++ {
+		candidates := make([]int, probes)
+		for i := range candidates {
+			candidates[i] = *lo + rand.IntN(*hi-*lo+1)
+		}
+		p := d.params()
+		probed := d.dialect.In(idColumn, p.Add(d.dialect.List(candidates)))
+		condition := movieFilterCondition("m", filter, p)
+		ids, err := queryIds(ctx, d.conn(ctx), `
+        SELECT DISTINCT `+idColumn+`
+        FROM `+from+`
+        WHERE `+probed+` AND `+condition, p.Args()...)
+		if err != nil {
+			return nil, err
+		}
+		// The rows come back in whatever order the plan produced, so they are
+		// shuffled before the surplus is cut off.
+		rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+		for _, id := range ids {
+			if len(picked) < n && !seen[id] {
+				seen[id] = true
+				picked = append(picked, id)
+			}
+		}
+
+		drawn += probes
+		hits += len(ids)
+		probes = nextSampleProbes(n-len(picked), drawn, hits)
+	}
+	if len(picked) >= n {
+		return picked, nil
+	}
+
+	p := d.params()
+	limit, picks := p.Add(n-len(picked)), d.dialect.In(idColumn, p.Add(d.dialect.List(picked)))
+	condition := movieFilterCondition("m", filter, p)
+	rest, err := queryIds(ctx, d.conn(ctx), `
+    SELECT id FROM (
+        SELECT DISTINCT `+idColumn+` AS id
+        FROM `+from+`
+        WHERE NOT (`+picks+`) AND `+condition+`
+    ) matching
+    ORDER BY random()
+    LIMIT `+limit, p.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	picked = append(picked, rest...)
+	rand.Shuffle(len(picked), func(i, j int) { picked[i], picked[j] = picked[j], picked[i] })
+	return picked, nil
+}
+
+// nextSampleProbes sizes the next round from the share of probes that hit
+// so far, making twice as many as should be needed for the missing ids.
+func nextSampleProbes(missing, drawn, hits int) int {
+	if hits == 0 {
+		return min(drawn*4, maxSampleProbes)
+	}
+	return min(missing*drawn/hits*2+8, maxSampleProbes)
+}
+
+func queryIds(ctx context.Context, db Conn, query string, args ...any) ([]int, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
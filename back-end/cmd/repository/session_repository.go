@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-jellyfin-api/cmd/model"
+)
+
+type SessionRepository interface {
+	GetSession(ctx context.Context, host, username string) (*model.JellyfinSession, error)
+	SaveSession(ctx context.Context, session model.JellyfinSession) error
+	DeleteSession(ctx context.Context, host, username string) error
+}
+
+type sessionRepository struct {
+	db *Database
+}
+
+func NewSessionRepository(db *Database) SessionRepository {
+	return &sessionRepository{
+		db: db,
+	}
+}
+
+func (s *sessionRepository) conn(ctx context.Context) Conn {
+	return s.db.conn(ctx)
+}
+
+// GetSession returns the stored session for the account on the server, or nil
+// when there is none.
+func (s *sessionRepository) GetSession(ctx context.Context, host, username string) (*model.JellyfinSession, error) {
+	var session model.JellyfinSession
+	p := s.db.params()
+	err := s.conn(ctx).QueryRow(
+		ctx,
+		`SELECT host, username, user_id, user_name, encrypted_token, updated_at
+         FROM jellyfin_session
+         WHERE host = `+p.Add(host)+` AND username = `+p.Add(username),
+		p.Args()...,
+	).Scan(
+		&session.Host,
+		&session.Username,
+		&session.UserId,
+		&session.UserName,
+		&session.EncryptedToken,
+		s.db.dialect.ScanTime(&session.UpdatedAt),
+	)
+	if errors.Is(err, ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *sessionRepository) SaveSession(ctx context.Context, session model.JellyfinSession) error {
+	p := s.db.params()
+	_, err := s.conn(ctx).Exec(
+		ctx,
+		`INSERT INTO jellyfin_session (host, username, user_id, user_name, encrypted_token)
+         VALUES (`+p.AddAll(session.Host, session.Username, session.UserId, session.UserName, session.EncryptedToken)+`)
+         ON CONFLICT (host, username) DO UPDATE SET
+             user_id = excluded.user_id,
+             user_name = excluded.user_name,
+             encrypted_token = excluded.encrypted_token,
+             updated_at = `+s.db.dialect.Now(),
+		p.Args()...,
+	)
+	return err
+}
+
+func (s *sessionRepository) DeleteSession(ctx context.Context, host, username string) error {
+	p := s.db.params()
+	_, err := s.conn(ctx).Exec(ctx, "DELETE FROM jellyfin_session WHERE host = "+p.Add(host)+" AND username = "+p.Add(username), p.Args()...)
+	return err
+}
@@ -0,0 +1,278 @@
+package sqlite
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"go-jellyfin-api/cmd/model"
+	"go-jellyfin-api/cmd/repository"
+	"strings"
+	"time"
+)
+
+// dialect keeps lists in JSON arrays read with json_each, searches the
+// movie_search FTS4 table and, lacking trigram indexes, compares every title.
+type dialect struct{}
+
+func (dialect) Placeholder(n int) string {
+	return fmt.Sprintf("?%d", n)
+}
+
+func (dialect) List(values any) any {
+	switch values := values.(type) {
+	case []string:
+		return stringList(values)
+	case []int:
+		return intList(values)
+	}
+	return values
+}
+
+func (dialect) ScanList(target *[]string) any {
+	return (*stringList)(target)
+}
+
+func (dialect) In(expr, list string) string {
+	return expr + " IN (SELECT value FROM json_each(" + list + "))"
+}
+
+func (dialect) Elements(list, alias string) string {
+	return "json_each(" + list + ") " + alias
+}
+
+func (dialect) OrderedIds(list, alias string) string {
+	return "(SELECT value, key AS position FROM json_each(" + list + ")) " + alias
+}
+
+func (dialect) Time(t time.Time) any {
+	return timestamp(t)
+}
+
+func (dialect) NullTime(t *time.Time) any {
+	return nullTimestamp(t)
+}
+
+func (dialect) ScanTime(target *time.Time) any {
+	return timeValue{target}
+}
+
+func (dialect) ScanNullTime(target **time.Time) any {
+	return nullTimeValue{target}
+}
+
+func (dialect) JSON(data []byte) any {
+	return string(data)
+}
+
+func (dialect) ScanJSON(target *json.RawMessage) any {
+	return (*jsonText)(target)
+}
+
+func (dialect) Now() string {
+	return "CURRENT_TIMESTAMP"
+}
+
+func (dialect) Year(expr string) string {
+	return "CAST(strftime('%Y', " + expr + ") AS INTEGER)"
+}
+
+func (dialect) Greatest() string {
+	return "max"
+}
+
+func (dialect) CursorType(sort model.MovieSort) string {
+	switch sort {
+	case model.SortByYear:
+		return "INTEGER"
+	case model.SortByRating:
+		return "REAL"
+	default:
+		return "TEXT"
+	}
+}
+
+// Search matches the included terms with the movie_search table. FTS4 can't
+// match on exclusions alone, so movies matching those are left out with a
+// second match instead.
+func (dialect) Search(query model.SearchQuery, p *repository.Params) (from, condition, rank string) {
+	include, exclude := matchQueries(query)
+	from, rank = "movie m", "0.0"
+	var conditions []string
+	if include != "" {
+		from = "movie_search JOIN movie m ON m.id = movie_search.docid"
+		rank = "movie_rank(matchinfo(movie_search, 'pcx'))"
+		conditions = append(conditions, "movie_search MATCH "+p.Add(include))
+	}
+	if exclude != "" {
+		conditions = append(conditions, "m.id NOT IN (SELECT docid FROM movie_search WHERE movie_search MATCH "+p.Add(exclude)+")")
+	}
+	if len(conditions) == 0 {
+		conditions = append(conditions, "1 = 1")
+	}
+	return from, strings.Join(conditions, " AND "), rank
+}
+
+func (dialect) SimilarTitles(a, b string) string {
+	return ""
+}
+
+func (dialect) SimilarWords(a, b string) string {
+	return ""
+}
+
+// InlineImages is false: SQLite databases never stored posters inline.
+func (dialect) InlineImages() bool {
+	return false
+}
+
+// ResetSequences has nothing to do: an INTEGER PRIMARY KEY always continues
+// after the largest id in the table.
+func (dialect) ResetSequences(tables ...string) []string {
+	return nil
+}
+
+// matchQueries write the search as FTS4 match expressions: one every result
+// has to match and one none may match, either of which can be empty. FTS4
+// can't match on exclusions alone, so they are kept apart. Words only ever
+// hold letters and digits, so quoting them is enough to keep them from being
+// read as operators. They are folded with search_title, like the index.
+func matchQueries(query model.SearchQuery) (include, exclude string) {
+	var included, excluded []string
+	for _, term := range query.Terms {
+		phrase := repository.SearchTitle(strings.Join(term.Words, " "))
+		if term.Prefix {
+			phrase += "*"
+		}
+		phrase = `"` + phrase + `"`
+		if term.Exclude {
+			excluded = append(excluded, phrase)
+		} else {
+			included = append(included, phrase)
+		}
+	}
+	return strings.Join(included, " "), strings.Join(excluded, " OR ")
+}
+
+// stringList stores a []string as a JSON array.
+type stringList []string
+
+func (l stringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]string(l))
+	return string(data), err
+}
+
+func (l *stringList) Scan(src any) error {
+	var data []byte
+	switch src := src.(type) {
+	case string:
+		data = []byte(src)
+	case []byte:
+		data = src
+	case nil:
+		*l = stringList{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into a string list", src)
+	}
+	list := []string{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("scan string list: %w", err)
+	}
+	*l = list
+	return nil
+}
+
+// intList stores a []int as a JSON array.
+type intList []int
+
+func (l intList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]int(l))
+	return string(data), err
+}
+
+// jsonText scans a JSON document stored as text.
+type jsonText json.RawMessage
+
+func (j *jsonText) Scan(src any) error {
+	switch src := src.(type) {
+	case string:
+		*j = jsonText(src)
+	case []byte:
+		*j = append(jsonText(nil), src...)
+	case nil:
+		*j = nil
+	default:
+		return fmt.Errorf("cannot scan %T into JSON", src)
+	}
+	return nil
+}
+
+// timestampLayout matches what CURRENT_TIMESTAMP writes, so times written
+// from Go and by SQLite compare and sort the same.
+const timestampLayout = "2006-01-02 15:04:05"
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+// timeValue scans a timestamp whether the driver already parsed it, which it
+// does for TIMESTAMP columns, or hands over the text, which it does for
+// expressions such as max(changed_at).
+type timeValue struct {
+	time *time.Time
+}
+
+func (t timeValue) Scan(src any) error {
+	switch src := src.(type) {
+	case time.Time:
+		*t.time = src.UTC()
+		return nil
+	case string:
+		return t.parse(src)
+	case []byte:
+		return t.parse(string(src))
+	default:
+		return fmt.Errorf("cannot scan %T into a time", src)
+	}
+}
+
+func (t timeValue) parse(text string) error {
+	parsed, err := time.ParseInLocation(timestampLayout, text, time.UTC)
+	if err != nil {
+		return fmt.Errorf("scan time: %w", err)
+	}
+	*t.time = parsed
+	return nil
+}
+
+// nullTimestamp binds a nullable time as NULL or as a timestamp.
+func nullTimestamp(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return timestamp(*t)
+}
+
+// nullTimeValue scans a nullable timestamp, leaving the time nil for NULL.
+type nullTimeValue struct {
+	time **time.Time
+}
+
+func (t nullTimeValue) Scan(src any) error {
+	if src == nil {
+		*t.time = nil
+		return nil
+	}
+	var parsed time.Time
+	if err := (timeValue{&parsed}).Scan(src); err != nil {
+		return err
+	}
+	*t.time = &parsed
+	return nil
+}
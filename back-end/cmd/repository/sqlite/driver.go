@@ -0,0 +1,111 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-jellyfin-api/cmd/repository"
+)
+
+// NewDatabase runs the repositories on db, opened with Open.
+func NewDatabase(db *sql.DB) *repository.Database {
+	return repository.NewDatabase(sqlDriver{sqlConn{db}, db}, dialect{})
+}
+
+// queryer is what database/sql runs statements on: the database or a
+// transaction.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type sqlConn struct {
+	db queryer
+}
+
+func (c sqlConn) Exec(ctx context.Context, query string, args ...any) (int64, error) {
+	result, err := c.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (c sqlConn) Query(ctx context.Context, query string, args ...any) (repository.Rows, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return sqlRows{rows}, nil
+}
+
+func (c sqlConn) QueryRow(ctx context.Context, query string, args ...any) repository.Row {
+	return sqlRow{c.db.QueryRowContext(ctx, query, args...)}
+}
+
+// Batch runs the statements one after the other; SQLite runs in process, so
+// there are no round trips to save.
+func (c sqlConn) Batch(ctx context.Context, statements []repository.Statement) ([]int64, error) {
+	affected := make([]int64, len(statements))
+	for i, statement := range statements {
+		count, err := c.Exec(ctx, statement.Query, statement.Args...)
+		if err != nil {
+			return nil, err
+		}
+		affected[i] = count
+	}
+	return affected, nil
+}
+
+type sqlRows struct {
+	*sql.Rows
+}
+
+func (r sqlRows) Close() {
+	r.Rows.Close()
+}
+
+type sqlRow struct {
+	row *sql.Row
+}
+
+func (r sqlRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrNoRows
+	}
+	return err
+}
+
+type sqlDriver struct {
+	sqlConn
+	db *sql.DB
+}
+
+// Begin starts a transaction. Every transaction takes the write lock up
+// front, and in WAL mode sees the tables as they were when it started, so a
+// snapshot is just a transaction.
+func (d sqlDriver) Begin(ctx context.Context, snapshot bool) (repository.Tx, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sqlTx{sqlConn{tx}, tx}, nil
+}
+
+type sqlTx struct {
+	sqlConn
+	tx *sql.Tx
+}
+
+func (t sqlTx) Commit(ctx context.Context) error {
+	return t.tx.Commit()
+}
+
+func (t sqlTx) Rollback(ctx context.Context) error {
+	if err := t.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return err
+	}
+	return nil
+}
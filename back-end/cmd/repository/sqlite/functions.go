@@ -0,0 +1,33 @@
+package sqlite
+
+import (
+	"encoding/binary"
+)
+
+// searchColumnWeights weight the movie_search columns the way the Postgres
+// search vector weighs them: titles A, genres B, people C and the overview D,
+// using ts_rank's default weights.
+var searchColumnWeights = []float64{1.0, 1.0, 0.4, 0.2, 0.1}
+
+// movieRank scores a movie_search match from matchinfo(movie_search, 'pcx'):
+// the hits of every phrase in every column, weighted by column.
+func movieRank(info []byte) float64 {
+	values := make([]uint32, len(info)/4)
+	for i := range values {
+		values[i] = binary.NativeEndian.Uint32(info[i*4:])
+	}
+	if len(values) < 2 {
+		return 0
+	}
+	phrases, columns := int(values[0]), int(values[1])
+	rank := 0.0
+	for p := 0; p < phrases; p++ {
+		for c := 0; c < columns && c < len(searchColumnWeights); c++ {
+			index := 2 + 3*(p*columns+c)
+			if index < len(values) {
+				rank += searchColumnWeights[c] * float64(values[index])
+			}
+		}
+	}
+	return rank
+}
@@ -0,0 +1,58 @@
+// Package sqlite implements the repositories on SQLite, so the backend can
+// run as one binary with one data file instead of next to Postgres.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"go-jellyfin-api/cmd/repository"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName is the SQLite driver with the backend's SQL functions added.
+const driverName = "sqlite3_movies"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			functions := map[string]any{
+				"search_title":    repository.SearchTitle,
+				"similarity":      repository.Similarity,
+				"word_similarity": repository.WordSimilarity,
+				"movie_rank":      movieRank,
+			}
+			for name, impl := range functions {
+				if err := conn.RegisterFunc(name, impl, true); err != nil {
+					return fmt.Errorf("register %s: %w", name, err)
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// Open opens the database file at path, creating it and its directory if
+// needed. The schema is migrated separately.
+func Open(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create database directory: %w", err)
+	}
+
+	// WAL lets the API read while a sync writes. Transactions take the write
+	// lock up front so two writers wait for each other instead of failing.
+	options := url.Values{
+		"_foreign_keys": {"on"},
+		"_journal_mode": {"WAL"},
+		"_busy_timeout": {"5000"},
+		"_txlock":       {"immediate"},
+	}
+	db, err := sql.Open(driverName, "file:"+path+"?"+options.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	return db, nil
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// The title matching the Postgres schema gets from unaccent and pg_trgm,
+// written out for the repositories that don't run on Postgres.
+
+// unaccentLetters are the letters unaccent replaces that carry no separable
+// accent, so dropping combining marks leaves them as they are.
+var unaccentLetters = map[rune]string{
+	'Æ': "AE", 'æ': "ae", 'Ø': "O", 'ø': "o", 'ß': "ss", 'Ł': "L", 'ł': "l",
+	'Đ': "D", 'đ': "d", 'Ð': "D", 'ð': "d", 'Þ': "TH", 'þ': "th", 'Œ': "OE",
+	'œ': "oe", 'ı': "i", 'Ħ': "H", 'ħ': "h", 'Ŧ': "T", 'ŧ': "t", 'Ŀ': "L", 'ŀ': "l",
+}
+
+// SearchTitle lowercases the title and drops its accents, like the Postgres
+// search_title function. Full-text search folds words the same way on every
+// backend.
+func SearchTitle(title string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(title) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if replacement, ok := unaccentLetters[r]; ok {
+			b.WriteString(strings.ToLower(replacement))
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// trigrams returns the set of trigrams pg_trgm takes from text.
+func trigrams(text string) map[string]bool {
+	set := make(map[string]bool)
+	for _, trigram := range trigramList(text) {
+		set[trigram] = true
+	}
+	return set
+}
+
+// trigramList returns the trigrams pg_trgm takes from text, in order and
+// with repeats: every word of letters and digits, padded with two spaces in
+// front and one behind, cut into overlapping runs of three characters.
+func trigramList(text string) []string {
+	var list []string
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			list = append(list, string(padded[i:i+3]))
+		}
+	}
+	return list
+}
+
+func sharedTrigrams(a, b map[string]bool) int {
+	shared := 0
+	for trigram := range a {
+		if b[trigram] {
+			shared++
+		}
+	}
+	return shared
+}
+
+// Similarity is pg_trgm's similarity: the trigrams both texts share over all
+// the trigrams either has.
+func Similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	shared := sharedTrigrams(ta, tb)
+	if total := len(ta) + len(tb) - shared; total > 0 {
+		return float64(shared) / float64(total)
+	}
+	return 0
+}
+
+// WordSimilarity is pg_trgm's word_similarity: the greatest similarity
+// between the trigrams of a and those of any run of consecutive trigrams of
+// b, so a partly typed title scores high against the whole one, but not
+// against a title that merely has its words scattered about.
+//
+// It follows pg_trgm's iterate_word_similarity: the run grows to each trigram
+// of b that a shares, and its start moves up whenever dropping the trigrams
+// before it scores higher.
+func WordSimilarity(a, b string) float64 {
+	ta, list := trigrams(a), trigramList(b)
+	if len(ta) == 0 || len(list) == 0 {
+		return 0
+	}
+
+	// Number the distinct trigrams of b and note which of them a has.
+	numbers := make(map[string]int)
+	trigram := make([]int, len(list))
+	var shared []bool
+	for i, t := range list {
+		n, ok := numbers[t]
+		if !ok {
+			n = len(shared)
+			numbers[t] = n
+			shared = append(shared, ta[t])
+		}
+		trigram[i] = n
+	}
+	// lastSeen is where in the run each trigram was last seen, or -1.
+	lastSeen := make([]int, len(shared))
+	for i := range lastSeen {
+		lastSeen[i] = -1
+	}
+
+	similarity := func(common, distinct int) float64 {
+		return float64(common) / float64(len(ta)+distinct-common)
+	}
+	best := 0.0
+	lower, distinct, common := -1, 0, 0
+	for upper, t := range trigram {
+		if lower >= 0 || shared[t] {
+			if lastSeen[t] < 0 {
+				distinct++
+				if shared[t] {
+					common++
+				}
+			}
+			lastSeen[t] = upper
+		}
+		if !shared[t] {
+			continue
+		}
+		if lower < 0 {
+			lower, distinct = upper, 1
+		}
+
+		current := similarity(common, distinct)
+		previousLower := lower
+		tryCommon, tryDistinct := common, distinct
+		for start := lower; start <= upper; start++ {
+			if s := similarity(tryCommon, tryDistinct); s > current {
+				current, lower, common, distinct = s, start, tryCommon, tryDistinct
+			}
+			if dropped := trigram[start]; lastSeen[dropped] == start {
+				tryDistinct--
+				if shared[dropped] {
+					tryCommon--
+				}
+			}
+		}
+		best = max(best, current)
+
+		for start := previousLower; start < lower; start++ {
+			if dropped := trigram[start]; lastSeen[dropped] == start {
+				lastSeen[dropped] = -1
+			}
+		}
+	}
+	return best
+}
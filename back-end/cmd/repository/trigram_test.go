@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWordSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		// The example from the pg_trgm documentation.
+		{"word", "two words", 0.8},
+		{"alien", "Alien", 1},
+		{"alie", "Alien", 0.8},
+		// Both words are in b, but far apart: the best run either holds one
+		// of them or all the trigrams in between.
+		{"ab cd", "ab xx yy cd", 0.5},
+		{"", "alien", 0},
+		{"alien", "", 0},
+	}
+	for _, test := range tests {
+		if got := WordSimilarity(test.a, test.b); math.Abs(got-test.want) > 1e-6 {
+			t.Errorf("WordSimilarity(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	// The example from the pg_trgm documentation.
+	if got, want := Similarity("word", "two words"), 4.0/11; math.Abs(got-want) > 1e-6 {
+		t.Errorf("Similarity(\"word\", \"two words\") = %v, want %v", got, want)
+	}
+}
+
+func TestSearchTitle(t *testing.T) {
+	// What lower(unaccent(title)) gives on Postgres.
+	tests := map[string]string{
+		"Amélie":            "amelie",
+		"Kærlighed på film": "kaerlighed pa film",
+		"Søren":             "soren",
+		"Straße":            "strasse",
+		"Łódź":              "lodz",
+		"Þór":               "thor",
+		"Cœur":              "coeur",
+	}
+	for title, want := range tests {
+		if got := SearchTitle(title); got != want {
+			t.Errorf("SearchTitle(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
@@ -4,9 +4,7 @@ import (
 	"context"
 	"fmt"
 	"go-jellyfin-api/cmd/model"
-
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"log"
 )
 
 type WatchlistRepository interface {
@@ -15,58 +13,98 @@ type WatchlistRepository interface {
 }
 
 type watchlistRepository struct {
-	pool *pgxpool.Pool
+	db *Database
 }
 
-func NewWatchlistRepository(pool *pgxpool.Pool) WatchlistRepository {
+func NewWatchlistRepository(db *Database) WatchlistRepository {
 	return &watchlistRepository{
-		pool: pool,
+		db: db,
 	}
 }
 
+func (w *watchlistRepository) conn(ctx context.Context) Conn {
+	return w.db.conn(ctx)
+}
+
+func (w *watchlistRepository) upsert(item model.WatchlistItem) Statement {
+	d := w.db.dialect
+	p := w.db.params()
+	values := p.AddAll(item.Title, d.Time(item.DateReleased), d.Time(item.DateAdded), item.LetterboxdUri, item.ImdbId, item.TmdbId)
+	query := `
+      INSERT INTO watchlist(title, production_year, added_date, letterboxd_uri, imdb_id, tmdb_id)
+      VALUES (` + values + `)
+      ON CONFLICT (letterboxd_uri) DO UPDATE SET
+          imdb_id = CASE WHEN excluded.imdb_id <> '' THEN excluded.imdb_id ELSE watchlist.imdb_id END,
+          tmdb_id = CASE WHEN excluded.tmdb_id <> '' THEN excluded.tmdb_id ELSE watchlist.tmdb_id END
+      `
+	return Statement{query, p.Args()}
+}
+
+// PopulateDatabase upserts the entries in one batch. If the batch fails, the
+// entries are retried one at a time, each in its own savepoint, and the ones
+// that still fail are logged and skipped.
 func (w *watchlistRepository) PopulateDatabase(ctx context.Context, items model.Watchlist) error {
-	batch := &pgx.Batch{}
+	if len(items.WatchlistItems) == 0 {
+		return nil
+	}
+	statements := make([]Statement, 0, len(items.WatchlistItems))
 	for _, item := range items.WatchlistItems {
-		batch.Queue(
-			`
-      INSERT INTO watchlist(title, production_year, added_date, letterboxd_uri)
-      VALUES ($1, $2, $3, $4)
-      ON CONFLICT (letterboxd_uri) DO NOTHING 
-      `,
-			item.Title,
-			item.DateReleased,
-			item.DateAdded,
-			item.LetterboxdUri,
-		)
+		statements = append(statements, w.upsert(item))
 	}
 
-	if batch.Len() > 0 {
-		br := w.pool.SendBatch(ctx, batch)
-		defer br.Close()
-		if err := br.Close(); err != nil {
+	return w.db.Do(ctx, func(ctx context.Context) error {
+		err := w.db.savepoint(ctx, func(ctx context.Context) error {
+			_, err := w.conn(ctx).Batch(ctx, statements)
+			return err
+		})
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
 			return fmt.Errorf("failed to execute batch: %w", err)
 		}
-	}
-	return nil
+		log.Printf("Watchlist batch failed, retrying entries one by one: %v\n", err)
+
+		skipped := 0
+		for i, item := range items.WatchlistItems {
+			err := w.db.savepoint(ctx, func(ctx context.Context) error {
+				_, err := w.conn(ctx).Exec(ctx, statements[i].Query, statements[i].Args...)
+				return err
+			})
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				log.Printf("Skipping watchlist entry %s: %v\n", item.LetterboxdUri, err)
+				skipped++
+			}
+		}
+		if skipped > 0 {
+			log.Printf("Skipped %d of %d watchlist entries\n", skipped, len(items.WatchlistItems))
+		}
+		return nil
+	})
 }
 
 func (w *watchlistRepository) GetAllWatchlist(ctx context.Context) ([]model.WatchlistItem, error) {
 	query := `
-		SELECT id, title, production_year, added_date from watchlist
+		SELECT id, title, production_year, added_date, letterboxd_uri, imdb_id, tmdb_id from watchlist
 	`
-	rows, err := w.pool.Query(ctx, query)
+	rows, err := w.conn(ctx).Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	d := w.db.dialect
 	var watchlist []model.WatchlistItem
 	for rows.Next() {
 		var item model.WatchlistItem
-		if err := rows.Scan(&item.Id, &item.Title, &item.DateReleased, &item.DateAdded); err != nil {
+		if err := rows.Scan(&item.Id, &item.Title, d.ScanTime(&item.DateReleased), d.ScanTime(&item.DateAdded),
+			&item.LetterboxdUri, &item.ImdbId, &item.TmdbId); err != nil {
 			return nil, err
 		}
 		watchlist = append(watchlist, item)
 	}
-	return watchlist, nil
+	return watchlist, rows.Err()
 }
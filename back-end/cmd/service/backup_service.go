@@ -0,0 +1,214 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-jellyfin-api/cmd/blob"
+	"go-jellyfin-api/cmd/model"
+	"go-jellyfin-api/cmd/repository"
+	"io"
+	"log"
+	"path"
+	"slices"
+	"time"
+)
+
+// Backup archives are a gzipped tar holding backupManifest first and then
+// every poster under backupImageDir, named by its hash.
+const (
+	backupManifest = "backup.json"
+	backupImageDir = "images"
+)
+
+// maxBackupImageSize keeps a damaged archive from claiming an entry so large
+// reading it would exhaust memory.
+const maxBackupImageSize = 64 << 20
+
+type BackupService interface {
+	// Export reads everything stored, Jellyfin sessions only with sessions
+	// set. It is separate from WriteArchive so a failure can still be reported
+	// before any of the archive is sent.
+	Export(ctx context.Context, sessions bool) (model.Backup, error)
+	// WriteArchive writes the backup and its posters to w as a tar.gz.
+	WriteArchive(ctx context.Context, w io.Writer, backup model.Backup) error
+	// Restore reads an archive written by WriteArchive, imports it and then
+	// puts its posters in the image store. It refuses a database that already
+	// holds movies or watchlist entries unless force is set, in which case the
+	// backup is merged into them. Restoring the same archive again changes
+	// nothing.
+	Restore(ctx context.Context, r io.Reader, force bool) (model.Backup, error)
+}
+
+type backupService struct {
+	repository repository.BackupRepository
+	images     blob.Store
+}
+
+func NewBackupService(repository repository.BackupRepository, images blob.Store) BackupService {
+	return &backupService{
+		repository: repository,
+		images:     images,
+	}
+}
+
+func (b *backupService) Export(ctx context.Context, sessions bool) (model.Backup, error) {
+	backup, err := b.repository.Export(ctx, sessions)
+	if err != nil {
+		return model.Backup{}, fmt.Errorf("failed to export database: %w", err)
+	}
+	return backup, nil
+}
+
+func (b *backupService) WriteArchive(ctx context.Context, w io.Writer, backup model.Backup) error {
+	manifest, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode backup: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	if err := writeArchiveEntry(archive, backupManifest, manifest, backup.CreatedAt); err != nil {
+		return err
+	}
+	missing := 0
+	for _, hash := range backupImageHashes(backup) {
+		data, err := b.images.Get(ctx, hash)
+		if errors.Is(err, blob.ErrNotFound) {
+			missing++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read poster %s: %w", hash, err)
+		}
+		if err := writeArchiveEntry(archive, path.Join(backupImageDir, hash), data, backup.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if missing > 0 {
+		log.Printf("Left %d posters missing from the image store out of the backup\n", missing)
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to finish backup archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to finish backup archive: %w", err)
+	}
+	return nil
+}
+
+func writeArchiveEntry(archive *tar.Writer, name string, data []byte, modified time.Time) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: modified,
+	}
+	if err := archive.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s to backup: %w", name, err)
+	}
+	if _, err := archive.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s to backup: %w", name, err)
+	}
+	return nil
+}
+
+// backupImageHashes lists every poster the backup refers to once.
+func backupImageHashes(backup model.Backup) []string {
+	var hashes []string
+	for _, movie := range backup.Movies {
+		if movie.Image != nil {
+			hashes = append(hashes, movie.Image.Hash)
+		}
+	}
+	slices.Sort(hashes)
+	return slices.Compact(hashes)
+}
+
+func (b *backupService) Restore(ctx context.Context, r io.Reader, force bool) (model.Backup, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return model.Backup{}, fmt.Errorf("failed to read backup archive: %w", err)
+	}
+	defer gz.Close()
+	archive := tar.NewReader(gz)
+
+	header, err := archive.Next()
+	if err != nil {
+		return model.Backup{}, fmt.Errorf("failed to read backup archive: %w", err)
+	}
+	if header.Name != backupManifest {
+		return model.Backup{}, fmt.Errorf("backup archive starts with %s instead of %s", header.Name, backupManifest)
+	}
+	var backup model.Backup
+	if err := json.NewDecoder(archive).Decode(&backup); err != nil {
+		return model.Backup{}, fmt.Errorf("failed to decode %s: %w", backupManifest, err)
+	}
+	if backup.Format < 1 || backup.Format > model.BackupFormat {
+		return model.Backup{}, fmt.Errorf("backup format %d is not supported, this build reads up to %d", backup.Format, model.BackupFormat)
+	}
+
+	// The database goes first, so a backup that can't be imported leaves
+	// nothing behind in the image store. A poster that then fails to store
+	// only leaves its movie without one until the restore is run again.
+	if err := b.repository.Import(ctx, backup, force); err != nil {
+		if errors.Is(err, repository.ErrNotEmpty) {
+			return model.Backup{}, errors.New("the database already holds movies or watchlist entries, restore with -force to merge the backup into them")
+		}
+		return model.Backup{}, fmt.Errorf("failed to import backup: %w", err)
+	}
+
+	contentTypes := make(map[string]string)
+	for _, movie := range backup.Movies {
+		if movie.Image != nil {
+			contentTypes[movie.Image.Hash] = movie.Image.ContentType
+		}
+	}
+	if err := b.restoreImages(ctx, archive, contentTypes); err != nil {
+		return model.Backup{}, fmt.Errorf("restored the database, but not every poster, restore again with -force to finish: %w", err)
+	}
+	return backup, nil
+}
+
+// restoreImages puts the posters that follow the manifest in the image
+// store. Putting one that is already stored is a no-op.
+func (b *backupService) restoreImages(ctx context.Context, archive *tar.Reader, contentTypes map[string]string) error {
+	restored := make(map[string]bool, len(contentTypes))
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read backup archive: %w", err)
+		}
+		dir, hash := path.Split(header.Name)
+		contentType, wanted := contentTypes[hash]
+		if path.Clean(dir) != backupImageDir || !wanted {
+			log.Printf("Skipping unexpected %s in backup archive\n", header.Name)
+			continue
+		}
+		if header.Size > maxBackupImageSize {
+			return fmt.Errorf("poster %s in backup is too large", hash)
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return fmt.Errorf("failed to read poster %s from backup: %w", hash, err)
+		}
+		if blob.Key(data) != hash {
+			return fmt.Errorf("poster %s in backup is corrupt", hash)
+		}
+		if err := b.images.Put(ctx, hash, data, contentType); err != nil {
+			return fmt.Errorf("failed to store poster %s: %w", hash, err)
+		}
+		restored[hash] = true
+	}
+	if missing := len(contentTypes) - len(restored); missing > 0 {
+		log.Printf("Backup is missing %d of the posters its movies refer to\n", missing)
+	}
+	return nil
+}
@@ -2,29 +2,46 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"go-jellyfin-api/cmd/config"
 	"go-jellyfin-api/cmd/model"
 	"go-jellyfin-api/cmd/repository"
+	"log/slog"
 )
 
 type JellyfinService interface {
-	GetRandomMovies(ctx context.Context, noOfMovies int) ([]model.MovieWithImage, error)
+	GetRandomMovies(ctx context.Context, noOfMovies int, filter model.MovieFilter) ([]model.MovieWithImage, error)
+	GetContinueWatching(ctx context.Context, user model.JellyfinUser) ([]model.ContinueWatchingMovie, error)
+	GetInProgressJellyfinIds(ctx context.Context, user model.JellyfinUser) ([]string, error)
+}
+
+// JellyfinItemClient is the part of the Jellyfin HTTP client the service needs.
+// It is declared here because the http package already depends on service.
+type JellyfinItemClient interface {
+	GetResumeMoviesRequest(user model.JellyfinUser, parentId string) (model.Items, error)
+	PopulateMovieImageData(items model.Items) (*model.Items, error)
 }
 
 type jellyfinService struct {
-	cfg             config.JellyfinConfiguration
-	movieRepository repository.MovieRepository
+	cfg                 config.JellyfinConfiguration
+	client              JellyfinItemClient
+	movieFolderParentId string
+	movieRepository     repository.MovieRepository
 }
 
-func NewJellyfinService(cfg config.JellyfinConfiguration, m repository.MovieRepository) JellyfinService {
+func NewJellyfinService(cfg config.JellyfinConfiguration, client JellyfinItemClient, movieFolderParentId string,
+	m repository.MovieRepository,
+) JellyfinService {
 	return &jellyfinService{
-		cfg:             cfg,
-		movieRepository: m,
+		cfg:                 cfg,
+		client:              client,
+		movieFolderParentId: movieFolderParentId,
+		movieRepository:     m,
 	}
 }
 
-func (s jellyfinService) GetRandomMovies(ctx context.Context, noOfMovies int) ([]model.MovieWithImage, error) {
-	outcome, err := s.movieRepository.GetRandomMovies(ctx, noOfMovies)
+func (s jellyfinService) GetRandomMovies(ctx context.Context, noOfMovies int, filter model.MovieFilter) ([]model.MovieWithImage, error) {
+	outcome, err := s.movieRepository.GetRandomMovies(ctx, noOfMovies, filter)
 
 	if err != nil {
 		return nil, err
@@ -32,3 +49,78 @@ func (s jellyfinService) GetRandomMovies(ctx context.Context, noOfMovies int) ([
 
 	return outcome, nil
 }
+
+func (s jellyfinService) GetContinueWatching(ctx context.Context, user model.JellyfinUser) ([]model.ContinueWatchingMovie, error) {
+	items, err := s.getInProgressItems(user)
+	if err != nil {
+		return nil, err
+	}
+
+	movies := make([]model.ContinueWatchingMovie, 0, len(items))
+	for _, item := range items {
+		movie, err := s.movieWithImage(ctx, item)
+		if err != nil {
+			slog.Warn("Failed to load poster", "item_id", item.Id, "error", err)
+			continue
+		}
+		movies = append(movies, model.ContinueWatchingMovie{
+			Movie:                 movie.Movie,
+			MovieImage:            movie.MovieImage,
+			PercentComplete:       item.PercentComplete(),
+			PlaybackPositionTicks: item.UserData.PlaybackPositionTicks,
+			RunTimeTicks:          item.RunTimeTicks,
+		})
+	}
+	return movies, nil
+}
+
+func (s jellyfinService) GetInProgressJellyfinIds(ctx context.Context, user model.JellyfinUser) ([]string, error) {
+	items, err := s.getInProgressItems(user)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.Id)
+	}
+	return ids, nil
+}
+
+// getInProgressItems returns Jellyfin's resume list, dropping anything that
+// has since been marked as played.
+func (s jellyfinService) getInProgressItems(user model.JellyfinUser) ([]model.ItemsElement, error) {
+	resume, err := s.client.GetResumeMoviesRequest(user, s.movieFolderParentId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resume items: %w", err)
+	}
+	var items []model.ItemsElement
+	for _, item := range resume.ItemElements {
+		if item.IsInProgress() {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// movieWithImage prefers the synced copy of the movie and only goes back to
+// Jellyfin for the poster when the movie has not been synced yet.
+func (s jellyfinService) movieWithImage(ctx context.Context, item model.ItemsElement) (model.MovieWithImage, error) {
+	movie, err := s.movieRepository.GetMovieByJellyfinIdWithImage(ctx, item.Id)
+	if err == nil {
+		return movie, nil
+	}
+
+	withImage, err := s.client.PopulateMovieImageData(model.Items{ItemElements: []model.ItemsElement{item}})
+	if err != nil {
+		return model.MovieWithImage{}, err
+	}
+	return model.MovieWithImage{
+		Movie: model.Movie{
+			JellyfinId:      item.Id,
+			Name:            item.Name,
+			ProductionYear:  int(item.ProductionYear),
+			CommunityRating: item.CommunityRating,
+		},
+		MovieImage: withImage.ItemElements[0].Image,
+	}, nil
+}
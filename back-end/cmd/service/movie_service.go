@@ -3,18 +3,27 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"go-jellyfin-api/cmd/model"
 	"go-jellyfin-api/cmd/repository"
+	"strings"
 )
 
 type MovieService interface {
 	GetMovieByName(ctx context.Context, name string) (*model.Movie, error)
-	GetRandomMovies(ctx context.Context, numberOfMovies int) ([]model.MovieWithImage, error)
+	GetRandomMovies(ctx context.Context, numberOfMovies int, filter model.MovieFilter) ([]model.MovieWithImage, error)
 	GetAllMovies(ctx context.Context) ([]model.Movie, error)
 	GetMovieById(ctx context.Context, id int) (model.Movie, error)
 	GetMovieByIdWithImage(ctx context.Context, id int) (model.MovieWithImage, error)
+	GetRecentlyUpdatedMovies(ctx context.Context, limit int, filter model.MovieFilter) ([]model.RecentlyUpdatedMovie, error)
+	SearchMovies(ctx context.Context, rawQuery string, limit, offset int, filter model.MovieFilter) (model.MovieSearchPage, error)
+	SuggestMovies(ctx context.Context, text string, limit int, filter model.MovieFilter) ([]model.MovieSuggestion, error)
+	ListMovies(ctx context.Context, query model.MovieListQuery) (model.MoviePage, error)
 }
 
+// ErrEmptySearchQuery is returned for a search with nothing to look for.
+var ErrEmptySearchQuery = errors.New("search query has no words to match")
+
 type movieService struct {
 	repository repository.MovieRepository
 }
@@ -41,12 +50,12 @@ func (m *movieService) GetMovieByName(ctx context.Context, name string) (*model.
 	return movie, nil
 }
 
-func (m *movieService) GetRandomMovies(ctx context.Context, numberOfMovies int) ([]model.MovieWithImage, error) {
+func (m *movieService) GetRandomMovies(ctx context.Context, numberOfMovies int, filter model.MovieFilter) ([]model.MovieWithImage, error) {
 	if numberOfMovies <= 0 {
 		return nil, errors.New("Must provide a positive numberOfMovies")
 	}
 
-	movies, err := m.repository.GetRandomMovies(ctx, numberOfMovies)
+	movies, err := m.repository.GetRandomMovies(ctx, numberOfMovies, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -69,3 +78,50 @@ func (m *movieService) GetMovieByIdWithImage(ctx context.Context, id int) (model
 	}
 	return movie, nil
 }
+
+func (m *movieService) GetRecentlyUpdatedMovies(ctx context.Context, limit int, filter model.MovieFilter) ([]model.RecentlyUpdatedMovie, error) {
+	if limit <= 0 {
+		return nil, errors.New("Must provide a positive limit")
+	}
+	return m.repository.GetRecentlyUpdatedMovies(ctx, limit, filter)
+}
+
+func (m *movieService) SearchMovies(ctx context.Context, rawQuery string, limit, offset int, filter model.MovieFilter) (model.MovieSearchPage, error) {
+	query := model.ParseSearchQuery(rawQuery)
+	if query.IsEmpty() {
+		return model.MovieSearchPage{}, ErrEmptySearchQuery
+	}
+	if limit <= 0 || offset < 0 {
+		return model.MovieSearchPage{}, errors.New("Must provide a positive limit and a non-negative offset")
+	}
+	return m.repository.SearchMovies(ctx, query, limit, offset, filter)
+}
+
+func (m *movieService) SuggestMovies(ctx context.Context, text string, limit int, filter model.MovieFilter) ([]model.MovieSuggestion, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrEmptySearchQuery
+	}
+	if limit <= 0 {
+		return nil, errors.New("Must provide a positive limit")
+	}
+	return m.repository.SuggestMovies(ctx, text, limit, filter)
+}
+
+// ListMovies returns a page of the movie listing. A cursor only continues the
+// listing it came from, so one taken under another sort order is rejected.
+func (m *movieService) ListMovies(ctx context.Context, query model.MovieListQuery) (model.MoviePage, error) {
+	if query.Limit <= 0 {
+		return model.MoviePage{}, errors.New("Must provide a positive limit")
+	}
+	if query.Sort == "" {
+		query.Sort = model.SortByTitle
+	}
+	if !query.Sort.IsValid() {
+		return model.MoviePage{}, fmt.Errorf("unknown sort order %q", query.Sort)
+	}
+	if query.After != nil && (query.After.Sort != query.Sort || query.After.Descending != query.Descending) {
+		return model.MoviePage{}, model.ErrInvalidCursor
+	}
+	return m.repository.ListMovies(ctx, query)
+}
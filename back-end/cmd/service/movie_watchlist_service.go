@@ -5,14 +5,18 @@ import (
 	"fmt"
 	"go-jellyfin-api/cmd/model"
 	"go-jellyfin-api/cmd/repository"
-	"strings"
+	"log"
 )
 
 type MovieWatchlistService interface {
 	PopulateDatabase(ctx context.Context) ([]model.MovieWatchlistPair, error)
-	GetRandomMovieWatchlist(ctx context.Context, noOfMovies int) ([]model.MovieWithImage, error)
+	GetRandomMovieWatchlist(ctx context.Context, noOfMovies int, filter model.MovieFilter) ([]model.MovieWithImage, error)
 }
 
+// fuzzyMatchThreshold is the trigram similarity a watchlist title needs to be
+// paired with a movie when no title matches exactly.
+const fuzzyMatchThreshold = 0.6
+
 type movieWatchlistService struct {
 	mService MovieService
 	wService WatchlistService
@@ -39,6 +43,7 @@ func (mw *movieWatchlistService) PopulateDatabase(ctx context.Context) ([]model.
 	}
 
 	var pairs []model.MovieWatchlistPair
+	matched := make(map[int]bool)
 	for _, movie := range movies {
 		for _, watchlist := range watchlist {
 			if mw.matches(movie, watchlist) {
@@ -47,9 +52,26 @@ func (mw *movieWatchlistService) PopulateDatabase(ctx context.Context) ([]model.
 					WatchlistId: watchlist.Id,
 					AddedDate:   watchlist.DateAdded,
 				})
+				matched[watchlist.Id] = true
 			}
 		}
 	}
+
+	var unmatched []int
+	for _, item := range watchlist {
+		if !matched[item.Id] {
+			unmatched = append(unmatched, item.Id)
+		}
+	}
+	fuzzy, err := mw.repo.FindFuzzyPairs(ctx, unmatched, fuzzyMatchThreshold)
+	if err != nil {
+		return nil, err
+	}
+	if len(fuzzy) > 0 {
+		log.Printf("Matched %d watchlist entries by similar title\n", len(fuzzy))
+	}
+	pairs = append(pairs, fuzzy...)
+
 	err = mw.repo.InsertPairs(ctx, pairs)
 	if err != nil {
 		return nil, err
@@ -57,8 +79,8 @@ func (mw *movieWatchlistService) PopulateDatabase(ctx context.Context) ([]model.
 	return pairs, nil
 }
 
-func (mw *movieWatchlistService) GetRandomMovieWatchlist(ctx context.Context, noOfMovies int) ([]model.MovieWithImage, error) {
-	items, err := mw.repo.GetRandomMovies(ctx, noOfMovies)
+func (mw *movieWatchlistService) GetRandomMovieWatchlist(ctx context.Context, noOfMovies int, filter model.MovieFilter) ([]model.MovieWithImage, error) {
+	items, err := mw.repo.GetRandomMovies(ctx, noOfMovies, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -74,6 +96,22 @@ func (mw *movieWatchlistService) GetRandomMovieWatchlist(ctx context.Context, no
 	return movies, nil
 }
 
+// matches pairs a movie with a watchlist entry by IMDb or TMDb id when both
+// sides have one. Otherwise the entry has to be released the same year and its
+// title has to equal any of the movie's names once accents, case and
+// punctuation are ignored.
 func (mw *movieWatchlistService) matches(movie model.Movie, watchlist model.WatchlistItem) bool {
-	return strings.EqualFold(movie.Name, watchlist.Title) && movie.ProductionYear == watchlist.DateReleased.Year()
+	if matched, compared := movie.ProviderIds.Matches(watchlist.ProviderIds); compared {
+		return matched
+	}
+	if movie.ProductionYear != watchlist.DateReleased.Year() {
+		return false
+	}
+	title := normalizeTitle(watchlist.Title)
+	for _, name := range movie.Titles() {
+		if normalizeTitle(name) == title {
+			return true
+		}
+	}
+	return false
 }
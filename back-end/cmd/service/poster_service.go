@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-jellyfin-api/cmd/blob"
+	"go-jellyfin-api/cmd/cache"
+	"go-jellyfin-api/cmd/model"
+	"go-jellyfin-api/cmd/poster"
+	"go-jellyfin-api/cmd/repository"
+	"log"
+
+	"golang.org/x/sync/singleflight"
+)
+
+type PosterService interface {
+	GetPoster(ctx context.Context, id int, filter model.MovieFilter, variant *poster.Variant) (*model.MovieImage, error)
+}
+
+// variantCacheSize bounds the memory rendered poster variants take up.
+const variantCacheSize = 64 << 20
+
+type posterService struct {
+	repository repository.MovieRepository
+	images     blob.Store
+	// variants holds rendered variants by Variant.Key. They are kept out of
+	// the image store, which only holds originals under the hash of their
+	// bytes, and are rendered again once evicted.
+	variants *cache.LRU[string, *model.MovieImage]
+	renders  singleflight.Group
+}
+
+func NewPosterService(repository repository.MovieRepository, images blob.Store) PosterService {
+	return &posterService{
+		repository: repository,
+		images:     images,
+		variants: cache.NewLRU[string](variantCacheSize, func(image *model.MovieImage) int64 {
+			return int64(len(image.ImageData))
+		}),
+	}
+}
+
+// GetPoster returns the poster of a movie the filter lets through, or nil if
+// there is none to show. A nil variant returns the poster as Jellyfin sent
+// it. Variants are rendered on first use and kept in memory; the returned
+// Hash is then the variant's key.
+func (p *posterService) GetPoster(ctx context.Context, id int, filter model.MovieFilter, variant *poster.Variant) (*model.MovieImage, error) {
+	image, err := p.repository.GetMovieImage(ctx, id, filter)
+	if err != nil || image == nil {
+		return nil, err
+	}
+	if variant == nil {
+		return p.readImage(ctx, image)
+	}
+
+	key := variant.Key(image.Hash)
+	rendered, ok := p.variants.Get(key)
+	if !ok {
+		// Requests for a variant that isn't rendered yet wait for one render,
+		// which carries on if the request that started it goes away.
+		result, err, _ := p.renders.Do(key, func() (any, error) {
+			return p.render(context.WithoutCancel(ctx), image, *variant, key)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if rendered = result.(*model.MovieImage); rendered == nil {
+			return nil, nil
+		}
+	}
+	// The cached variant may have been rendered for another movie with the
+	// same poster.
+	forMovie := *rendered
+	forMovie.MovieId = id
+	return &forMovie, nil
+}
+
+// render renders the variant of the image and caches it under key. It
+// returns nil if the original is gone.
+func (p *posterService) render(ctx context.Context, image *model.MovieImage, variant poster.Variant, key string) (*model.MovieImage, error) {
+	original, err := p.readImage(ctx, image)
+	if err != nil || original == nil {
+		return nil, err
+	}
+	data, info, err := poster.Render(original.ImageData, variant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render poster of movie %d: %w", image.MovieId, err)
+	}
+	rendered := &model.MovieImage{
+		ImageData:   data,
+		Hash:        key,
+		ContentType: info.ContentType,
+		Width:       info.Width,
+		Height:      info.Height,
+	}
+	p.variants.Add(key, rendered)
+	return rendered, nil
+}
+
+// readImage fills in the poster's bytes, returning nil if the blob is gone.
+func (p *posterService) readImage(ctx context.Context, image *model.MovieImage) (*model.MovieImage, error) {
+	data, err := p.images.Get(ctx, image.Hash)
+	if errors.Is(err, blob.ErrNotFound) {
+		log.Printf("Poster %s of movie %d is missing from the image store\n", image.Hash, image.MovieId)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read poster %s: %w", image.Hash, err)
+	}
+	image.ImageData = data
+	return image, nil
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-jellyfin-api/cmd/config"
+	"go-jellyfin-api/cmd/model"
+	"go-jellyfin-api/cmd/repository"
+	"log"
+	"sync"
+)
+
+// SessionService logs the backend in to Jellyfin. With a session key it keeps
+// the login in the database, so a restart reuses it instead of registering
+// another device session.
+type SessionService interface {
+	Login(ctx context.Context, cfg config.JellyfinConfiguration) error
+	Save(ctx context.Context, cfg config.JellyfinConfiguration) error
+	Reconfigure(ctx context.Context, cfg config.JellyfinConfiguration) error
+	Logout(ctx context.Context) error
+}
+
+// JellyfinSessionClient is the part of the Jellyfin HTTP client that manages
+// the backend's own login.
+type JellyfinSessionClient interface {
+	AuthenticateByName() error
+	Session() model.AuthResponse
+	RestoreSession(session model.AuthResponse) error
+	Reconfigure(cfg config.JellyfinConfiguration) error
+	Logout() error
+}
+
+type sessionService struct {
+	client JellyfinSessionClient
+	repo   repository.SessionRepository
+	key    []byte
+
+	mu       sync.Mutex
+	host     string
+	username string
+}
+
+// NewSessionService returns a service that stores the login encrypted with
+// key. A nil key turns storing off and every Login signs in afresh.
+func NewSessionService(client JellyfinSessionClient, repo repository.SessionRepository, key []byte) SessionService {
+	return &sessionService{
+		client: client,
+		repo:   repo,
+		key:    key,
+	}
+}
+
+// Login reuses the stored session while Jellyfin still accepts its token and
+// signs in with the configured credentials otherwise.
+func (s *sessionService) Login(ctx context.Context, cfg config.JellyfinConfiguration) error {
+	if s.key != nil {
+		err := s.restore(ctx, cfg)
+		if err == nil {
+			log.Println("Reusing stored Jellyfin session")
+			return nil
+		}
+		log.Println("Stored Jellyfin session not usable, logging in:", err)
+	}
+
+	if err := s.client.AuthenticateByName(); err != nil {
+		return err
+	}
+	if s.client.Session().Token == "" {
+		return errors.New("jellyfin did not accept the credentials")
+	}
+	return s.Save(ctx, cfg)
+}
+
+func (s *sessionService) restore(ctx context.Context, cfg config.JellyfinConfiguration) error {
+	host, username := sessionKey(cfg)
+	stored, err := s.repo.GetSession(ctx, host, username)
+	if err != nil {
+		return fmt.Errorf("read stored session: %w", err)
+	}
+	if stored == nil {
+		return errors.New("no stored session")
+	}
+	token, err := openToken(s.key, stored.EncryptedToken, sessionAdditionalData(host, username))
+	if err != nil {
+		return err
+	}
+	err = s.client.RestoreSession(model.AuthResponse{
+		User:  model.AuthUser{Id: stored.UserId, Name: stored.UserName},
+		Token: token,
+	})
+	if err != nil {
+		return err
+	}
+	s.remember(host, username)
+	return nil
+}
+
+// Save stores the client's current login. It does nothing without a key.
+func (s *sessionService) Save(ctx context.Context, cfg config.JellyfinConfiguration) error {
+	if s.key == nil {
+		return nil
+	}
+	session := s.client.Session()
+	host, username := sessionKey(cfg)
+	encrypted, err := sealToken(s.key, session.Token, sessionAdditionalData(host, username))
+	if err != nil {
+		return fmt.Errorf("encrypt session token: %w", err)
+	}
+	err = s.repo.SaveSession(ctx, model.JellyfinSession{
+		Host:           host,
+		Username:       username,
+		UserId:         session.User.Id,
+		UserName:       session.User.Name,
+		EncryptedToken: encrypted,
+	})
+	if err != nil {
+		return fmt.Errorf("store session: %w", err)
+	}
+	s.remember(host, username)
+	return nil
+}
+
+// Reconfigure switches the client to a login with the new configuration,
+// which logs the previous one out, stores the new login and deletes the
+// previous one's stored session if it was kept under another user.
+func (s *sessionService) Reconfigure(ctx context.Context, cfg config.JellyfinConfiguration) error {
+	s.mu.Lock()
+	previousHost, previousUsername := s.host, s.username
+	s.mu.Unlock()
+
+	if err := s.client.Reconfigure(cfg); err != nil {
+		return err
+	}
+	if err := s.Save(ctx, cfg); err != nil {
+		log.Println("Failed to store the new Jellyfin session:", err)
+	}
+	host, username := sessionKey(cfg)
+	if s.key == nil || previousHost == "" || (previousHost == host && previousUsername == username) {
+		return nil
+	}
+	if err := s.repo.DeleteSession(ctx, previousHost, previousUsername); err != nil {
+		log.Println("Failed to delete the previous Jellyfin session:", err)
+	}
+	return nil
+}
+
+// remember notes which stored session is the current one, for Logout.
+func (s *sessionService) remember(host, username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.host = host
+	s.username = username
+}
+
+// Logout revokes the token on the server and forgets the stored session.
+func (s *sessionService) Logout(ctx context.Context) error {
+	if err := s.client.Logout(); err != nil {
+		return fmt.Errorf("jellyfin logout: %w", err)
+	}
+	s.mu.Lock()
+	host, username := s.host, s.username
+	s.mu.Unlock()
+	if s.key == nil || host == "" {
+		return nil
+	}
+	if err := s.repo.DeleteSession(ctx, host, username); err != nil {
+		return fmt.Errorf("delete stored session: %w", err)
+	}
+	return nil
+}
+
+func sessionKey(cfg config.JellyfinConfiguration) (host, username string) {
+	return cfg.GetHost(), cfg.BuildAuthenticationRequest().Username
+}
+
+func sessionAdditionalData(host, username string) []byte {
+	return []byte(host + "\x00" + username)
+}
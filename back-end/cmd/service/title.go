@@ -0,0 +1,31 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeTitle folds a title down to lowercase letters and digits separated
+// by single spaces, dropping accents and punctuation, so that "Amélie" and
+// "Amelie" or "Se7en" and "Se7en." compare equal.
+func normalizeTitle(title string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range norm.NFD.String(title) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteRune(' ')
+			}
+			space = false
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go-jellyfin-api/cmd/cache"
+	"go-jellyfin-api/cmd/model"
+	"time"
+)
+
+const userAccessCacheTTL = 5 * time.Minute
+
+// The caches keep the most recently seen tokens and users, so callers making
+// up tokens can't grow them without bound.
+const (
+	maxCachedTokens = 1024
+	maxCachedUsers  = 256
+)
+
+type UserAccessService interface {
+	ResolveUser(ctx context.Context, token string) (model.JellyfinUser, error)
+	GetAccessibleJellyfinIds(ctx context.Context, user model.JellyfinUser) ([]string, error)
+	GetPlayedJellyfinIds(ctx context.Context, user model.JellyfinUser) ([]string, error)
+}
+
+// JellyfinUserClient is the part of the Jellyfin HTTP client used to look up
+// callers and what they are allowed to see.
+type JellyfinUserClient interface {
+	GetCurrentUser(token string) (model.JellyfinUser, error)
+	GetUserMoviesRequest(user model.JellyfinUser) (model.Items, error)
+}
+
+type cachedUser struct {
+	user    model.JellyfinUser
+	expires time.Time
+}
+
+type cachedAccess struct {
+	jellyfinIds []string
+	playedIds   []string
+	expires     time.Time
+}
+
+type userAccessService struct {
+	client JellyfinUserClient
+	// users maps tokens to their user, access user ids to their movies.
+	users  *cache.LRU[string, cachedUser]
+	access *cache.LRU[string, cachedAccess]
+}
+
+func NewUserAccessService(client JellyfinUserClient) UserAccessService {
+	return &userAccessService{
+		client: client,
+		users:  cache.NewLRU[string, cachedUser](maxCachedTokens, nil),
+		access: cache.NewLRU[string, cachedAccess](maxCachedUsers, nil),
+	}
+}
+
+func (u *userAccessService) ResolveUser(ctx context.Context, token string) (model.JellyfinUser, error) {
+	cached, ok := u.users.Get(token)
+	if ok && time.Now().Before(cached.expires) {
+		return cached.user, nil
+	}
+
+	user, err := u.client.GetCurrentUser(token)
+	if err != nil {
+		return model.JellyfinUser{}, err
+	}
+
+	u.users.Add(token, cachedUser{user: user, expires: time.Now().Add(userAccessCacheTTL)})
+	return user, nil
+}
+
+// GetAccessibleJellyfinIds returns the Jellyfin ids of every movie the user is
+// allowed to see, as decided by Jellyfin's library and parental settings.
+func (u *userAccessService) GetAccessibleJellyfinIds(ctx context.Context, user model.JellyfinUser) ([]string, error) {
+	access, err := u.userMovies(user)
+	if err != nil {
+		return nil, err
+	}
+	return access.jellyfinIds, nil
+}
+
+// GetPlayedJellyfinIds returns the Jellyfin ids of the movies the user has
+// marked as played.
+func (u *userAccessService) GetPlayedJellyfinIds(ctx context.Context, user model.JellyfinUser) ([]string, error) {
+	access, err := u.userMovies(user)
+	if err != nil {
+		return nil, err
+	}
+	return access.playedIds, nil
+}
+
+// userMovies fetches the user's movie list once per cache period; both the
+// access and the played state come from it.
+func (u *userAccessService) userMovies(user model.JellyfinUser) (cachedAccess, error) {
+	cached, ok := u.access.Get(user.Id)
+	if ok && time.Now().Before(cached.expires) {
+		return cached, nil
+	}
+
+	items, err := u.client.GetUserMoviesRequest(user)
+	if err != nil {
+		return cachedAccess{}, fmt.Errorf("failed to get movies for user %s: %w", user.Id, err)
+	}
+	access := cachedAccess{
+		jellyfinIds: make([]string, 0, len(items.ItemElements)),
+		playedIds:   []string{},
+		expires:     time.Now().Add(userAccessCacheTTL),
+	}
+	for _, item := range items.ItemElements {
+		access.jellyfinIds = append(access.jellyfinIds, item.Id)
+		if item.UserData.Played {
+			access.playedIds = append(access.playedIds, item.Id)
+		}
+	}
+
+	u.access.Add(user.Id, access)
+	return access, nil
+}
@@ -3,19 +3,19 @@ package service
 import (
 	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"go-jellyfin-api/cmd/config"
 	"go-jellyfin-api/cmd/model"
 	"go-jellyfin-api/cmd/repository"
+	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
-const (
-	RESOURCE_LOCATION  = "/app/resources/"
-	WATCHLIST_FILENAME = "watchlist.csv"
-)
-
 type WatchlistService interface {
 	LoadWatchlistCSV(ctx context.Context) (model.Watchlist, error)
 	GetAllWatchlist(ctx context.Context) ([]model.WatchlistItem, error)
@@ -23,20 +23,27 @@ type WatchlistService interface {
 
 type watchlistService struct {
 	repository repository.WatchlistRepository
+	resources  config.ResourceSettings
 }
 
-func NewWatchlistService(repository repository.WatchlistRepository) WatchlistService {
+func NewWatchlistService(repository repository.WatchlistRepository, resources config.ResourceSettings) WatchlistService {
 	return &watchlistService{
 		repository: repository,
+		resources:  resources,
 	}
 }
 
 func (w *watchlistService) LoadWatchlistCSV(ctx context.Context) (model.Watchlist, error) {
-	path := RESOURCE_LOCATION + WATCHLIST_FILENAME
+	path := filepath.Join(w.resources.Location, w.resources.WatchlistFilename)
 	result, err := readCsvFile(path)
 	if err != nil {
 		return model.Watchlist{}, err
 	}
+	mapping, err := readIdMappingFile(filepath.Join(w.resources.Location, w.resources.IdMappingFilename))
+	if err != nil {
+		return model.Watchlist{}, err
+	}
+	applyIdMapping(&result, mapping)
 	err = w.repository.PopulateDatabase(ctx, result)
 	if err != nil {
 		fmt.Println(err)
@@ -70,25 +77,102 @@ func readCsvFile(filePath string) (model.Watchlist, error) {
 	return mapToWatchlist(records), nil
 }
 
+// mapToWatchlist reads a Letterboxd watchlist export. Columns are found by
+// header name, so exports that carry extra "tmdbID"/"imdbID" columns have
+// those ids picked up as well.
 func mapToWatchlist(records [][]string) model.Watchlist {
 	var watchlist model.Watchlist
+	if len(records) == 0 {
+		return watchlist
+	}
+	columns := csvColumns(records[0])
 	var watchlistItems []model.WatchlistItem
-	for _, record := range records {
-		if record[0] == "Date" {
-			// skip header
-			continue
-		}
+	for _, record := range records[1:] {
 		var item model.WatchlistItem
-		item.DateAdded = parseTime("2006-01-02", record[0])
-		item.Title = record[1]
-		item.DateReleased = parseTime("2006", record[2])
-		item.LetterboxdUri = record[3]
+		item.DateAdded = parseTime("2006-01-02", csvField(record, columns, "date"))
+		item.Title = csvField(record, columns, "name")
+		item.DateReleased = parseTime("2006", csvField(record, columns, "year"))
+		item.LetterboxdUri = csvField(record, columns, "letterboxduri")
+		item.TmdbId = csvField(record, columns, "tmdbid")
+		item.ImdbId = csvField(record, columns, "imdbid")
 		watchlistItems = append(watchlistItems, item)
 	}
 	watchlist.WatchlistItems = watchlistItems
 	return watchlist
 }
 
+// readIdMappingFile reads the optional user-supplied CSV mapping Letterboxd
+// URIs to TMDb and IMDb ids, with a "Letterboxd URI,TMDb ID,IMDb ID" header.
+// A missing file is not an error.
+func readIdMappingFile(filePath string) (map[string]model.ProviderIds, error) {
+	f, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open id mapping %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read id mapping %s: %w", filePath, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := csvColumns(records[0])
+	mapping := make(map[string]model.ProviderIds, len(records)-1)
+	for _, record := range records[1:] {
+		uri := csvField(record, columns, "letterboxduri")
+		if uri == "" {
+			continue
+		}
+		mapping[uri] = model.ProviderIds{
+			ImdbId: csvField(record, columns, "imdbid"),
+			TmdbId: csvField(record, columns, "tmdbid"),
+		}
+	}
+	return mapping, nil
+}
+
+// applyIdMapping fills in ids from the mapping, keeping any id the watchlist
+// export already had.
+func applyIdMapping(watchlist *model.Watchlist, mapping map[string]model.ProviderIds) {
+	for i := range watchlist.WatchlistItems {
+		item := &watchlist.WatchlistItems[i]
+		ids, ok := mapping[item.LetterboxdUri]
+		if !ok {
+			continue
+		}
+		if item.ImdbId == "" {
+			item.ImdbId = ids.ImdbId
+		}
+		if item.TmdbId == "" {
+			item.TmdbId = ids.TmdbId
+		}
+	}
+}
+
+// csvColumns indexes a header row by lowercased name with spaces removed, so
+// "Letterboxd URI" is looked up as "letterboxduri" and "TMDb ID" as "tmdbid".
+func csvColumns(header []string) map[string]int {
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", ""))] = i
+	}
+	return columns
+}
+
+func csvField(record []string, columns map[string]int, name string) string {
+	i, ok := columns[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
 func parseTime(layout string, timeString string) time.Time {
 	if timeString == "" {
 		return time.Time{}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go-jellyfin-api/cmd/blob"
+	"go-jellyfin-api/cmd/config"
+	"go-jellyfin-api/cmd/repository"
+	"go-jellyfin-api/cmd/repository/sqlite"
+)
+
+// Storage is the database the backend runs on, behind its repositories.
+type Storage struct {
+	Repositories *Repositories
+	Sessions     repository.SessionRepository
+	Backups      repository.BackupRepository
+	Close        func()
+}
+
+// openStorage connects to the database selected by database.driver, prepares
+// its schema and creates the repositories on top of it.
+func openStorage(ctx context.Context, settings config.DatabaseSettings, images blob.Store) (*Storage, error) {
+	switch settings.Driver {
+	case config.DatabaseDriverSQLite:
+		db, err := openSQLite(ctx, settings.Path, settings.AutoMigrate)
+		if err != nil {
+			return nil, err
+		}
+		return newStorage(sqlite.NewDatabase(db), images, func() { db.Close() }), nil
+	case config.DatabaseDriverPostgres:
+		pool, err := initDatabase(ctx, settings)
+		if err != nil {
+			return nil, err
+		}
+		return newStorage(repository.NewPostgresDatabase(pool), images, pool.Close), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", settings.Driver)
+	}
+}
+
+func newStorage(db *repository.Database, images blob.Store, close func()) *Storage {
+	return &Storage{
+		Repositories: &Repositories{
+			UnitOfWork:     repository.NewUnitOfWork(db),
+			Movie:          repository.NewMovieRepository(db, images),
+			Watchlist:      repository.NewWatchlistRepository(db),
+			MovieWatchlist: repository.NewMovieWatchlistRepository(db),
+		},
+		Sessions: repository.NewSessionRepository(db),
+		Backups:  repository.NewBackupRepository(db),
+		Close:    close,
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const syncTimeout = 5 * time.Minute
+
+// syncScheduler reruns the library sync on an interval that can be changed
+// while it runs. A zero interval pauses it.
+type syncScheduler struct {
+	sync     func(ctx context.Context) error
+	interval chan time.Duration
+}
+
+func newSyncScheduler(sync func(ctx context.Context) error) *syncScheduler {
+	return &syncScheduler{
+		sync:     sync,
+		interval: make(chan time.Duration, 1),
+	}
+}
+
+// SetInterval replaces the interval; only the latest unapplied value is kept.
+func (s *syncScheduler) SetInterval(interval time.Duration) {
+	select {
+	case <-s.interval:
+	default:
+	}
+	s.interval <- interval
+}
+
+func (s *syncScheduler) Run(ctx context.Context, interval time.Duration) {
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	reset := func(interval time.Duration) {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, tick = nil, nil
+		}
+		if interval > 0 {
+			ticker = time.NewTicker(interval)
+			tick = ticker.C
+		}
+	}
+	reset(interval)
+	defer reset(0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case interval := <-s.interval:
+			log.Printf("Library sync interval set to %s\n", interval)
+			reset(interval)
+		case <-tick:
+			log.Println("Running scheduled library sync...")
+			syncCtx, cancel := context.WithTimeout(ctx, syncTimeout)
+			if err := s.sync(syncCtx); err != nil {
+				log.Println("Scheduled library sync failed:", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Package db embeds the schema migrations so the binary doesn't depend on
+// the directory it is started from.
+package db
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+//go:embed migrations/*.sql
+var postgresMigrations embed.FS
+
+//go:embed sqlite/migrations/*.sql
+var sqliteMigrations embed.FS
+
+// PostgresMigrations returns the migrations for the Postgres schema.
+func PostgresMigrations() (source.Driver, error) {
+	return iofs.New(postgresMigrations, "migrations")
+}
+
+// SQLiteMigrations returns the migrations for the SQLite schema.
+func SQLiteMigrations() (source.Driver, error) {
+	return iofs.New(sqliteMigrations, "sqlite/migrations")
+}
+
+// LatestVersion is the version the migrations in src end at.
+func LatestVersion(src source.Driver) (uint, error) {
+	version, err := src.First()
+	if err != nil {
+		return 0, fmt.Errorf("read first migration: %w", err)
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read migration after %d: %w", version, err)
+		}
+		version = next
+	}
+}
@@ -0,0 +1,4 @@
+ALTER TABLE movie
+    DROP COLUMN original_title,
+    DROP COLUMN sort_name,
+    DROP COLUMN alternate_titles;
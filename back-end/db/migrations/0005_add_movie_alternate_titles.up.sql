@@ -0,0 +1,4 @@
+ALTER TABLE movie
+    ADD COLUMN original_title   VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN sort_name        VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN alternate_titles TEXT[]       NOT NULL DEFAULT '{}';
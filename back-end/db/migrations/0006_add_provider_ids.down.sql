@@ -0,0 +1,10 @@
+DROP INDEX idx_movie_imdb_id;
+DROP INDEX idx_movie_tmdb_id;
+
+ALTER TABLE watchlist
+    DROP COLUMN imdb_id,
+    DROP COLUMN tmdb_id;
+
+ALTER TABLE movie
+    DROP COLUMN imdb_id,
+    DROP COLUMN tmdb_id;
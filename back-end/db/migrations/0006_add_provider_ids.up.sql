@@ -0,0 +1,10 @@
+ALTER TABLE movie
+    ADD COLUMN imdb_id VARCHAR(32) NOT NULL DEFAULT '',
+    ADD COLUMN tmdb_id VARCHAR(32) NOT NULL DEFAULT '';
+
+ALTER TABLE watchlist
+    ADD COLUMN imdb_id VARCHAR(32) NOT NULL DEFAULT '',
+    ADD COLUMN tmdb_id VARCHAR(32) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_movie_imdb_id ON movie (imdb_id);
+CREATE INDEX idx_movie_tmdb_id ON movie (tmdb_id);
@@ -0,0 +1 @@
+DROP TABLE jellyfin_session;
@@ -0,0 +1,10 @@
+CREATE TABLE jellyfin_session
+(
+    host            VARCHAR(255) NOT NULL,
+    username        VARCHAR(255) NOT NULL,
+    user_id         VARCHAR(64)  NOT NULL,
+    user_name       VARCHAR(255) NOT NULL,
+    encrypted_token BYTEA        NOT NULL,
+    updated_at      TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    PRIMARY KEY (host, username)
+);
@@ -0,0 +1,4 @@
+DROP INDEX idx_movie_active;
+
+ALTER TABLE movie
+    DROP COLUMN deleted_at;
@@ -0,0 +1,4 @@
+ALTER TABLE movie
+    ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_movie_active ON movie (id) WHERE deleted_at IS NULL;
@@ -0,0 +1,11 @@
+DROP VIEW recently_updated_movie;
+
+DROP TABLE movie_change;
+
+ALTER TABLE movie_image
+    DROP COLUMN created_at,
+    DROP COLUMN updated_at;
+
+ALTER TABLE movie
+    DROP COLUMN created_at,
+    DROP COLUMN updated_at;
@@ -0,0 +1,30 @@
+ALTER TABLE movie
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+ALTER TABLE movie_image
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE TABLE movie_change
+(
+    id             serial PRIMARY KEY,
+    movie_id       INTEGER     NOT NULL REFERENCES movie (id) ON DELETE CASCADE,
+    changed_fields TEXT[]      NOT NULL,
+    changes        JSONB       NOT NULL,
+    changed_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_movie_change_changed_at ON movie_change (changed_at DESC);
+CREATE INDEX idx_movie_change_movie_id ON movie_change (movie_id);
+
+-- One row per movie changed in the last 30 days, with every field that
+-- changed in that time.
+CREATE VIEW recently_updated_movie AS
+SELECT c.movie_id,
+       max(c.changed_at)                           AS last_changed_at,
+       array_agg(DISTINCT f.field ORDER BY f.field) AS changed_fields
+FROM movie_change c
+         CROSS JOIN LATERAL unnest(c.changed_fields) AS f(field)
+WHERE c.changed_at > now() - INTERVAL '30 days'
+GROUP BY c.movie_id;
@@ -0,0 +1,11 @@
+DROP INDEX idx_movie_search_vector;
+
+DROP TRIGGER movie_search_vector_trigger ON movie;
+
+DROP FUNCTION movie_search_vector_update();
+
+ALTER TABLE movie
+    DROP COLUMN overview,
+    DROP COLUMN genres,
+    DROP COLUMN people,
+    DROP COLUMN search_vector;
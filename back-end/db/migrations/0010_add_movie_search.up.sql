@@ -0,0 +1,33 @@
+ALTER TABLE movie
+    ADD COLUMN overview      TEXT   NOT NULL DEFAULT '',
+    ADD COLUMN genres        TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN people        TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN search_vector tsvector;
+
+-- The 'simple' configuration doesn't stem, which suits names and titles in
+-- any language. Titles rank above genres and people, which rank above the
+-- overview.
+CREATE FUNCTION movie_search_vector_update() RETURNS trigger AS
+$$
+BEGIN
+    NEW.search_vector :=
+            setweight(to_tsvector('simple', NEW.title), 'A') ||
+            setweight(to_tsvector('simple', NEW.original_title), 'A') ||
+            setweight(to_tsvector('simple', array_to_string(NEW.alternate_titles, ' ')), 'B') ||
+            setweight(to_tsvector('simple', array_to_string(NEW.genres, ' ')), 'B') ||
+            setweight(to_tsvector('simple', array_to_string(NEW.people, ' ')), 'C') ||
+            setweight(to_tsvector('simple', NEW.overview), 'D');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movie_search_vector_trigger
+    BEFORE INSERT OR UPDATE
+    ON movie
+    FOR EACH ROW
+EXECUTE FUNCTION movie_search_vector_update();
+
+-- Fill in the vector for the rows already there.
+UPDATE movie SET title = title;
+
+CREATE INDEX idx_movie_search_vector ON movie USING GIN (search_vector);
@@ -0,0 +1,5 @@
+DROP INDEX idx_watchlist_title_trgm;
+DROP INDEX idx_movie_original_title_trgm;
+DROP INDEX idx_movie_title_trgm;
+
+DROP FUNCTION search_title(TEXT);
@@ -0,0 +1,13 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm SCHEMA public;
+CREATE EXTENSION IF NOT EXISTS unaccent SCHEMA public;
+
+-- unaccent is only STABLE because its dictionary could change, which keeps it
+-- out of indexes. Pinning the dictionary makes this wrapper safe to index.
+CREATE FUNCTION search_title(title TEXT) RETURNS TEXT AS
+$$
+SELECT lower(public.unaccent('public.unaccent'::regdictionary, title))
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT;
+
+CREATE INDEX idx_movie_title_trgm ON movie USING GIN (search_title(title) public.gin_trgm_ops);
+CREATE INDEX idx_movie_original_title_trgm ON movie USING GIN (search_title(original_title) public.gin_trgm_ops);
+CREATE INDEX idx_watchlist_title_trgm ON watchlist USING GIN (search_title(title) public.gin_trgm_ops);
@@ -0,0 +1,8 @@
+DROP INDEX idx_movie_sort_added;
+DROP INDEX idx_movie_sort_rating;
+DROP INDEX idx_movie_sort_year;
+DROP INDEX idx_movie_sort_title;
+DROP INDEX idx_movie_library_id;
+
+ALTER TABLE movie
+    DROP COLUMN library_id;
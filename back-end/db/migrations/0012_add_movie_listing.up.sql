@@ -0,0 +1,10 @@
+ALTER TABLE movie
+    ADD COLUMN library_id VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_movie_library_id ON movie (library_id);
+
+-- Keyset pagination orders by the sort column and then the id.
+CREATE INDEX idx_movie_sort_title ON movie ((coalesce(nullif(sort_name, ''), lower(title))), id);
+CREATE INDEX idx_movie_sort_year ON movie (production_year, id);
+CREATE INDEX idx_movie_sort_rating ON movie (community_rating, id);
+CREATE INDEX idx_movie_sort_added ON movie (created_at, id);
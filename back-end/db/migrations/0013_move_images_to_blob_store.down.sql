@@ -0,0 +1,12 @@
+-- Images already moved to the blob store are dropped; the next sync fetches
+-- them from Jellyfin again.
+DELETE FROM movie_image WHERE image_data IS NULL;
+
+DROP INDEX idx_movie_image_hash;
+
+ALTER TABLE movie_image
+    ALTER COLUMN image_data SET NOT NULL,
+    DROP COLUMN image_hash,
+    DROP COLUMN content_type,
+    DROP COLUMN width,
+    DROP COLUMN height;
@@ -0,0 +1,10 @@
+-- Image bytes now live in the blob store under image_hash. image_data stays
+-- nullable until the backend has moved the existing images out at startup.
+ALTER TABLE movie_image
+    ADD COLUMN image_hash   VARCHAR(64),
+    ADD COLUMN content_type VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN width        INT         NOT NULL DEFAULT 0,
+    ADD COLUMN height       INT         NOT NULL DEFAULT 0,
+    ALTER COLUMN image_data DROP NOT NULL;
+
+CREATE INDEX idx_movie_image_hash ON movie_image (image_hash);
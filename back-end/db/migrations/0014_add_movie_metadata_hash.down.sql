@@ -0,0 +1,2 @@
+ALTER TABLE movie
+    DROP COLUMN metadata_hash;
@@ -0,0 +1,4 @@
+-- A digest of the synced metadata, so a sync only reads back the movies that
+-- changed. Existing movies start without one and are compared in full once.
+ALTER TABLE movie
+    ADD COLUMN metadata_hash VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,16 @@
+ALTER TABLE movie
+    ADD COLUMN alternate_titles TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE OR REPLACE FUNCTION movie_search_vector_update() RETURNS trigger AS
+$$
+BEGIN
+    NEW.search_vector :=
+            setweight(to_tsvector('simple', NEW.title), 'A') ||
+            setweight(to_tsvector('simple', NEW.original_title), 'A') ||
+            setweight(to_tsvector('simple', array_to_string(NEW.alternate_titles, ' ')), 'B') ||
+            setweight(to_tsvector('simple', array_to_string(NEW.genres, ' ')), 'B') ||
+            setweight(to_tsvector('simple', array_to_string(NEW.people, ' ')), 'C') ||
+            setweight(to_tsvector('simple', NEW.overview), 'D');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
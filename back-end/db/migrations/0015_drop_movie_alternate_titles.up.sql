@@ -0,0 +1,17 @@
+-- Jellyfin has no alternate titles to give, so the column only ever stayed
+-- empty. Titles are matched on the title, original title and sort name.
+CREATE OR REPLACE FUNCTION movie_search_vector_update() RETURNS trigger AS
+$$
+BEGIN
+    NEW.search_vector :=
+            setweight(to_tsvector('simple', NEW.title), 'A') ||
+            setweight(to_tsvector('simple', NEW.original_title), 'A') ||
+            setweight(to_tsvector('simple', array_to_string(NEW.genres, ' ')), 'B') ||
+            setweight(to_tsvector('simple', array_to_string(NEW.people, ' ')), 'C') ||
+            setweight(to_tsvector('simple', NEW.overview), 'D');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE movie
+    DROP COLUMN alternate_titles;
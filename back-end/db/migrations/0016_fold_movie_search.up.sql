@@ -0,0 +1,16 @@
+-- Fold the search vector with search_title, as the search query is, so
+-- accents are ignored the way the title suggestions ignore them.
+CREATE OR REPLACE FUNCTION movie_search_vector_update() RETURNS trigger AS
+$$
+BEGIN
+    NEW.search_vector :=
+            setweight(to_tsvector('simple', search_title(NEW.title)), 'A') ||
+            setweight(to_tsvector('simple', search_title(NEW.original_title)), 'A') ||
+            setweight(to_tsvector('simple', search_title(array_to_string(NEW.genres, ' '))), 'B') ||
+            setweight(to_tsvector('simple', search_title(array_to_string(NEW.people, ' '))), 'C') ||
+            setweight(to_tsvector('simple', search_title(NEW.overview)), 'D');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+UPDATE movie SET title = title;
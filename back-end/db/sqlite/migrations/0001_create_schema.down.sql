@@ -0,0 +1,8 @@
+DROP TABLE movie_search;
+DROP VIEW recently_updated_movie;
+DROP TABLE movie_change;
+DROP TABLE jellyfin_session;
+DROP TABLE movie_watchlist;
+DROP TABLE watchlist;
+DROP TABLE movie_image;
+DROP TABLE movie;
@@ -0,0 +1,128 @@
+-- The SQLite schema mirrors the Postgres one as of its migration 0013. Lists
+-- are stored as JSON arrays and timestamps as UTC 'YYYY-MM-DD HH:MM:SS' text.
+CREATE TABLE movie
+(
+    id               INTEGER PRIMARY KEY,
+    jellyfin_id      TEXT      NOT NULL UNIQUE,
+    title            TEXT      NOT NULL,
+    production_year  INTEGER   NOT NULL,
+    community_rating REAL      NOT NULL,
+    original_title   TEXT      NOT NULL DEFAULT '',
+    sort_name        TEXT      NOT NULL DEFAULT '',
+    alternate_titles TEXT      NOT NULL DEFAULT '[]',
+    library_id       TEXT      NOT NULL DEFAULT '',
+    overview         TEXT      NOT NULL DEFAULT '',
+    genres           TEXT      NOT NULL DEFAULT '[]',
+    people           TEXT      NOT NULL DEFAULT '[]',
+    imdb_id          TEXT      NOT NULL DEFAULT '',
+    tmdb_id          TEXT      NOT NULL DEFAULT '',
+    created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at       TIMESTAMP
+);
+
+CREATE INDEX idx_movie_active ON movie (id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_movie_imdb_id ON movie (imdb_id);
+CREATE INDEX idx_movie_tmdb_id ON movie (tmdb_id);
+CREATE INDEX idx_movie_library_id ON movie (library_id);
+CREATE INDEX idx_movie_sort_title ON movie (coalesce(nullif(sort_name, ''), lower(title)), id);
+CREATE INDEX idx_movie_sort_year ON movie (production_year, id);
+CREATE INDEX idx_movie_sort_rating ON movie (community_rating, id);
+CREATE INDEX idx_movie_sort_added ON movie (created_at, id);
+
+-- Poster bytes live in the blob store under image_hash.
+CREATE TABLE movie_image
+(
+    movie_id     INTEGER PRIMARY KEY REFERENCES movie (id) ON DELETE CASCADE,
+    image_hash   TEXT      NOT NULL,
+    content_type TEXT      NOT NULL DEFAULT '',
+    width        INTEGER   NOT NULL DEFAULT 0,
+    height       INTEGER   NOT NULL DEFAULT 0,
+    created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_movie_image_hash ON movie_image (image_hash);
+
+CREATE TABLE watchlist
+(
+    id              INTEGER PRIMARY KEY,
+    title           TEXT      NOT NULL,
+    production_year TIMESTAMP NOT NULL,
+    added_date      TIMESTAMP NOT NULL,
+    letterboxd_uri  TEXT      NOT NULL UNIQUE,
+    imdb_id         TEXT      NOT NULL DEFAULT '',
+    tmdb_id         TEXT      NOT NULL DEFAULT ''
+);
+
+CREATE TABLE movie_watchlist
+(
+    movie_id     INTEGER   NOT NULL REFERENCES movie (id),
+    watchlist_id INTEGER   NOT NULL REFERENCES watchlist (id),
+    added_date   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (movie_id, watchlist_id)
+);
+
+CREATE INDEX idx_movie_watchlist_watchlist ON movie_watchlist (watchlist_id);
+
+CREATE TABLE jellyfin_session
+(
+    host            TEXT      NOT NULL,
+    username        TEXT      NOT NULL,
+    user_id         TEXT      NOT NULL,
+    user_name       TEXT      NOT NULL,
+    encrypted_token BLOB      NOT NULL,
+    updated_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (host, username)
+);
+
+CREATE TABLE movie_change
+(
+    id             INTEGER PRIMARY KEY,
+    movie_id       INTEGER   NOT NULL REFERENCES movie (id) ON DELETE CASCADE,
+    changed_fields TEXT      NOT NULL,
+    changes        TEXT      NOT NULL,
+    changed_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_movie_change_changed_at ON movie_change (changed_at DESC);
+CREATE INDEX idx_movie_change_movie_id ON movie_change (movie_id);
+
+-- One row per movie changed in the last 30 days, with every field that
+-- changed in that time.
+CREATE VIEW recently_updated_movie AS
+SELECT c.movie_id,
+       max(c.changed_at) AS last_changed_at,
+       (SELECT json_group_array(field)
+        FROM (SELECT DISTINCT f.value AS field
+              FROM movie_change c2, json_each(c2.changed_fields) f
+              WHERE c2.movie_id = c.movie_id
+                AND c2.changed_at > datetime('now', '-30 days')
+              ORDER BY field)) AS changed_fields
+FROM movie_change c
+WHERE c.changed_at > datetime('now', '-30 days')
+GROUP BY c.movie_id;
+
+-- Full-text index over the movie table. The columns are weighted when
+-- ranking: titles above alternate titles and genres, above people, above the
+-- overview. The JSON lists tokenize into their words.
+CREATE VIRTUAL TABLE movie_search USING fts4(
+    content="movie",
+    title, original_title, alternate_titles, genres, people, overview,
+    tokenize=unicode61 "remove_diacritics=2"
+);
+
+CREATE TRIGGER movie_search_before_update BEFORE UPDATE ON movie BEGIN
+    DELETE FROM movie_search WHERE docid = old.id;
+END;
+CREATE TRIGGER movie_search_before_delete BEFORE DELETE ON movie BEGIN
+    DELETE FROM movie_search WHERE docid = old.id;
+END;
+CREATE TRIGGER movie_search_after_update AFTER UPDATE ON movie BEGIN
+    INSERT INTO movie_search (docid, title, original_title, alternate_titles, genres, people, overview)
+    VALUES (new.id, new.title, new.original_title, new.alternate_titles, new.genres, new.people, new.overview);
+END;
+CREATE TRIGGER movie_search_after_insert AFTER INSERT ON movie BEGIN
+    INSERT INTO movie_search (docid, title, original_title, alternate_titles, genres, people, overview)
+    VALUES (new.id, new.title, new.original_title, new.alternate_titles, new.genres, new.people, new.overview);
+END;
@@ -0,0 +1,3 @@
+-- Mirrors the Postgres migration 0014.
+ALTER TABLE movie
+    ADD COLUMN metadata_hash TEXT NOT NULL DEFAULT '';
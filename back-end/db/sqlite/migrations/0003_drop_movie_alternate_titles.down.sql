@@ -0,0 +1,30 @@
+DROP TRIGGER movie_search_before_update;
+DROP TRIGGER movie_search_before_delete;
+DROP TRIGGER movie_search_after_update;
+DROP TRIGGER movie_search_after_insert;
+DROP TABLE movie_search;
+
+ALTER TABLE movie
+    ADD COLUMN alternate_titles TEXT NOT NULL DEFAULT '[]';
+
+CREATE VIRTUAL TABLE movie_search USING fts4(
+    content="movie",
+    title, original_title, alternate_titles, genres, people, overview,
+    tokenize=unicode61 "remove_diacritics=2"
+);
+INSERT INTO movie_search (movie_search) VALUES ('rebuild');
+
+CREATE TRIGGER movie_search_before_update BEFORE UPDATE ON movie BEGIN
+    DELETE FROM movie_search WHERE docid = old.id;
+END;
+CREATE TRIGGER movie_search_before_delete BEFORE DELETE ON movie BEGIN
+    DELETE FROM movie_search WHERE docid = old.id;
+END;
+CREATE TRIGGER movie_search_after_update AFTER UPDATE ON movie BEGIN
+    INSERT INTO movie_search (docid, title, original_title, alternate_titles, genres, people, overview)
+    VALUES (new.id, new.title, new.original_title, new.alternate_titles, new.genres, new.people, new.overview);
+END;
+CREATE TRIGGER movie_search_after_insert AFTER INSERT ON movie BEGIN
+    INSERT INTO movie_search (docid, title, original_title, alternate_titles, genres, people, overview)
+    VALUES (new.id, new.title, new.original_title, new.alternate_titles, new.genres, new.people, new.overview);
+END;
@@ -0,0 +1,33 @@
+-- Mirrors the Postgres migration 0016: the search index holds every column
+-- folded with search_title, so accents and letters such as ø and æ match
+-- the way unaccent folds them. The index keeps its own copy of the folded
+-- text rather than reading the movie table.
+DROP TRIGGER movie_search_before_update;
+DROP TRIGGER movie_search_before_delete;
+DROP TRIGGER movie_search_after_update;
+DROP TRIGGER movie_search_after_insert;
+DROP TABLE movie_search;
+
+CREATE VIRTUAL TABLE movie_search USING fts4(
+    title, original_title, genres, people, overview,
+    tokenize=unicode61
+);
+INSERT INTO movie_search (docid, title, original_title, genres, people, overview)
+SELECT id, search_title(title), search_title(original_title), search_title(genres), search_title(people),
+       search_title(overview)
+FROM movie;
+
+CREATE TRIGGER movie_search_after_delete AFTER DELETE ON movie BEGIN
+    DELETE FROM movie_search WHERE docid = old.id;
+END;
+CREATE TRIGGER movie_search_after_update AFTER UPDATE ON movie BEGIN
+    DELETE FROM movie_search WHERE docid = old.id;
+    INSERT INTO movie_search (docid, title, original_title, genres, people, overview)
+    VALUES (new.id, search_title(new.title), search_title(new.original_title), search_title(new.genres),
+            search_title(new.people), search_title(new.overview));
+END;
+CREATE TRIGGER movie_search_after_insert AFTER INSERT ON movie BEGIN
+    INSERT INTO movie_search (docid, title, original_title, genres, people, overview)
+    VALUES (new.id, search_title(new.title), search_title(new.original_title), search_title(new.genres),
+            search_title(new.people), search_title(new.overview));
+END;
@@ -15,14 +15,25 @@ export async function getRandomWatchlistMovies(): Promise<Movie> {
     return data.map(convertToMovie)
 }
 
+// posterUrl points at the poster endpoint. Movies that haven't been synced
+// yet have no poster there and carry the image inline instead.
+function posterUrl(image: any): string | undefined {
+    if (image.Url) {
+        return `${BASE_URL}${image.Url}`
+    }
+    if (image.ImageData) {
+        return `data:${image.ContentType || "image/jpeg"};base64,${image.ImageData}`
+    }
+    return undefined
+}
+
 function convertToMovie(data: any): Movie {
-    const binaryImageData = Uint8Array.from(atob(data.MovieImage.ImageData), char => char.charCodeAt(0));
     return {
         movieId: data.Movie.Id,
         productionYear: data.Movie.ProductionYear,
         communityRating: data.Movie.CommunityRating,
         name: data.Movie.Name,
         jellyfinId: data.Movie.JellyfinId,
-        imageData: binaryImageData
+        posterUrl: posterUrl(data.MovieImage)
     }
 }
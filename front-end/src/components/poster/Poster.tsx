@@ -1,6 +1,5 @@
 import {Show} from "../../model/Show.tsx";
 import "./Poster.css"
-import {useEffect, useState} from "react";
 
 interface PosterProps {
 	show: Show
@@ -8,16 +7,7 @@ interface PosterProps {
 
 function Poster({show}: PosterProps) {
 
-	const [posterImageData, setPosterImageData] = useState<string>();
-
-useEffect(() => {
-  if (show.movieId && show.imageData) {
-    const blob = new Blob([show.imageData], { type: 'image/jpeg' });
-    const url = URL.createObjectURL(blob);
-    setPosterImageData(url);
-  }
-}, [show]);
-
+	const posterUrl = show.posterUrl;
 
 	const handleClick = () => {
 		show.onSelect();
@@ -27,14 +17,14 @@ useEffect(() => {
 	return (
 		<>
 			{
-				posterImageData && (
+				posterUrl && (
 					<div
 						className={`movie-card ${show.isSelected ? 'movie-card--selected' : ''}`}
 						onClick={handleClick}
 					>
 						<div
 							className="movie-card__backdrop"
-							style={{backgroundImage: `url(${posterImageData})`}}
+							style={{backgroundImage: `url(${posterUrl})`}}
 						>
 							<div className="movie-card__text-container">
 								<h2 className="movie-card__title">{show.title}</h2>
@@ -47,7 +37,7 @@ useEffect(() => {
 				)
 			}
 			{
-				!posterImageData && (
+				!posterUrl && (
 					<div className="movie-card">
 						<div
 							className="movie-card__backdrop"
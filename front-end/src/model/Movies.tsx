@@ -4,5 +4,5 @@ export interface Movie {
 	jellyfinId: string
 	name: string
 	productionYear: number
-  imageData: Uint8Array
+  posterUrl?: string
 }
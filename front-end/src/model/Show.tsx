@@ -5,6 +5,6 @@ export interface Show {
 	jellyfinId: string
 	rating: number
 	isSelected: boolean
-  imageData: Uint8Array
+  posterUrl?: string
 	onSelect: () => void;
 }
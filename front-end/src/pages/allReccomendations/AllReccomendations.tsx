@@ -37,7 +37,7 @@ function AllRecommendations() {
                 year: movie.productionYear,
                 rating: movie.communityRating,
                 isSelected: index === selectedMovieIndex,
-                imageData: movie.imageData,
+                posterUrl: movie.posterUrl,
                 onSelect: () => handleMovieSelect(index),
               }} />
             </div>
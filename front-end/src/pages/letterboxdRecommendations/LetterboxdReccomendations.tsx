@@ -35,7 +35,7 @@ function LetterboxdRecommendations() {
                                 year: movie.productionYear,
                                 rating: movie.communityRating,
                                 isSelected: index === selectedMovieIndex,
-                                imageData: movie.imageData,
+                                posterUrl: movie.posterUrl,
                                 onSelect: () => handleMovieSelect(index),
                             }}/>
                         </div>